@@ -1,35 +1,97 @@
 package audit
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"s3mgr/logger"
 )
 
 // AuditLog represents an audit log entry
 type AuditLog struct {
-	ID          string                 `json:"id"`
-	Timestamp   time.Time              `json:"timestamp"`
-	UserID      string                 `json:"user_id"`
-	Username    string                 `json:"username"`
-	Action      string                 `json:"action"`
-	Resource    string                 `json:"resource"`
-	ResourceID  string                 `json:"resource_id,omitempty"`
-	ClientIP    string                 `json:"client_ip"`
-	UserAgent   string                 `json:"user_agent"`
-	Success     bool                   `json:"success"`
-	Error       string                 `json:"error,omitempty"`
-	Details     map[string]interface{} `json:"details,omitempty"`
-	SessionID   string                 `json:"session_id,omitempty"`
+	ID         string                 `json:"id"`
+	Seq        uint64                 `json:"seq"`
+	Timestamp  time.Time              `json:"timestamp"`
+	UserID     string                 `json:"user_id"`
+	Username   string                 `json:"username"`
+	Action     string                 `json:"action"`
+	Resource   string                 `json:"resource"`
+	ResourceID string                 `json:"resource_id,omitempty"`
+	ClientIP   string                 `json:"client_ip"`
+	UserAgent  string                 `json:"user_agent"`
+	Success    bool                   `json:"success"`
+	Error      string                 `json:"error,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	SessionID  string                 `json:"session_id,omitempty"`
+	OrgID      string                 `json:"org_id,omitempty"`
+	PrevHash   string                 `json:"prev_hash,omitempty"`
+	Hash       string                 `json:"hash,omitempty"`
+	// HashAlg is hashAlgHMAC when Hash is keyed with the chain key, and empty
+	// for a plain SHA-256 written without one
+	HashAlg string `json:"hash_alg,omitempty"`
+	// MatchedFields lists the fields a search term was found in. It is only
+	// set on search results and never stored.
+	MatchedFields []string `json:"matched_fields,omitempty"`
+}
+
+// ChainVerification is the result of verifying the audit log hash chain
+type ChainVerification struct {
+	Valid          bool   `json:"valid"`
+	Checked        int    `json:"checked"`
+	Unchained      int    `json:"unchained"` // Entries written before hash chaining was enabled
+	Unkeyed        int    `json:"unkeyed"`   // Chained entries written before the chain key was configured
+	LastSeq        uint64 `json:"last_seq"`
+	FirstBrokenSeq uint64 `json:"first_broken_seq,omitempty"`
+	FirstBrokenID  string `json:"first_broken_id,omitempty"`
+	Reason         string `json:"reason,omitempty"`
 }
 
+// AllOrgs is the organization filter that matches audit logs from every organization
+const AllOrgs = "*"
+
+// SystemUser is recorded as the actor for events raised by background jobs
+const SystemUser = "system"
+
+// hashAlgHMAC marks entries hashed with HMAC-SHA256 under the chain key
+const hashAlgHMAC = "hmac-sha256"
+
+const (
+	// auditSeqKey stores the last sequence number assigned to an audit entry
+	auditSeqKey = "audit_seq"
+	// auditHeadKey stores the hash of the most recent audit entry
+	auditHeadKey = "audit_head"
+)
+
+const (
+	// maxPendingEvents bounds the in-memory queue of entries that failed to write
+	maxPendingEvents = 1000
+	// pendingRetryInterval is how often queued entries are retried when no new events arrive
+	pendingRetryInterval = 30 * time.Second
+)
+
 // AuditService handles audit logging
 type AuditService struct {
-	db *badger.DB
+	db      *badger.DB
+	mu      sync.Mutex // Serializes sequence number assignment and guards pending
+	pending []AuditLog // Entries whose write failed, oldest first, awaiting retry
+	dropped uint64     // Entries lost because pending was full
+
+	redactor *redactor      // Masks sensitive data before entries are stored; nil disables redaction
+	chainKey []byte         // HMAC key for entry hashes, kept out of the database; nil hashes with plain SHA-256
+	forward  func(AuditLog) // Called with each entry once it is stored; nil disables forwarding
 }
 
 // NewAuditService creates a new audit service
@@ -44,6 +106,7 @@ func (a *AuditService) LogEvent(c *gin.Context, action, resource, resourceID str
 	userID, _ := c.Get("user_id")
 	username, _ := c.Get("username")
 	sessionID, _ := c.Get("session_id")
+	orgID, _ := c.Get("org_id")
 
 	var errorMsg string
 	if err != nil {
@@ -64,19 +127,254 @@ func (a *AuditService) LogEvent(c *gin.Context, action, resource, resourceID str
 		Error:      errorMsg,
 		Details:    details,
 		SessionID:  GetStringValue(sessionID),
+		OrgID:      GetStringValue(orgID),
 	}
+	a.store(auditLog)
+}
+
+// LogSystemEvent logs an event raised by the server itself (e.g. a background
+// job) rather than by a request. orgID is the organization the event concerns.
+func (a *AuditService) LogSystemEvent(orgID, action, resource, resourceID string, success bool, err error, details map[string]interface{}) {
+	var errorMsg string
+	if err != nil {
+		errorMsg = err.Error()
+	}
+
+	a.store(AuditLog{
+		ID:         fmt.Sprintf("audit_%d", time.Now().UnixNano()),
+		Timestamp:  time.Now(),
+		UserID:     SystemUser,
+		Username:   SystemUser,
+		Action:     action,
+		Resource:   resource,
+		ResourceID: resourceID,
+		Success:    success,
+		Error:      errorMsg,
+		Details:    details,
+		OrgID:      orgID,
+	})
+}
+
+// store persists an audit entry. If the write fails the entry is queued in
+// memory (bounded by maxPendingEvents) and retried before the next write.
+func (a *AuditService) store(auditLog AuditLog) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Redact before queueing or hashing so sensitive data never reaches disk
+	auditLog = a.redactor.apply(auditLog)
+
+	// Earlier failures go first so entries stay in order
+	if !a.flushPendingLocked() {
+		a.queueLocked(auditLog, nil)
+		return
+	}
+	if err := a.write(auditLog); err != nil {
+		a.queueLocked(auditLog, err)
+	}
+}
+
+// queueLocked adds a failed entry to the retry queue, dropping the oldest
+// entry when full. Every failure is logged so that lost audit data is never silent.
+func (a *AuditService) queueLocked(auditLog AuditLog, err error) {
+	if len(a.pending) >= maxPendingEvents {
+		lost := a.pending[0]
+		a.pending = a.pending[1:]
+		a.dropped++
+		logger.Error("Audit retry queue full; dropping audit event", nil, logrus.Fields{
+			"audit_id":      lost.ID,
+			"action":        lost.Action,
+			"resource":      lost.Resource,
+			"user_id":       lost.UserID,
+			"dropped_total": a.dropped,
+		})
+	}
+	a.pending = append(a.pending, auditLog)
+	if err != nil {
+		logger.Error("Failed to write audit event; queued for retry", err, logrus.Fields{
+			"audit_id": auditLog.ID,
+			"action":   auditLog.Action,
+			"resource": auditLog.Resource,
+			"user_id":  auditLog.UserID,
+			"pending":  len(a.pending),
+		})
+	}
+}
+
+// flushPendingLocked writes queued entries in order, reporting whether the queue was emptied
+func (a *AuditService) flushPendingLocked() bool {
+	for len(a.pending) > 0 {
+		if err := a.write(a.pending[0]); err != nil {
+			logger.Warn("Audit database still unwritable; events remain queued", logrus.Fields{
+				"error":   err.Error(),
+				"pending": len(a.pending),
+			})
+			return false
+		}
+		a.pending = a.pending[1:]
+		if len(a.pending) == 0 {
+			logger.Info("Flushed queued audit events")
+		}
+	}
+	return true
+}
 
-	// Store in database
-	data, _ := json.Marshal(auditLog)
-	a.db.Update(func(txn *badger.Txn) error {
+// StartRetryJob periodically retries queued entries so they are written even
+// when no new events arrive
+func (a *AuditService) StartRetryJob() {
+	go func() {
+		ticker := time.NewTicker(pendingRetryInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			a.mu.Lock()
+			a.flushPendingLocked()
+			a.mu.Unlock()
+		}
+	}()
+}
+
+// SetForwarder registers fn to receive every entry after it is stored, e.g. to
+// send it to a SIEM. fn runs while entries are being written and must not block.
+func (a *AuditService) SetForwarder(fn func(AuditLog)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.forward = fn
+}
+
+// SetChainKey keys the hash of every entry written from now on with an
+// HMAC-SHA256 of key, so someone who can write to the database cannot
+// re-hash the chain after editing it. key must not be stored in the database;
+// an empty key keeps plain SHA-256 hashes.
+func (a *AuditService) SetChainKey(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if key == "" {
+		a.chainKey = nil
+		return
+	}
+	a.chainKey = []byte(key)
+}
+
+// QueueStats returns the number of entries awaiting retry and the number dropped
+func (a *AuditService) QueueStats() (pending int, dropped uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.pending), a.dropped
+}
+
+// write stores an entry in the database, assigning the next sequence number and
+// chaining to the previous entry's hash in the same transaction so that a gap
+// or modification is always detectable. The caller must hold a.mu.
+func (a *AuditService) write(auditLog AuditLog) error {
+	err := a.db.Update(func(txn *badger.Txn) error {
+		seq, err := nextSeq(txn)
+		if err != nil {
+			return err
+		}
+		auditLog.Seq = seq
+
+		prevHash, err := chainHead(txn)
+		if err != nil {
+			return err
+		}
+		auditLog.PrevHash = prevHash
+		if a.chainKey != nil {
+			auditLog.HashAlg = hashAlgHMAC
+		}
+		auditLog.Hash, err = computeHash(auditLog, a.chainKey)
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(auditLog)
+		if err != nil {
+			return err
+		}
 		key := fmt.Sprintf("audit:%s", auditLog.ID)
-		return txn.Set([]byte(key), data)
+		if err := txn.Set([]byte(key), data); err != nil {
+			return err
+		}
+		if err := txn.Set([]byte(auditHeadKey), []byte(auditLog.Hash)); err != nil {
+			return err
+		}
+		seqBytes := make([]byte, 8)
+		binary.BigEndian.PutUint64(seqBytes, seq)
+		return txn.Set([]byte(auditSeqKey), seqBytes)
+	})
+	if err == nil && a.forward != nil {
+		a.forward(auditLog)
+	}
+	return err
+}
+
+// chainHead returns the hash of the most recent audit entry ("" if none)
+func chainHead(txn *badger.Txn) (string, error) {
+	item, err := txn.Get([]byte(auditHeadKey))
+	if err == badger.ErrKeyNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	val, err := item.ValueCopy(nil)
+	return string(val), err
+}
+
+// computeHash hashes the canonical JSON form of an audit entry (excluding its own Hash).
+// The entry is round-tripped through JSON first so that details hash identically
+// when the stored entry is later decoded for verification. Entries marked with
+// hashAlgHMAC are keyed with key, so rewriting them takes more than database access.
+func computeHash(log AuditLog, key []byte) (string, error) {
+	log.Hash = ""
+	log.MatchedFields = nil
+	data, err := json.Marshal(log)
+	if err != nil {
+		return "", err
+	}
+	var canonical AuditLog
+	if err := json.Unmarshal(data, &canonical); err != nil {
+		return "", err
+	}
+	data, err = json.Marshal(canonical)
+	if err != nil {
+		return "", err
+	}
+	if log.HashAlg == hashAlgHMAC {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// nextSeq returns the sequence number following the last one stored
+func nextSeq(txn *badger.Txn) (uint64, error) {
+	item, err := txn.Get([]byte(auditSeqKey))
+	if err == badger.ErrKeyNotFound {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var last uint64
+	err = item.Value(func(val []byte) error {
+		if len(val) != 8 {
+			return fmt.Errorf("invalid audit sequence value")
+		}
+		last = binary.BigEndian.Uint64(val)
+		return nil
 	})
+	return last + 1, err
 }
 
-// GetAuditLogs retrieves audit logs with filtering
-func (a *AuditService) GetAuditLogs(userID, action, resource string, startTime, endTime time.Time, offset, limit int) ([]AuditLog, error) {
+// GetAuditLogs retrieves audit logs with filtering. actions and resources
+// match any of their values; an empty list matches everything. A nil success
+// matches both successful and failed entries. A non-empty search keeps only
+// entries containing it (see searchMatches) and records where it matched.
+func (a *AuditService) GetAuditLogs(orgID, userID string, actions, resources []string, success *bool, search string, startTime, endTime time.Time, offset, limit int) ([]AuditLog, error) {
 	var logs []AuditLog
+	search = strings.ToLower(search)
 
 	err := a.db.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
@@ -96,13 +394,19 @@ func (a *AuditService) GetAuditLogs(userID, action, resource string, startTime,
 				}
 
 				// Apply filters
+				if orgID != AllOrgs && log.OrgID != orgID {
+					return nil
+				}
 				if userID != "" && log.UserID != userID {
 					return nil
 				}
-				if action != "" && log.Action != action {
+				if !matchesAny(log.Action, actions) {
 					return nil
 				}
-				if resource != "" && log.Resource != resource {
+				if !matchesAny(log.Resource, resources) {
+					return nil
+				}
+				if success != nil && log.Success != *success {
 					return nil
 				}
 				if !startTime.IsZero() && log.Timestamp.Before(startTime) {
@@ -111,6 +415,12 @@ func (a *AuditService) GetAuditLogs(userID, action, resource string, startTime,
 				if !endTime.IsZero() && log.Timestamp.After(endTime) {
 					return nil
 				}
+				if search != "" {
+					log.MatchedFields = searchMatches(log, search)
+					if len(log.MatchedFields) == 0 {
+						return nil
+					}
+				}
 
 				if skipped < offset {
 					skipped++
@@ -142,8 +452,90 @@ func (a *AuditService) GetAuditLogs(userID, action, resource string, startTime,
 	return logs, err
 }
 
+// searchMatches returns the fields of log that contain term, which must be
+// lowercase. Action, resource, error, username and the JSON-serialized
+// details are searched, case-insensitively.
+func searchMatches(log AuditLog, term string) []string {
+	var matched []string
+	fields := []struct{ name, value string }{
+		{"action", log.Action},
+		{"resource", log.Resource},
+		{"error", log.Error},
+		{"username", log.Username},
+	}
+	for _, f := range fields {
+		if strings.Contains(strings.ToLower(f.value), term) {
+			matched = append(matched, f.name)
+		}
+	}
+	if len(log.Details) > 0 {
+		if details, err := json.Marshal(log.Details); err == nil && strings.Contains(strings.ToLower(string(details)), term) {
+			matched = append(matched, "details")
+		}
+	}
+	return matched
+}
+
+// matchesAny reports whether value is one of allowed, or allowed is empty
+func matchesAny(value string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
+// auditKeyForTime returns the key an entry logged at t would have. Entry IDs
+// embed the UnixNano timestamp, so audit keys sort chronologically.
+func auditKeyForTime(t time.Time) []byte {
+	return []byte(fmt.Sprintf("audit:audit_%d", t.UnixNano()))
+}
+
+// StreamAuditLogs calls fn for each entry in [startTime, endTime] in
+// chronological order. It seeks directly to the start of the window instead of
+// scanning all entries, and never holds more than one entry in memory.
+func (a *AuditService) StreamAuditLogs(orgID string, startTime, endTime time.Time, fn func(AuditLog) error) error {
+	return a.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = 100
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		prefix := []byte("audit:")
+		endKey := auditKeyForTime(endTime)
+		for it.Seek(auditKeyForTime(startTime)); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			if bytes.Compare(item.Key(), endKey) > 0 {
+				break
+			}
+
+			var log AuditLog
+			err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &log)
+			})
+			if err != nil {
+				return err
+			}
+			if orgID != AllOrgs && log.OrgID != orgID {
+				continue
+			}
+			if log.Timestamp.Before(startTime) || log.Timestamp.After(endTime) {
+				continue
+			}
+			if err := fn(log); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // GetAuditLogsByIncident retrieves audit logs for a specific incident/session
-func (a *AuditService) GetAuditLogsByIncident(sessionID string) ([]AuditLog, error) {
+func (a *AuditService) GetAuditLogsByIncident(orgID, sessionID string) ([]AuditLog, error) {
 	var logs []AuditLog
 
 	err := a.db.View(func(txn *badger.Txn) error {
@@ -161,7 +553,7 @@ func (a *AuditService) GetAuditLogsByIncident(sessionID string) ([]AuditLog, err
 					return err
 				}
 
-				if log.SessionID == sessionID {
+				if log.SessionID == sessionID && (orgID == AllOrgs || log.OrgID == orgID) {
 					logs = append(logs, log)
 				}
 				return nil
@@ -176,6 +568,137 @@ func (a *AuditService) GetAuditLogsByIncident(sessionID string) ([]AuditLog, err
 	return logs, err
 }
 
+// VerifyChain checks the audit log end-to-end: sequence numbers must be
+// contiguous, every entry must hash to its stored Hash, and every PrevHash must
+// match the preceding entry's Hash
+func (a *AuditService) VerifyChain() (*ChainVerification, error) {
+	var logs []AuditLog
+	var head string
+	var lastSeq uint64
+
+	err := a.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte("audit:")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			err := it.Item().Value(func(val []byte) error {
+				var log AuditLog
+				if err := json.Unmarshal(val, &log); err != nil {
+					return err
+				}
+				logs = append(logs, log)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		var err error
+		head, err = chainHead(txn)
+		if err != nil {
+			return err
+		}
+		seq, err := nextSeq(txn)
+		lastSeq = seq - 1
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return verifyEntries(logs, head, lastSeq, a.chainKey)
+}
+
+// verifyEntries checks stored entries against the chain head and the last
+// assigned sequence number. The first chained entry must start the chain (an
+// empty PrevHash, right after the last unchained entry), so deleting the
+// oldest entries is as detectable as deleting the newest. Once an entry is
+// keyed with the chain key, every later entry must be too.
+func verifyEntries(logs []AuditLog, head string, lastSeq uint64, key []byte) (*ChainVerification, error) {
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].Seq < logs[j].Seq
+	})
+
+	result := &ChainVerification{Valid: true, LastSeq: lastSeq}
+	broken := func(log AuditLog, reason string) (*ChainVerification, error) {
+		result.Valid = false
+		result.FirstBrokenSeq = log.Seq
+		result.FirstBrokenID = log.ID
+		result.Reason = reason
+		return result, nil
+	}
+
+	var prev *AuditLog
+	var lastUnchainedSeq uint64
+	keyed := false
+	for i := range logs {
+		log := logs[i]
+		if log.Hash == "" {
+			if prev != nil {
+				return broken(log, "unchained entry after chain start")
+			}
+			result.Unchained++
+			lastUnchainedSeq = log.Seq
+			continue
+		}
+		if prev != nil {
+			if log.Seq != prev.Seq+1 {
+				return broken(log, fmt.Sprintf("sequence gap after %d", prev.Seq))
+			}
+			if log.PrevHash != prev.Hash {
+				return broken(log, "previous hash mismatch")
+			}
+		} else if log.PrevHash != "" || log.Seq != lastUnchainedSeq+1 {
+			return broken(log, "chain does not start at this entry (entries missing at start)")
+		}
+		switch {
+		case log.HashAlg == hashAlgHMAC && key == nil:
+			return broken(log, "entry is keyed but no chain key is configured")
+		case log.HashAlg == hashAlgHMAC:
+			keyed = true
+		case log.HashAlg != "":
+			return broken(log, fmt.Sprintf("unknown hash algorithm %q", log.HashAlg))
+		case keyed:
+			return broken(log, "unkeyed entry after keyed chain start")
+		default:
+			result.Unkeyed++
+		}
+		hash, err := computeHash(log, key)
+		if err != nil {
+			return nil, err
+		}
+		if hash != log.Hash {
+			return broken(log, "hash mismatch")
+		}
+		result.Checked++
+		prev = &logs[i]
+	}
+
+	// Detect truncation of the most recent entries, or of all of them
+	if prev == nil {
+		if head != "" {
+			result.Valid = false
+			result.Reason = "chain head set but no chained entries (entries missing)"
+		}
+		return result, nil
+	}
+	if prev.Hash != head || prev.Seq != lastSeq {
+		return broken(*prev, "chain head mismatch (entries missing at end)")
+	}
+	return result, nil
+}
+
+// OrgScope returns the organization filter for audit queries made by the
+// current user: super-admins see every organization, admins only their own
+func OrgScope(c *gin.Context) string {
+	if c.GetBool("is_super_admin") {
+		return AllOrgs
+	}
+	return c.GetString("org_id")
+}
+
 // Helper function to safely convert interface{} to string
 func GetStringValue(value interface{}) string {
 	if value == nil {
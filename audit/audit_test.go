@@ -0,0 +1,285 @@
+package audit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testChainKey keys the hash chain in tests
+var testChainKey = []byte("0123456789abcdef0123456789abcdef")
+
+// buildChain returns n chained entries with sequence numbers starting at
+// firstSeq, and the resulting chain head
+func buildChain(t *testing.T, firstSeq uint64, n int) ([]AuditLog, string) {
+	t.Helper()
+	return extendChain(t, nil, "", firstSeq, n, nil)
+}
+
+// extendChain appends n entries to logs, chained from prevHash and keyed
+// with key if it is set, and returns them with the new chain head
+func extendChain(t *testing.T, logs []AuditLog, prevHash string, firstSeq uint64, n int, key []byte) ([]AuditLog, string) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		seq := firstSeq + uint64(i)
+		log := AuditLog{
+			ID:        fmt.Sprintf("audit_%d", seq),
+			Seq:       seq,
+			Timestamp: time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC),
+			UserID:    "alice",
+			Action:    "upload_file",
+			Resource:  "file",
+			Success:   true,
+			Details:   map[string]interface{}{"size": 42, "filename": "a.txt"},
+			PrevHash:  prevHash,
+		}
+		if key != nil {
+			log.HashAlg = hashAlgHMAC
+		}
+		hash, err := computeHash(log, key)
+		if err != nil {
+			t.Fatalf("computeHash: %v", err)
+		}
+		log.Hash = hash
+		prevHash = hash
+		logs = append(logs, log)
+	}
+	return logs, prevHash
+}
+
+func TestComputeHash(t *testing.T) {
+	base := AuditLog{
+		ID:        "audit_1",
+		Seq:       1,
+		Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Action:    "login",
+		Details:   map[string]interface{}{"attempts": 1},
+	}
+	baseHash, err := computeHash(base, nil)
+	if err != nil {
+		t.Fatalf("computeHash: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(log *AuditLog)
+		same   bool
+	}{
+		{"unchanged", func(log *AuditLog) {}, true},
+		{"own hash ignored", func(log *AuditLog) { log.Hash = "abc" }, true},
+		{"matched fields ignored", func(log *AuditLog) { log.MatchedFields = []string{"action"} }, true},
+		{"decoded numbers hash alike", func(log *AuditLog) { log.Details = map[string]interface{}{"attempts": float64(1)} }, true},
+		{"action changed", func(log *AuditLog) { log.Action = "logout" }, false},
+		{"detail changed", func(log *AuditLog) { log.Details = map[string]interface{}{"attempts": 2} }, false},
+		{"previous hash changed", func(log *AuditLog) { log.PrevHash = "abc" }, false},
+		{"keyed", func(log *AuditLog) { log.HashAlg = hashAlgHMAC }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := base
+			tt.modify(&log)
+			hash, err := computeHash(log, testChainKey)
+			if err != nil {
+				t.Fatalf("computeHash: %v", err)
+			}
+			if (hash == baseHash) != tt.same {
+				t.Errorf("hash equal = %v, want %v", hash == baseHash, tt.same)
+			}
+		})
+	}
+}
+
+func TestVerifyEntries(t *testing.T) {
+	tests := []struct {
+		name      string
+		build     func(t *testing.T) ([]AuditLog, string, uint64)
+		valid     bool
+		brokenSeq uint64
+		reason    string
+		checked   int
+		unchained int
+		unkeyed   int
+		key       []byte // Chain key configured when verifying
+	}{
+		{
+			name:  "empty log",
+			build: func(t *testing.T) ([]AuditLog, string, uint64) { return nil, "", 0 },
+			valid: true,
+		},
+		{
+			name: "intact chain",
+			build: func(t *testing.T) ([]AuditLog, string, uint64) {
+				logs, head := buildChain(t, 1, 3)
+				return logs, head, 3
+			},
+			valid:   true,
+			checked: 3,
+			unkeyed: 3,
+		},
+		{
+			name: "unchained entries before the chain",
+			build: func(t *testing.T) ([]AuditLog, string, uint64) {
+				logs, head := buildChain(t, 3, 2)
+				old := []AuditLog{{ID: "audit_1", Seq: 1}, {ID: "audit_2", Seq: 2}}
+				return append(old, logs...), head, 4
+			},
+			valid:     true,
+			checked:   2,
+			unchained: 2,
+			unkeyed:   2,
+		},
+		{
+			name: "entries out of order",
+			build: func(t *testing.T) ([]AuditLog, string, uint64) {
+				logs, head := buildChain(t, 1, 3)
+				logs[0], logs[2] = logs[2], logs[0]
+				return logs, head, 3
+			},
+			valid:   true,
+			checked: 3,
+			unkeyed: 3,
+		},
+		{
+			name: "all entries deleted",
+			build: func(t *testing.T) ([]AuditLog, string, uint64) {
+				_, head := buildChain(t, 1, 3)
+				return nil, head, 3
+			},
+			reason: "chain head set but no chained entries (entries missing)",
+		},
+		{
+			name: "oldest entry deleted",
+			build: func(t *testing.T) ([]AuditLog, string, uint64) {
+				logs, head := buildChain(t, 1, 3)
+				return logs[1:], head, 3
+			},
+			brokenSeq: 2,
+			reason:    "chain does not start at this entry (entries missing at start)",
+		},
+		{
+			name: "middle entry deleted",
+			build: func(t *testing.T) ([]AuditLog, string, uint64) {
+				logs, head := buildChain(t, 1, 3)
+				return []AuditLog{logs[0], logs[2]}, head, 3
+			},
+			brokenSeq: 3,
+			reason:    "sequence gap after 1",
+		},
+		{
+			name: "newest entry deleted",
+			build: func(t *testing.T) ([]AuditLog, string, uint64) {
+				logs, head := buildChain(t, 1, 3)
+				return logs[:2], head, 3
+			},
+			brokenSeq: 2,
+			reason:    "chain head mismatch (entries missing at end)",
+		},
+		{
+			name: "entry modified",
+			build: func(t *testing.T) ([]AuditLog, string, uint64) {
+				logs, head := buildChain(t, 1, 3)
+				logs[1].Success = false
+				return logs, head, 3
+			},
+			brokenSeq: 2,
+			reason:    "hash mismatch",
+		},
+		{
+			name: "entry relinked",
+			build: func(t *testing.T) ([]AuditLog, string, uint64) {
+				logs, head := buildChain(t, 1, 3)
+				logs[2].PrevHash = logs[0].Hash
+				return logs, head, 3
+			},
+			brokenSeq: 3,
+			reason:    "previous hash mismatch",
+		},
+		{
+			name: "unchained entry after the chain start",
+			build: func(t *testing.T) ([]AuditLog, string, uint64) {
+				logs, head := buildChain(t, 1, 2)
+				return append(logs, AuditLog{ID: "audit_3", Seq: 3}), head, 3
+			},
+			brokenSeq: 3,
+			reason:    "unchained entry after chain start",
+		},
+		{
+			name: "keyed chain",
+			build: func(t *testing.T) ([]AuditLog, string, uint64) {
+				logs, head := extendChain(t, nil, "", 1, 3, testChainKey)
+				return logs, head, 3
+			},
+			key:     testChainKey,
+			valid:   true,
+			checked: 3,
+		},
+		{
+			name: "unkeyed entries before the key was set",
+			build: func(t *testing.T) ([]AuditLog, string, uint64) {
+				logs, head := buildChain(t, 1, 2)
+				logs, head = extendChain(t, logs, head, 3, 2, testChainKey)
+				return logs, head, 4
+			},
+			key:     testChainKey,
+			valid:   true,
+			checked: 4,
+			unkeyed: 2,
+		},
+		{
+			name: "keyed entry re-hashed without the key",
+			build: func(t *testing.T) ([]AuditLog, string, uint64) {
+				logs, _ := extendChain(t, nil, "", 1, 3, testChainKey)
+				logs[2].Success = false
+				logs[2].HashAlg = ""
+				logs[2].Hash, _ = computeHash(logs[2], nil)
+				return logs, logs[2].Hash, 3
+			},
+			key:       testChainKey,
+			brokenSeq: 3,
+			reason:    "unkeyed entry after keyed chain start",
+		},
+		{
+			name: "keyed entry re-hashed with another key",
+			build: func(t *testing.T) ([]AuditLog, string, uint64) {
+				logs, _ := extendChain(t, nil, "", 1, 3, testChainKey)
+				logs[2].Success = false
+				logs[2].Hash, _ = computeHash(logs[2], []byte("attacker-key"))
+				return logs, logs[2].Hash, 3
+			},
+			key:       testChainKey,
+			brokenSeq: 3,
+			reason:    "hash mismatch",
+		},
+		{
+			name: "keyed entries without a configured key",
+			build: func(t *testing.T) ([]AuditLog, string, uint64) {
+				logs, head := extendChain(t, nil, "", 1, 2, testChainKey)
+				return logs, head, 2
+			},
+			brokenSeq: 1,
+			reason:    "entry is keyed but no chain key is configured",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs, head, lastSeq := tt.build(t)
+			result, err := verifyEntries(logs, head, lastSeq, tt.key)
+			if err != nil {
+				t.Fatalf("verifyEntries: %v", err)
+			}
+			if result.Valid != tt.valid {
+				t.Errorf("Valid = %v, want %v (reason %q)", result.Valid, tt.valid, result.Reason)
+			}
+			if result.FirstBrokenSeq != tt.brokenSeq {
+				t.Errorf("FirstBrokenSeq = %d, want %d", result.FirstBrokenSeq, tt.brokenSeq)
+			}
+			if result.Reason != tt.reason {
+				t.Errorf("Reason = %q, want %q", result.Reason, tt.reason)
+			}
+			if tt.valid && (result.Checked != tt.checked || result.Unchained != tt.unchained || result.Unkeyed != tt.unkeyed) {
+				t.Errorf("Checked, Unchained, Unkeyed = %d, %d, %d, want %d, %d, %d",
+					result.Checked, result.Unchained, result.Unkeyed, tt.checked, tt.unchained, tt.unkeyed)
+			}
+		})
+	}
+}
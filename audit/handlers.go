@@ -1,23 +1,32 @@
 package audit
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
-	"fmt"
 
 	"github.com/gin-gonic/gin"
+
+	"s3mgr/response"
 )
 
 // AuditFilterRequest represents the request for filtering audit logs
 type AuditFilterRequest struct {
-	UserID    string `json:"user_id,omitempty"`
-	Action    string `json:"action,omitempty"`
-	Resource  string `json:"resource,omitempty"`
-	StartTime string `json:"start_time,omitempty"` // RFC3339 format
-	EndTime   string `json:"end_time,omitempty"`   // RFC3339 format
-	Limit     int    `json:"limit,omitempty"`
-	Page      int    `json:"page,omitempty"`
+	UserID    string   `json:"user_id,omitempty"`
+	Action    string   `json:"action,omitempty"`
+	Actions   []string `json:"actions,omitempty"` // Match any of these actions (combined with action)
+	Resource  string   `json:"resource,omitempty"`
+	Resources []string `json:"resources,omitempty"`  // Match any of these resources (combined with resource)
+	StartTime string   `json:"start_time,omitempty"` // RFC3339 format
+	EndTime   string   `json:"end_time,omitempty"`   // RFC3339 format
+	Limit     int      `json:"limit,omitempty"`
+	Page      int      `json:"page,omitempty"`
+	Success   *bool    `json:"success,omitempty"` // Only successful (true) or failed (false) entries
+	// Search is a case-insensitive substring matched against action, resource,
+	// error, username and details; each result lists its matched_fields
+	Search string `json:"search,omitempty"`
 }
 
 // GetAuditLogsHandler handles GET /api/admin/audit-logs
@@ -30,26 +39,28 @@ func (a *AuditService) ExportAuditLogsHandler(c *gin.Context) {
 		return
 	}
 	format := c.DefaultQuery("format", "csv")
-	logs, err := a.GetAuditLogs("", "", "", time.Time{}, time.Time{}, 0, 0)
+	logs, err := a.GetAuditLogs(OrgScope(c), "", nil, nil, nil, "", time.Time{}, time.Time{}, 0, 0)
 	if err != nil {
 		a.LogEvent(c, "export_audit_logs", "audit_logs", "", false, err, map[string]interface{}{"format": format})
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit logs"})
 		return
 	}
 	if format == "json" {
-		a.LogEvent(c, "export_audit_logs", "audit_logs", "", true, nil, map[string]interface{}{"format": format, "count": len(logs)})
 		c.Header("Content-Disposition", "attachment; filename=audit_logs.json")
 		c.JSON(http.StatusOK, logs)
+		a.LogEvent(c, "export_audit_logs", "audit_logs", "", true, nil, map[string]interface{}{"format": format, "count": len(logs), "bytes": c.Writer.Size()})
 		return
 	}
 	// Default: CSV
-	a.LogEvent(c, "export_audit_logs", "audit_logs", "", true, nil, map[string]interface{}{"format": format, "count": len(logs)})
 	c.Header("Content-Disposition", "attachment; filename=audit_logs.csv")
 	c.Header("Content-Type", "text/csv")
-	w := c.Writer
-	w.Write([]byte("id,timestamp,user_id,username,action,resource,resource_id,client_ip,user_agent,success,error,session_id\n"))
+	// encoding/csv quotes fields containing commas, quotes or newlines, and
+	// the response writer escapes values a spreadsheet would run as formulas
+	w := response.NewCSVWriter(c.Writer)
+	w.Write([]string{"seq", "id", "timestamp", "user_id", "username", "action", "resource", "resource_id", "client_ip", "user_agent", "success", "error", "session_id"})
 	for _, log := range logs {
-		w.Write([]byte(fmt.Sprintf("%s,%s,%s,%s,%s,%s,%s,%s,%s,%t,%s,%s\n",
+		w.Write([]string{
+			strconv.FormatUint(log.Seq, 10),
 			log.ID,
 			log.Timestamp.Format(time.RFC3339Nano),
 			log.UserID,
@@ -59,11 +70,13 @@ func (a *AuditService) ExportAuditLogsHandler(c *gin.Context) {
 			log.ResourceID,
 			log.ClientIP,
 			log.UserAgent,
-			log.Success,
+			strconv.FormatBool(log.Success),
 			log.Error,
 			log.SessionID,
-		)))
+		})
 	}
+	w.Flush()
+	a.LogEvent(c, "export_audit_logs", "audit_logs", "", w.Error() == nil, w.Error(), map[string]interface{}{"format": format, "count": len(logs), "bytes": c.Writer.Size()})
 }
 
 func (a *AuditService) GetAuditLogsHandler(c *gin.Context) {
@@ -81,8 +94,9 @@ func (a *AuditService) GetAuditLogsHandler(c *gin.Context) {
 
 	// Parse query parameters
 	userID := c.Query("user_id")
-	action := c.Query("action")
-	resource := c.Query("resource")
+	// action and resource may be repeated or comma-separated to match any value
+	actions := filterValues(c.QueryArray("action"))
+	resources := filterValues(c.QueryArray("resource"))
 	startTimeStr := c.Query("start_time")
 	endTimeStr := c.Query("end_time")
 	limitStr := c.Query("limit")
@@ -90,6 +104,18 @@ func (a *AuditService) GetAuditLogsHandler(c *gin.Context) {
 		limitStr = ps // page_size overrides limit if present
 	}
 	pageStr := c.Query("page")
+	// q searches action, resource, error, username and details (see searchMatches)
+	search := strings.TrimSpace(c.Query("q"))
+
+	var success *bool
+	if s := c.Query("success"); s != "" {
+		parsed, err := strconv.ParseBool(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "success must be true or false"})
+			return
+		}
+		success = &parsed
+	}
 
 	var startTime, endTime time.Time
 	var err error
@@ -128,8 +154,10 @@ func (a *AuditService) GetAuditLogsHandler(c *gin.Context) {
 	a.LogEvent(c, "query_audit_logs", "audit_logs", "", true, nil, map[string]interface{}{
 		"filters": map[string]interface{}{
 			"user_id":    userID,
-			"action":     action,
-			"resource":   resource,
+			"action":     actions,
+			"resource":   resources,
+			"success":    success,
+			"q":          search,
 			"start_time": startTimeStr,
 			"end_time":   endTimeStr,
 			"limit":      limit,
@@ -138,7 +166,7 @@ func (a *AuditService) GetAuditLogsHandler(c *gin.Context) {
 	})
 
 	// Get total count for pagination
-	allLogs, err := a.GetAuditLogs(userID, action, resource, startTime, endTime, 0, 0)
+	allLogs, err := a.GetAuditLogs(OrgScope(c), userID, actions, resources, success, search, startTime, endTime, 0, 0)
 	if err != nil {
 		a.LogEvent(c, "query_audit_logs", "audit_logs", "", false, err, nil)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit logs"})
@@ -146,21 +174,20 @@ func (a *AuditService) GetAuditLogsHandler(c *gin.Context) {
 	}
 	total := len(allLogs)
 
-	logs, err := a.GetAuditLogs(userID, action, resource, startTime, endTime, offset, limit)
+	logs, err := a.GetAuditLogs(OrgScope(c), userID, actions, resources, success, search, startTime, endTime, offset, limit)
 	if err != nil {
 		a.LogEvent(c, "query_audit_logs", "audit_logs", "", false, err, nil)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit logs"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"audit_logs": logs,
-		"total":      total,
-		"count":      len(logs),
+	response.List(c, "audit_logs", logs, response.Pagination{Page: page, PageSize: limit, Total: total}, gin.H{
 		"filters": map[string]interface{}{
 			"user_id":    userID,
-			"action":     action,
-			"resource":   resource,
+			"action":     actions,
+			"resource":   resources,
+			"success":    success,
+			"q":          search,
 			"start_time": startTimeStr,
 			"end_time":   endTimeStr,
 			"limit":      limit,
@@ -169,6 +196,155 @@ func (a *AuditService) GetAuditLogsHandler(c *gin.Context) {
 	})
 }
 
+// defaultFailuresWindow is how far back GetAuditFailuresHandler looks by default
+const defaultFailuresWindow = time.Hour
+
+// GetAuditFailuresHandler handles GET /api/admin/audit-logs/failures. It returns
+// failed operations across all users, newest first, within the last "since"
+// (a Go duration, default 1h) or between start_time and end_time.
+func (a *AuditService) GetAuditFailuresHandler(c *gin.Context) {
+	endTime := time.Now()
+	startTime := endTime.Add(-defaultFailuresWindow)
+	if since := c.Query("since"); since != "" {
+		window, err := time.ParseDuration(since)
+		if err != nil || window <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since. Use a positive duration like 1h or 30m"})
+			return
+		}
+		startTime = endTime.Add(-window)
+	}
+	if s := c.Query("start_time"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_time format. Use RFC3339 format"})
+			return
+		}
+		startTime = t
+	}
+	if s := c.Query("end_time"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_time format. Use RFC3339 format"})
+			return
+		}
+		endTime = t
+	}
+
+	page := 1
+	if p, err := strconv.Atoi(c.Query("page")); err == nil && p > 0 {
+		page = p
+	}
+	pageSize := 50
+	if ps, err := strconv.Atoi(c.Query("page_size")); err == nil && ps > 0 && ps <= 500 {
+		pageSize = ps
+	}
+
+	// Fetch the whole window so pages are cut from the newest-first order
+	failed := false
+	logs, err := a.GetAuditLogs(OrgScope(c), c.Query("user_id"), nil, nil, &failed, "", startTime, endTime, 0, 0)
+	if err != nil {
+		a.LogEvent(c, "query_audit_failures", "audit_logs", "", false, err, nil)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit logs"})
+		return
+	}
+
+	filters := map[string]interface{}{
+		"user_id":    c.Query("user_id"),
+		"start_time": startTime.UTC().Format(time.RFC3339),
+		"end_time":   endTime.UTC().Format(time.RFC3339),
+	}
+	a.LogEvent(c, "query_audit_failures", "audit_logs", "", true, nil, map[string]interface{}{
+		"filters": filters,
+		"total":   len(logs),
+	})
+
+	start, end := response.Bounds(len(logs), page, pageSize)
+	response.List(c, "audit_logs", logs[start:end], response.Pagination{Page: page, PageSize: pageSize, Total: len(logs)}, gin.H{
+		"filters": filters,
+	})
+}
+
+// StreamAuditLogsHandler handles GET /api/admin/audit-logs/stream. It writes
+// the entries between start_time and end_time as NDJSON, flushing as it goes,
+// so very large incident windows can be exported without buffering them.
+func (a *AuditService) StreamAuditLogsHandler(c *gin.Context) {
+	startTimeStr := c.Query("start_time")
+	endTimeStr := c.Query("end_time")
+	if startTimeStr == "" || endTimeStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_time and end_time are required"})
+		return
+	}
+	startTime, err := time.Parse(time.RFC3339, startTimeStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_time format. Use RFC3339 format"})
+		return
+	}
+	endTime, err := time.Parse(time.RFC3339, endTimeStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_time format. Use RFC3339 format"})
+		return
+	}
+	if endTime.Before(startTime) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_time must not be before start_time"})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=audit_logs.ndjson")
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+
+	const flushEvery = 500
+	enc := json.NewEncoder(c.Writer)
+	count := 0
+	err = a.StreamAuditLogs(OrgScope(c), startTime, endTime, func(log AuditLog) error {
+		if err := enc.Encode(log); err != nil {
+			return err
+		}
+		count++
+		if count%flushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	c.Writer.Flush()
+
+	// Headers are already sent, so a failure can only be recorded, not reported
+	a.LogEvent(c, "stream_audit_logs", "audit_logs", "", err == nil, err, map[string]interface{}{
+		"start_time": startTimeStr,
+		"end_time":   endTimeStr,
+		"count":      count,
+	})
+}
+
+// VerifyAuditChainHandler handles GET /api/admin/audit-logs/verify
+func (a *AuditService) VerifyAuditChainHandler(c *gin.Context) {
+	result, err := a.VerifyChain()
+	if err != nil {
+		a.LogEvent(c, "verify_audit_chain", "audit_logs", "", false, err, nil)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify audit log chain"})
+		return
+	}
+
+	a.LogEvent(c, "verify_audit_chain", "audit_logs", "", true, nil, map[string]interface{}{
+		"valid":   result.Valid,
+		"checked": result.Checked,
+	})
+	c.JSON(http.StatusOK, result)
+}
+
+// filterValues splits comma-separated filter values and drops empty ones
+func filterValues(raw []string) []string {
+	var values []string
+	for _, r := range raw {
+		for _, v := range strings.Split(r, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
 // GetAuditLogsByIncidentHandler handles GET /api/admin/audit-logs/incident/:session_id
 func (a *AuditService) GetAuditLogsByIncidentHandler(c *gin.Context) {
 	// Check if current user is admin
@@ -190,18 +366,14 @@ func (a *AuditService) GetAuditLogsByIncidentHandler(c *gin.Context) {
 		"session_id": sessionID,
 	})
 
-	logs, err := a.GetAuditLogsByIncident(sessionID)
+	logs, err := a.GetAuditLogsByIncident(OrgScope(c), sessionID)
 	if err != nil {
 		a.LogEvent(c, "query_audit_logs_by_incident", "audit_logs", sessionID, false, err, nil)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit logs"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"audit_logs": logs,
-		"count":      len(logs),
-		"session_id": sessionID,
-	})
+	response.List(c, "audit_logs", logs, response.All(len(logs)), gin.H{"session_id": sessionID})
 }
 
 // PostAuditLogsFilterHandler handles POST /api/admin/audit-logs/filter for complex filtering
@@ -248,20 +420,31 @@ func (a *AuditService) PostAuditLogsFilterHandler(c *gin.Context) {
 		"filters": filterRequest,
 	})
 
-	offset := 0
-	if filterRequest.Limit > 0 && filterRequest.Page > 1 {
-		offset = (filterRequest.Page - 1) * filterRequest.Limit
+	if filterRequest.Page < 1 {
+		filterRequest.Page = 1
 	}
-	logs, err := a.GetAuditLogs(filterRequest.UserID, filterRequest.Action, filterRequest.Resource, startTime, endTime, offset, filterRequest.Limit)
+	offset := (filterRequest.Page - 1) * filterRequest.Limit
+
+	// The single and list forms of each filter are combined
+	actions := filterValues(append([]string{filterRequest.Action}, filterRequest.Actions...))
+	resources := filterValues(append([]string{filterRequest.Resource}, filterRequest.Resources...))
+
+	// Get total count for pagination
+	allLogs, err := a.GetAuditLogs(OrgScope(c), filterRequest.UserID, actions, resources, filterRequest.Success, strings.TrimSpace(filterRequest.Search), startTime, endTime, 0, 0)
 	if err != nil {
 		a.LogEvent(c, "filter_audit_logs", "audit_logs", "", false, err, nil)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit logs"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"audit_logs": logs,
-		"count":      len(logs),
-		"filters":    filterRequest,
+	logs, err := a.GetAuditLogs(OrgScope(c), filterRequest.UserID, actions, resources, filterRequest.Success, strings.TrimSpace(filterRequest.Search), startTime, endTime, offset, filterRequest.Limit)
+	if err != nil {
+		a.LogEvent(c, "filter_audit_logs", "audit_logs", "", false, err, nil)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit logs"})
+		return
+	}
+
+	response.List(c, "audit_logs", logs, response.Pagination{Page: filterRequest.Page, PageSize: filterRequest.Limit, Total: len(allLogs)}, gin.H{
+		"filters": filterRequest,
 	})
 }
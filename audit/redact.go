@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// redactedValue replaces sensitive data in stored audit entries
+const redactedValue = "[REDACTED]"
+
+// redactor masks sensitive data in audit entries before they are persisted
+type redactor struct {
+	fields   map[string]bool // Lower-cased detail keys whose values are masked entirely
+	patterns []*regexp.Regexp
+}
+
+// SetRedactionRules configures the detail keys (matched case-insensitively at
+// any depth) and regular expressions that are masked in every audit entry
+// written from now on. Entries already stored are not rewritten.
+func (a *AuditService) SetRedactionRules(fields, patterns []string) error {
+	r := &redactor{fields: make(map[string]bool)}
+	for _, field := range fields {
+		if field = strings.TrimSpace(field); field != "" {
+			r.fields[strings.ToLower(field)] = true
+		}
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid audit redaction pattern %q: %v", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	if len(r.fields) == 0 && len(r.patterns) == 0 {
+		r = nil
+	}
+
+	a.mu.Lock()
+	a.redactor = r
+	a.mu.Unlock()
+	return nil
+}
+
+// apply returns auditLog with sensitive data masked. Details are copied rather
+// than modified, since callers may reuse the map they passed in.
+func (r *redactor) apply(auditLog AuditLog) AuditLog {
+	if r == nil {
+		return auditLog
+	}
+	auditLog.ResourceID = r.redactString(auditLog.ResourceID)
+	auditLog.Error = r.redactString(auditLog.Error)
+	if auditLog.Details != nil {
+		auditLog.Details = r.redactMap(auditLog.Details)
+	}
+	return auditLog
+}
+
+func (r *redactor) redactString(s string) string {
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, redactedValue)
+	}
+	return s
+}
+
+func (r *redactor) redactMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if r.fields[strings.ToLower(k)] {
+			out[k] = redactedValue
+			continue
+		}
+		out[k] = r.redactValue(v)
+	}
+	return out
+}
+
+func (r *redactor) redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		return r.redactString(val)
+	case error:
+		return r.redactString(val.Error())
+	case map[string]interface{}:
+		return r.redactMap(val)
+	case map[string]string:
+		m := make(map[string]interface{}, len(val))
+		for k, s := range val {
+			m[k] = s
+		}
+		return r.redactMap(m)
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = r.redactValue(item)
+		}
+		return out
+	case []string:
+		out := make([]string, len(val))
+		for i, item := range val {
+			out[i] = r.redactString(item)
+		}
+		return out
+	case fmt.Stringer:
+		return r.redactString(val.String())
+	default:
+		return v
+	}
+}
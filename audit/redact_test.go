@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestRedactorApply(t *testing.T) {
+	r := &redactor{
+		fields:   map[string]bool{"password": true, "token": true},
+		patterns: []*regexp.Regexp{regexp.MustCompile(`AKIA[0-9A-Z]{4}`)},
+	}
+
+	tests := []struct {
+		name string
+		in   AuditLog
+		want AuditLog
+	}{
+		{
+			name: "nothing sensitive",
+			in:   AuditLog{ResourceID: "report.pdf", Details: map[string]interface{}{"size": 10}},
+			want: AuditLog{ResourceID: "report.pdf", Details: map[string]interface{}{"size": 10}},
+		},
+		{
+			name: "field names match case-insensitively",
+			in:   AuditLog{Details: map[string]interface{}{"Password": "hunter22", "user": "bob"}},
+			want: AuditLog{Details: map[string]interface{}{"Password": redactedValue, "user": "bob"}},
+		},
+		{
+			name: "nested fields",
+			in: AuditLog{Details: map[string]interface{}{
+				"request": map[string]interface{}{"token": "abc", "id": 1},
+				"headers": map[string]string{"token": "abc"},
+			}},
+			want: AuditLog{Details: map[string]interface{}{
+				"request": map[string]interface{}{"token": redactedValue, "id": 1},
+				"headers": map[string]interface{}{"token": redactedValue},
+			}},
+		},
+		{
+			name: "patterns in strings, lists and errors",
+			in: AuditLog{
+				ResourceID: "key AKIA1234",
+				Error:      "denied for AKIA1234",
+				Details: map[string]interface{}{
+					"keys":  []string{"AKIA1234", "other"},
+					"items": []interface{}{"AKIA1234", 5},
+					"err":   errors.New("bad AKIA1234"),
+				},
+			},
+			want: AuditLog{
+				ResourceID: "key " + redactedValue,
+				Error:      "denied for " + redactedValue,
+				Details: map[string]interface{}{
+					"keys":  []string{redactedValue, "other"},
+					"items": []interface{}{redactedValue, 5},
+					"err":   "bad " + redactedValue,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.apply(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("apply() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactorApplyKeepsCallerDetails(t *testing.T) {
+	r := &redactor{fields: map[string]bool{"password": true}}
+	details := map[string]interface{}{"password": "hunter22"}
+	r.apply(AuditLog{Details: details})
+	if details["password"] != "hunter22" {
+		t.Errorf("caller's details were modified: %v", details)
+	}
+}
+
+func TestNilRedactor(t *testing.T) {
+	var r *redactor
+	in := AuditLog{Details: map[string]interface{}{"password": "hunter22"}}
+	if got := r.apply(in); !reflect.DeepEqual(got, in) {
+		t.Errorf("apply() = %#v, want it unchanged", got)
+	}
+}
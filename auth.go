@@ -5,29 +5,26 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/dgraph-io/badger/v4"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 
 	"s3mgr/audit"
+	"s3mgr/config"
+	"s3mgr/logger"
 	"s3mgr/middleware"
+	"s3mgr/response"
+	"s3mgr/session"
+	"s3mgr/users"
 )
 
-type User struct {
-	ID        string    `json:"id"`
-	Username  string    `json:"username"`
-	Password  string    `json:"password,omitempty"` // Omit from JSON responses
-	Email     string    `json:"email,omitempty"`
-	IsAdmin   bool      `json:"is_admin"`
-	IsActive  bool      `json:"is_active"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	LastLogin time.Time `json:"last_login,omitempty"`
-}
+// User is the stored user record, shared with the create-admin tool
+type User = users.User
 
 type UserResponse struct {
 	ID        string    `json:"id"`
@@ -38,86 +35,463 @@ type UserResponse struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	LastLogin time.Time `json:"last_login,omitempty"`
+	// OrgID is the organization the user belongs to ("" is the default organization)
+	OrgID              string `json:"org_id,omitempty"`
+	IsSuperAdmin       bool   `json:"is_super_admin,omitempty"`
+	MustChangePassword bool   `json:"must_change_password,omitempty"`
+	QuotaBytes         int64  `json:"quota_bytes,omitempty"` // 0 = unlimited
 }
 
 type CreateUserRequest struct {
 	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required,min=8"`
+	Password string `json:"password" binding:"required"`
 	Email    string `json:"email"`
 	IsAdmin  bool   `json:"is_admin"`
 }
 
 type UpdateUserRequest struct {
-	Email    string `json:"email"`
+	Email    string  `json:"email"`
+	IsAdmin  bool    `json:"is_admin"`
+	IsActive bool    `json:"is_active"`
+	OrgID    *string `json:"org_id,omitempty"` // Only honored for super-admins
+}
+
+type BulkUpdateUserEntry struct {
+	Username string `json:"username" binding:"required"`
 	IsAdmin  bool   `json:"is_admin"`
 	IsActive bool   `json:"is_active"`
 }
 
+type BulkUpdateUsersRequest struct {
+	Users []BulkUpdateUserEntry `json:"users" binding:"required,dive"`
+}
+
+type BulkUpdateUserResult struct {
+	Username string `json:"username"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+}
+
+type ResetPasswordRequest struct {
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type SetQuotaRequest struct {
+	QuotaBytes *int64 `json:"quota_bytes" binding:"required"` // 0 removes the quota
+}
+
 type ChangePasswordRequest struct {
 	CurrentPassword string `json:"current_password" binding:"required"`
-	NewPassword     string `json:"new_password" binding:"required,min=8"`
+	NewPassword     string `json:"new_password" binding:"required"`
 }
 
 type Claims struct {
-	Username string `json:"username"`
-	IsAdmin  bool   `json:"is_admin"`
+	Username     string `json:"username"`
+	IsAdmin      bool   `json:"is_admin"`
+	OrgID        string `json:"org_id,omitempty"`
+	IsSuperAdmin bool   `json:"is_super_admin,omitempty"`
+	// Scope restricts what the token may be used for ("" is a full session token)
+	Scope string `json:"scope,omitempty"`
+	// SessionID identifies the login session, shared by its access and refresh tokens
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// tokenScopePasswordChange marks a challenge token that may only be used to change the password
+const tokenScopePasswordChange = "password_change"
+
 type AuthService struct {
 	db           *badger.DB
 	jwtSecret    []byte
 	auditService *audit.AuditService
+	orgService   *OrgService
+	sessions     session.Store
+	cfg          *config.Config
 }
 
-// Logout handler
+// Logout handler. Revokes the current session so its refresh token can no
+// longer be used and its access tokens are rejected.
 func (a *AuthService) Logout(c *gin.Context) {
 	username := c.GetString("username")
 	if username == "" {
 		// Try to extract from JWT or fallback to user_id
 		username = c.GetString("user_id")
 	}
-	// audit log removed(c, "logout", "user", username, true, nil, nil)
+	if err := a.revokeSession(c.GetString("session_id")); err != nil {
+		middleware.LogAuthEvent(c, "logout", username, false, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	middleware.LogAuthEvent(c, "logout", username, true, nil)
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
-func NewAuthService(db *badger.DB, auditService *audit.AuditService) *AuthService {
+func NewAuthService(db *badger.DB, auditService *audit.AuditService, orgService *OrgService, sessions session.Store, cfg *config.Config) *AuthService {
 	return &AuthService{
 		db:           db,
-		jwtSecret:    []byte("your-secret-key"), // In production, use environment variable
+		jwtSecret:    []byte(cfg.JWT.Secret),
 		auditService: auditService,
+		orgService:   orgService,
+		sessions:     sessions,
+		cfg:          cfg,
+	}
+}
+
+// validatePassword checks password against the configured policy, returning
+// an error that names the first rule it fails
+func (a *AuthService) validatePassword(username, password string) error {
+	policy := a.cfg.Password.Policy
+	if len([]rune(password)) < policy.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", policy.MinLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case !unicode.IsLetter(r):
+			hasSymbol = true
+		}
+	}
+	if policy.RequireUpper && !hasUpper {
+		return fmt.Errorf("password must contain an uppercase letter")
+	}
+	if policy.RequireLower && !hasLower {
+		return fmt.Errorf("password must contain a lowercase letter")
+	}
+	if policy.RequireDigit && !hasDigit {
+		return fmt.Errorf("password must contain a digit")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		return fmt.Errorf("password must contain a symbol")
+	}
+	if policy.DisallowUsername && username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return fmt.Errorf("password must not contain the username")
+	}
+	return nil
+}
+
+// isPasswordReused reports whether password matches the user's current password
+// or one of the previous passwords covered by the configured history size
+func (a *AuthService) isPasswordReused(user *User, password string) bool {
+	historySize := a.cfg.Password.HistorySize
+	if historySize <= 0 {
+		return false
+	}
+	if users.CheckPasswordHash(password, user.Password) {
+		return true
+	}
+	for i, hash := range user.PasswordHistory {
+		if i >= historySize-1 {
+			break
+		}
+		if users.CheckPasswordHash(password, hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordPasswordHistory pushes the user's current password hash onto the
+// history, keeping only as many entries as the configured history size needs
+func (a *AuthService) recordPasswordHistory(user *User) {
+	historySize := a.cfg.Password.HistorySize
+	if historySize <= 1 || user.Password == "" {
+		user.PasswordHistory = nil
+		return
+	}
+	history := append([]string{user.Password}, user.PasswordHistory...)
+	if len(history) > historySize-1 {
+		history = history[:historySize-1]
+	}
+	user.PasswordHistory = history
+}
+
+// isPasswordExpired reports whether the user's password is older than the configured max age
+func (a *AuthService) isPasswordExpired(user *User) bool {
+	maxAgeDays := a.cfg.Password.MaxAgeDays
+	if maxAgeDays <= 0 {
+		return false
+	}
+	if a.cfg.Password.ExemptAdmins && (user.IsAdmin || user.IsSuperAdmin) {
+		return false
+	}
+	changedAt := user.PasswordChangedAt
+	if changedAt.IsZero() {
+		changedAt = user.CreatedAt
 	}
+	if changedAt.IsZero() {
+		return false
+	}
+	return time.Since(changedAt) > time.Duration(maxAgeDays)*24*time.Hour
+}
+
+// recordLogin sets the user's last login time, which also keeps the
+// inactivity job from disabling them
+func (a *AuthService) recordLogin(user *User) {
+	user.LastLogin = time.Now()
+	userData, _ := json.Marshal(user)
+	a.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("user:"+user.Username), userData)
+	})
+}
+
+// passwordChallenge returns the code and message of the password change user
+// must make before getting a session, or empty strings if none is due
+func (a *AuthService) passwordChallenge(user *User) (string, string) {
+	switch {
+	case user.MustChangePassword:
+		return "password_change_required", "Password change required"
+	case a.isPasswordExpired(user):
+		return "password_expired", "Password expired"
+	}
+	return "", ""
+}
+
+// respondPasswordChallenge answers action with a token that can only be used to change the password
+func (a *AuthService) respondPasswordChallenge(c *gin.Context, action string, user *User, code, message string) {
+	challengeToken, err := a.generatePasswordChangeToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	middleware.LogAuthEvent(c, action, user.Username, false, fmt.Errorf("%s", strings.ToLower(message)))
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":           message,
+		"code":            code,
+		"challenge_token": challengeToken,
+		"username":        user.Username,
+	})
 }
 
-func (a *AuthService) hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+// loginFailures tracks consecutive failed logins for a username/IP pair
+type loginFailures struct {
+	Count       int       `json:"count"`
+	LastFailure time.Time `json:"last_failure"`
 }
 
-func (a *AuthService) checkPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+func loginThrottleKey(username, clientIP string) []byte {
+	return []byte("login_failures:" + username + "|" + clientIP)
 }
 
-func (a *AuthService) generateToken(username string, isAdmin bool) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// recordLoginFailure bumps the failure counter for username/IP and returns the
+// delay to apply. The counter expires after the configured reset window.
+func (a *AuthService) recordLoginFailure(username, clientIP string) time.Duration {
+	throttle := a.cfg.LoginThrottle
+	if throttle.BaseDelayMS <= 0 {
+		return 0
+	}
+
+	var failures loginFailures
+	key := loginThrottleKey(username, clientIP)
+	err := a.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err == nil {
+			err = item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &failures)
+			})
+		}
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+
+		failures.Count++
+		failures.LastFailure = time.Now()
+		data, err := json.Marshal(failures)
+		if err != nil {
+			return err
+		}
+		ttl := time.Duration(throttle.ResetMinutes) * time.Minute
+		return txn.SetEntry(badger.NewEntry(key, data).WithTTL(ttl))
+	})
+	if err != nil {
+		return 0
+	}
+
+	delay := time.Duration(throttle.BaseDelayMS) * time.Millisecond
+	maxDelay := time.Duration(throttle.MaxDelayMS) * time.Millisecond
+	for i := 1; i < failures.Count && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// resetLoginFailures clears the throttle and lockout counters after a successful login
+func (a *AuthService) resetLoginFailures(username, clientIP string) {
+	a.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete(loginThrottleKey(username, clientIP)); err != nil {
+			return err
+		}
+		return txn.Delete(loginAttemptsKey(username))
+	})
+}
+
+// loginAttempts tracks failed logins for a username from any client, for account lockout
+type loginAttempts struct {
+	Count        int       `json:"count"`
+	FirstFailure time.Time `json:"first_failure"`
+	LockedUntil  time.Time `json:"locked_until,omitempty"`
+}
+
+func loginAttemptsKey(username string) []byte {
+	return []byte("login_attempts:" + username)
+}
+
+// accountLockedUntil returns when the lockout on username ends, or the zero time if it is not locked
+func (a *AuthService) accountLockedUntil(username string) time.Time {
+	if a.cfg.Security.LockoutThreshold < 0 {
+		return time.Time{}
+	}
+	var attempts loginAttempts
+	err := a.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(loginAttemptsKey(username))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &attempts)
+		})
+	})
+	if err != nil || !time.Now().Before(attempts.LockedUntil) {
+		return time.Time{}
+	}
+	return attempts.LockedUntil
+}
+
+// recordFailedAttempt counts a failed login against username. Once the
+// configured number of failures is reached within the lockout window the
+// account is locked, and the time the lock ends is returned.
+func (a *AuthService) recordFailedAttempt(username string) time.Time {
+	security := a.cfg.Security
+	if security.LockoutThreshold < 0 {
+		return time.Time{}
+	}
+
+	window := time.Duration(security.LockoutMinutes) * time.Minute
+	var attempts loginAttempts
+	key := loginAttemptsKey(username)
+	err := a.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err == nil {
+			err = item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &attempts)
+			})
+		}
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+
+		now := time.Now()
+		if attempts.Count == 0 || now.Sub(attempts.FirstFailure) > window {
+			attempts = loginAttempts{FirstFailure: now}
+		}
+		attempts.Count++
+		if attempts.Count >= security.LockoutThreshold {
+			attempts.LockedUntil = now.Add(window)
+		}
+		data, err := json.Marshal(attempts)
+		if err != nil {
+			return err
+		}
+		return txn.SetEntry(badger.NewEntry(key, data).WithTTL(window))
+	})
+	if err != nil {
+		return time.Time{}
+	}
+	return attempts.LockedUntil
+}
+
+// rejectLocked responds with 429 and a Retry-After hint while an account is locked
+func rejectLocked(c *gin.Context, lockedUntil time.Time) {
+	retryAfter := int(time.Until(lockedUntil)/time.Second) + 1
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":        "Account temporarily locked due to too many failed login attempts",
+		"code":         "account_locked",
+		"retry_after":  retryAfter,
+		"locked_until": lockedUntil,
+	})
+}
+
+// rejectLogin applies the throttle delay and responds with 401, or with 429
+// if this failure locked the account
+func (a *AuthService) rejectLogin(c *gin.Context, username, message string) {
+	if delay := a.recordLoginFailure(username, c.ClientIP()); delay > 0 {
+		time.Sleep(delay)
+	}
+	if lockedUntil := a.recordFailedAttempt(username); !lockedUntil.IsZero() {
+		if a.auditService != nil {
+			a.auditService.LogEvent(c, "account_locked", "user", username, false, fmt.Errorf("too many failed login attempts"), map[string]interface{}{
+				"failed_attempts": a.cfg.Security.LockoutThreshold,
+				"locked_until":    lockedUntil,
+			})
+		}
+		rejectLocked(c, lockedUntil)
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
+// generateToken issues an access token belonging to the given login session
+func (a *AuthService) generateToken(user *User, sessionID string) (string, error) {
+	return a.signToken(user, "", sessionID, time.Duration(a.cfg.JWT.ExpiryHours)*time.Hour)
+}
+
+// generatePasswordChangeToken issues a short-lived token that only allows changing the password
+func (a *AuthService) generatePasswordChangeToken(user *User) (string, error) {
+	return a.signToken(user, tokenScopePasswordChange, "", 15*time.Minute)
+}
+
+func (a *AuthService) signToken(user *User, scope, sessionID string, ttl time.Duration) (string, error) {
+	expirationTime := time.Now().Add(ttl)
 	claims := &Claims{
-		Username: username,
-		IsAdmin:  isAdmin,
-		RegisteredClaims: jwt.RegisteredClaims{
+		Username:     user.Username,
+		IsAdmin:      user.IsAdmin,
+		OrgID:        user.OrgID,
+		IsSuperAdmin: user.IsSuperAdmin,
+		Scope:        scope,
+		SessionID:    sessionID,
+		RegisteredClaims: a.issuerClaims(jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
+		}),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(a.jwtSecret)
 }
 
+// issuerClaims sets the configured jwt.issuer and jwt.audience on claims
+func (a *AuthService) issuerClaims(claims jwt.RegisteredClaims) jwt.RegisteredClaims {
+	claims.Issuer = a.cfg.JWT.Issuer
+	if a.cfg.JWT.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{a.cfg.JWT.Audience}
+	}
+	return claims
+}
+
+// validateToken checks the signature and expiry of tokenString and, when
+// configured, that it was issued by and for this service
 func (a *AuthService) validateToken(tokenString string) (*Claims, error) {
+	var options []jwt.ParserOption
+	if a.cfg.JWT.Issuer != "" {
+		options = append(options, jwt.WithIssuer(a.cfg.JWT.Issuer))
+	}
+	if a.cfg.JWT.Audience != "" {
+		options = append(options, jwt.WithAudience(a.cfg.JWT.Audience))
+	}
+
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		return a.jwtSecret, nil
-	})
+	}, options...)
 
 	if err != nil {
 		return nil, err
@@ -140,6 +514,13 @@ func (a *AuthService) Login(c *gin.Context) {
 		return
 	}
 
+	// Locked accounts are refused before the password is checked
+	if lockedUntil := a.accountLockedUntil(user.Username); !lockedUntil.IsZero() {
+		middleware.LogAuthEvent(c, "login", user.Username, false, fmt.Errorf("account locked"))
+		rejectLocked(c, lockedUntil)
+		return
+	}
+
 	var storedUser User
 	err := a.db.View(func(txn *badger.Txn) error {
 		item, err := txn.Get([]byte("user:" + user.Username))
@@ -153,7 +534,7 @@ func (a *AuthService) Login(c *gin.Context) {
 
 	if err != nil {
 		// audit log removed(c, "login", "user", user.Username, false, err, map[string]interface{}{"error": "Invalid credentials"})
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		a.rejectLogin(c, user.Username, "Invalid credentials")
 		return
 	}
 
@@ -163,20 +544,22 @@ func (a *AuthService) Login(c *gin.Context) {
 		return
 	}
 
-	if !a.checkPasswordHash(user.Password, storedUser.Password) {
+	if !users.CheckPasswordHash(user.Password, storedUser.Password) {
 		// audit log removed(c, "login", "user", storedUser.Username, false, fmt.Errorf("invalid password"), map[string]interface{}{"error": "Invalid credentials"})
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		a.rejectLogin(c, storedUser.Username, "Invalid credentials")
 		return
 	}
+	a.resetLoginFailures(storedUser.Username, c.ClientIP())
 
-	// Update last login time
-	storedUser.LastLogin = time.Now()
-	userData, _ := json.Marshal(storedUser)
-	a.db.Update(func(txn *badger.Txn) error {
-		return txn.Set([]byte("user:"+storedUser.Username), userData)
-	})
+	// Require a password change before issuing a full session token
+	if code, message := a.passwordChallenge(&storedUser); code != "" {
+		a.respondPasswordChallenge(c, "login", &storedUser, code, message)
+		return
+	}
+
+	a.recordLogin(&storedUser)
 
-	token, err := a.generateToken(storedUser.Username, storedUser.IsAdmin)
+	token, refreshToken, err := a.issueSession(&storedUser)
 	if err != nil {
 		// audit log removed(c, "login", "user", storedUser.Username, false, err, map[string]interface{}{"error": "Failed to generate token"})
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
@@ -190,9 +573,10 @@ func (a *AuthService) Login(c *gin.Context) {
 
 	// audit log removed(c, "login", "user", storedUser.Username, true, nil, map[string]interface{}{"status": c.Writer.Status()})
 	c.JSON(http.StatusOK, gin.H{
-		"token":    token,
-		"username": storedUser.Username,
-		"is_admin": storedUser.IsAdmin,
+		"token":         token,
+		"refresh_token": refreshToken,
+		"username":      storedUser.Username,
+		"is_admin":      storedUser.IsAdmin,
 	})
 }
 
@@ -219,8 +603,13 @@ func (a *AuthService) Register(c *gin.Context) {
 		return
 	}
 
+	if err := a.validatePassword(createUserRequest.Username, createUserRequest.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "password_policy"})
+		return
+	}
+
 	// Hash password
-	hashedPassword, err := a.hashPassword(createUserRequest.Password)
+	hashedPassword, err := users.HashPassword(createUserRequest.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
@@ -228,14 +617,15 @@ func (a *AuthService) Register(c *gin.Context) {
 
 	// Save user
 	userData, _ := json.Marshal(User{
-		ID:       "",
-		Username: createUserRequest.Username,
-		Password: hashedPassword,
-		Email:    createUserRequest.Email,
-		IsAdmin:  createUserRequest.IsAdmin,
-		IsActive: true,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:                "",
+		Username:          createUserRequest.Username,
+		Password:          hashedPassword,
+		Email:             createUserRequest.Email,
+		IsAdmin:           createUserRequest.IsAdmin,
+		IsActive:          true,
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+		PasswordChangedAt: time.Now(),
 	})
 
 	err = a.db.Update(func(txn *badger.Txn) error {
@@ -272,8 +662,16 @@ func (a *AuthService) GetUserByUsername(username string) (*User, error) {
 
 func (a *AuthService) GetAllUsers() ([]UserResponse, error) {
 	var users []UserResponse
+	err := a.forEachUser(func(u UserResponse) error {
+		users = append(users, u)
+		return nil
+	})
+	return users, err
+}
 
-	err := a.db.View(func(txn *badger.Txn) error {
+// forEachUser calls fn for every stored user without loading them all at once
+func (a *AuthService) forEachUser(fn func(UserResponse) error) error {
+	return a.db.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 		opts.PrefetchSize = 10
 		it := txn.NewIterator(opts)
@@ -288,17 +686,20 @@ func (a *AuthService) GetAllUsers() ([]UserResponse, error) {
 					return err
 				}
 
-				users = append(users, UserResponse{
-					ID:        user.ID,
-					Username:  user.Username,
-					Email:     user.Email,
-					IsAdmin:   user.IsAdmin,
-					IsActive:  user.IsActive,
-					CreatedAt: user.CreatedAt,
-					UpdatedAt: user.UpdatedAt,
-					LastLogin: user.LastLogin,
+				return fn(UserResponse{
+					ID:                 user.ID,
+					Username:           user.Username,
+					Email:              user.Email,
+					IsAdmin:            user.IsAdmin,
+					IsActive:           user.IsActive,
+					CreatedAt:          user.CreatedAt,
+					UpdatedAt:          user.UpdatedAt,
+					LastLogin:          user.LastLogin,
+					OrgID:              user.OrgID,
+					IsSuperAdmin:       user.IsSuperAdmin,
+					MustChangePassword: user.MustChangePassword,
+					QuotaBytes:         user.QuotaBytes,
 				})
-				return nil
 			})
 			if err != nil {
 				return err
@@ -306,8 +707,6 @@ func (a *AuthService) GetAllUsers() ([]UserResponse, error) {
 		}
 		return nil
 	})
-
-	return users, err
 }
 
 // ListUsersHandler returns all users as JSON (admin only)
@@ -317,7 +716,37 @@ func (a *AuthService) ListUsersHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get users"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"users": users})
+	users = scopeUsersToOrg(c, users)
+	response.List(c, "users", users, response.All(len(users)), nil)
+}
+
+// SearchUsersHandler finds users by email (admin only). email matches
+// case-insensitively as a substring, or as the whole address with exact=true.
+// Emails are not indexed, so this scans every user.
+func (a *AuthService) SearchUsersHandler(c *gin.Context) {
+	query := strings.ToLower(strings.TrimSpace(c.Query("email")))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email is required"})
+		return
+	}
+	exact := c.Query("exact") == "true"
+
+	var users []UserResponse
+	err := a.forEachUser(func(u UserResponse) error {
+		if !canAccessOrg(c, u.OrgID) {
+			return nil
+		}
+		email := strings.ToLower(u.Email)
+		if (exact && email == query) || (!exact && strings.Contains(email, query)) {
+			users = append(users, u)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
+		return
+	}
+	response.List(c, "users", users, response.All(len(users)), gin.H{"email": query, "exact": exact})
 }
 
 // ExportUsersHandler returns all users as CSV or JSON (admin only)
@@ -334,24 +763,29 @@ func (a *AuthService) ExportUsersHandler(c *gin.Context) {
 	}()
 
 	format := c.DefaultQuery("format", "csv")
-	users, err := a.GetAllUsers()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get users"})
-		return
-	}
 	if format == "json" {
-		logAudit(true, nil, map[string]interface{}{"format": format, "count": len(users)})
+		users, err := a.GetAllUsers()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get users"})
+			return
+		}
+		users = scopeUsersToOrg(c, users)
 		c.Header("Content-Disposition", "attachment; filename=users.json")
 		c.JSON(http.StatusOK, users)
+		logAudit(true, nil, map[string]interface{}{"format": format, "count": len(users), "bytes": c.Writer.Size()})
 		return
 	}
-	// Default: CSV
+	// Default: CSV, streamed row by row as users are scanned
 	c.Header("Content-Disposition", "attachment; filename=users.csv")
 	c.Header("Content-Type", "text/csv")
-	w := csv.NewWriter(c.Writer)
-	defer w.Flush()
-	w.Write([]string{"id","username","email","is_admin","is_active","created_at","updated_at","last_login"})
-	for _, u := range users {
+	// Fields are escaped so the file is safe to open in a spreadsheet
+	w := response.NewCSVWriter(c.Writer)
+	w.Write([]string{"id", "username", "email", "is_admin", "is_active", "created_at", "updated_at", "last_login", "org_id"})
+	count := 0
+	err := a.forEachUser(func(u UserResponse) error {
+		if !canAccessOrg(c, u.OrgID) {
+			return nil
+		}
 		w.Write([]string{
 			u.ID,
 			u.Username,
@@ -361,9 +795,22 @@ func (a *AuthService) ExportUsersHandler(c *gin.Context) {
 			u.CreatedAt.Format(time.RFC3339),
 			u.UpdatedAt.Format(time.RFC3339),
 			u.LastLogin.Format(time.RFC3339),
+			u.OrgID,
 		})
+		count++
+		if count%exportFlushEvery == 0 {
+			w.Flush()
+			c.Writer.Flush()
+		}
+		return w.Error()
+	})
+	w.Flush()
+	if err != nil {
+		// Rows may already be sent, so the failure can only be audited
+		logAudit(false, err, map[string]interface{}{"stage": "stream_csv", "count": count, "bytes": c.Writer.Size()})
+		return
 	}
-	logAudit(true, nil, map[string]interface{}{"format": format, "count": len(users)})
+	logAudit(true, nil, map[string]interface{}{"format": format, "count": count, "bytes": c.Writer.Size()})
 }
 
 // ImportUsersHandler accepts CSV or JSON and creates/updates users (admin only)
@@ -387,14 +834,34 @@ func (a *AuthService) ImportUsersHandler(c *gin.Context) {
 		return
 	}
 	defer file.Close()
-	var users []User
+	// Each row is applied onto the stored user, so fields an export leaves
+	// out (password hash, password history, quota) survive a re-import
+	type userImportRow struct {
+		username string
+		apply    func(u *User) error
+	}
+	var rows []userImportRow
 	if format == "json" {
+		var records []json.RawMessage
 		dec := json.NewDecoder(file)
-		if err := dec.Decode(&users); err != nil {
+		if err := dec.Decode(&records); err != nil {
 			logAudit(false, err, map[string]interface{}{"stage": "decode_json"})
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
 			return
 		}
+		for _, raw := range records {
+			raw := raw
+			var ident struct {
+				Username string `json:"username"`
+			}
+			if err := json.Unmarshal(raw, &ident); err != nil {
+				rows = append(rows, userImportRow{apply: func(*User) error { return err }})
+				continue
+			}
+			rows = append(rows, userImportRow{username: ident.Username, apply: func(u *User) error {
+				return json.Unmarshal(raw, u)
+			}})
+		}
 	} else {
 		r := csv.NewReader(file)
 		records, err := r.ReadAll()
@@ -403,28 +870,118 @@ func (a *AuthService) ImportUsersHandler(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV"})
 			return
 		}
-		for i, rec := range records {
-			if i == 0 { continue } // skip header
-			if len(rec) < 8 { continue }
-			createdAt, _ := time.Parse(time.RFC3339, rec[5])
-			updatedAt, _ := time.Parse(time.RFC3339, rec[6])
-			lastLogin, _ := time.Parse(time.RFC3339, rec[7])
-			users = append(users, User{
-				ID: rec[0], Username: rec[1], Email: rec[2],
-				IsAdmin: rec[3] == "true", IsActive: rec[4] == "true",
-				CreatedAt: createdAt, UpdatedAt: updatedAt, LastLogin: lastLogin,
-			})
+		// Undo the formula escaping applied on export
+		response.CSVUnescapeAll(records)
+		for _, rec := range records[1:] {
+			rec := rec
+			if len(rec) < 8 {
+				rows = append(rows, userImportRow{apply: func(*User) error {
+					return fmt.Errorf("expected at least 8 columns, got %d", len(rec))
+				}})
+				continue
+			}
+			rows = append(rows, userImportRow{username: rec[1], apply: func(u *User) error {
+				// Identity and timestamps only come from the file for new users
+				if u.ID == "" {
+					u.ID = rec[0]
+					u.CreatedAt, _ = time.Parse(time.RFC3339, rec[5])
+					u.UpdatedAt, _ = time.Parse(time.RFC3339, rec[6])
+					u.LastLogin, _ = time.Parse(time.RFC3339, rec[7])
+				}
+				u.Email = rec[2]
+				u.IsAdmin = rec[3] == "true"
+				u.IsActive = rec[4] == "true"
+				if len(rec) > 8 {
+					u.OrgID = rec[8]
+				}
+				return nil
+			}})
 		}
 	}
 	// Save users (create or update)
-	for _, u := range users {
-		userData, _ := json.Marshal(u)
-		a.db.Update(func(txn *badger.Txn) error {
-			return txn.Set([]byte("user:"+u.Username), userData)
-		})
+	isSuperAdmin := c.GetBool("is_super_admin")
+	var rowErrors []UserImportError
+	imported := 0
+	for i, row := range rows {
+		rowError := func(msg string) {
+			rowErrors = append(rowErrors, UserImportError{Row: i + 1, Username: row.username, Error: msg})
+		}
+		var existing *User
+		user := &User{}
+		if row.username != "" {
+			if stored, err := a.GetUserByUsername(row.username); err == nil {
+				existing = stored
+				merged := *stored
+				user = &merged
+			}
+		}
+		// Org admins can only import into their own organization and never touch a super-admin
+		if existing != nil && !canAccessOrg(c, existing.OrgID) {
+			rowError("user belongs to another organization")
+			continue
+		}
+		if existing != nil && existing.IsSuperAdmin && !isSuperAdmin {
+			rowError("super-admin privileges required to import a super-admin")
+			continue
+		}
+		if err := row.apply(user); err != nil {
+			rowError(err.Error())
+			continue
+		}
+		if row.username == "" {
+			rowError("username is required")
+			continue
+		}
+		user.Username = row.username
+		if !isSuperAdmin {
+			user.OrgID = c.GetString("org_id")
+			user.IsSuperAdmin = false
+		} else if user.OrgID != "" && (existing == nil || user.OrgID != existing.OrgID) {
+			if _, err := a.orgService.GetOrganization(user.OrgID); err != nil {
+				rowError("organization not found")
+				continue
+			}
+		}
+		// Never leave an organization without an active admin
+		if existing != nil && existing.IsActive && existing.IsAdmin && !(user.IsActive && user.IsAdmin && user.OrgID == existing.OrgID) {
+			count, err := a.activeAdminCount(existing.OrgID)
+			if err != nil {
+				rowError("failed to check admin users")
+				continue
+			}
+			if count <= 1 {
+				rowError("cannot remove the last active admin")
+				continue
+			}
+		}
+		if existing != nil && user.IsActive && !existing.IsActive {
+			user.ReactivatedAt = time.Now()
+		}
+		userData, _ := json.Marshal(user)
+		if err := a.db.Update(func(txn *badger.Txn) error {
+			return txn.Set([]byte("user:"+user.Username), userData)
+		}); err != nil {
+			rowError("failed to save user")
+			continue
+		}
+		if existing != nil && existing.IsActive && !user.IsActive {
+			a.revokeDisabledUserSessions(user.Username)
+		}
+		imported++
 	}
-	logAudit(true, nil, map[string]interface{}{"format": format, "count": len(users)})
-	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Imported %d users", len(users))})
+	logAudit(len(rowErrors) == 0, nil, map[string]interface{}{"format": format, "count": imported, "rejected": len(rowErrors)})
+	c.JSON(http.StatusOK, gin.H{
+		"message":  fmt.Sprintf("Imported %d users", imported),
+		"imported": imported,
+		"errors":   rowErrors,
+	})
+}
+
+// UserImportError describes an import row that was rejected
+type UserImportError struct {
+	Row      int    `json:"row"`
+	Username string `json:"username"`
+	Error    string `json:"error"`
 }
 
 func (a *AuthService) CreateUser(c *gin.Context) {
@@ -455,8 +1012,13 @@ func (a *AuthService) CreateUser(c *gin.Context) {
 		return
 	}
 
+	if err := a.validatePassword(createUserRequest.Username, createUserRequest.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "password_policy"})
+		return
+	}
+
 	// Hash password
-	hashedPassword, err := a.hashPassword(createUserRequest.Password)
+	hashedPassword, err := users.HashPassword(createUserRequest.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
@@ -464,14 +1026,16 @@ func (a *AuthService) CreateUser(c *gin.Context) {
 
 	// Create new user
 	newUser := User{
-		ID:        fmt.Sprintf("user_%d", time.Now().UnixNano()),
-		Username:  createUserRequest.Username,
-		Password:  hashedPassword,
-		Email:     createUserRequest.Email,
-		IsAdmin:   createUserRequest.IsAdmin,
-		IsActive:  true,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:                fmt.Sprintf("user_%d", time.Now().UnixNano()),
+		Username:          createUserRequest.Username,
+		Password:          hashedPassword,
+		Email:             createUserRequest.Email,
+		IsAdmin:           createUserRequest.IsAdmin,
+		IsActive:          true,
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+		OrgID:             user.OrgID,
+		PasswordChangedAt: time.Now(),
 	}
 
 	userData, _ := json.Marshal(newUser)
@@ -496,6 +1060,7 @@ func (a *AuthService) CreateUser(c *gin.Context) {
 			IsActive:  newUser.IsActive,
 			CreatedAt: newUser.CreatedAt,
 			UpdatedAt: newUser.UpdatedAt,
+			OrgID:     newUser.OrgID,
 		},
 	})
 }
@@ -520,7 +1085,8 @@ func (a *AuthService) GetUsers(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"users": users})
+	users = scopeUsersToOrg(c, users)
+	response.List(c, "users", users, response.All(len(users)), nil)
 }
 
 func (a *AuthService) UpdateUser(c *gin.Context) {
@@ -541,11 +1107,17 @@ func (a *AuthService) UpdateUser(c *gin.Context) {
 	
 	// Get target user
 	targetUser, err := a.GetUserByUsername(username)
-	if err != nil {
+	if err != nil || !canAccessOrg(c, targetUser.OrgID) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
+	// Otherwise an org admin could demote or deactivate a super-admin in their org
+	if targetUser.IsSuperAdmin && !adminUser.IsSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Super-admin privileges required to modify a super-admin"})
+		return
+	}
+
 	// Get update request
 	var updateRequest UpdateUserRequest
 	if err := c.ShouldBindJSON(&updateRequest); err != nil {
@@ -553,10 +1125,43 @@ func (a *AuthService) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	orgID := targetUser.OrgID
+	if updateRequest.OrgID != nil && *updateRequest.OrgID != targetUser.OrgID {
+		if !adminUser.IsSuperAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Super-admin privileges required to change organization"})
+			return
+		}
+		if *updateRequest.OrgID != "" {
+			if _, err := a.orgService.GetOrganization(*updateRequest.OrgID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Organization not found"})
+				return
+			}
+		}
+		orgID = *updateRequest.OrgID
+	}
+
+	// Never leave an organization without an active admin, including by moving it to another one
+	if targetUser.IsActive && targetUser.IsAdmin && !(updateRequest.IsActive && updateRequest.IsAdmin && orgID == targetUser.OrgID) {
+		count, err := a.activeAdminCount(targetUser.OrgID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check admin users"})
+			return
+		}
+		if count <= 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot remove the last active admin"})
+			return
+		}
+	}
+
 	// Update user fields
+	if updateRequest.IsActive && !targetUser.IsActive {
+		targetUser.ReactivatedAt = time.Now()
+	}
+	deactivated := targetUser.IsActive && !updateRequest.IsActive
 	targetUser.Email = updateRequest.Email
 	targetUser.IsAdmin = updateRequest.IsAdmin
 	targetUser.IsActive = updateRequest.IsActive
+	targetUser.OrgID = orgID
 	targetUser.UpdatedAt = time.Now()
 
 	userData, _ := json.Marshal(targetUser)
@@ -569,23 +1174,168 @@ func (a *AuthService) UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
+	if deactivated {
+		a.revokeDisabledUserSessions(targetUser.Username)
+	}
 
 	middleware.LogAuthEvent(c, "update_user", currentUser.(string), true, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User updated successfully",
 		"user": UserResponse{
-			ID:        targetUser.ID,
-			Username:  targetUser.Username,
-			Email:     targetUser.Email,
-			IsAdmin:   targetUser.IsAdmin,
-			IsActive:  targetUser.IsActive,
-			CreatedAt: targetUser.CreatedAt,
-			UpdatedAt: targetUser.UpdatedAt,
-			LastLogin: targetUser.LastLogin,
+			ID:           targetUser.ID,
+			Username:     targetUser.Username,
+			Email:        targetUser.Email,
+			IsAdmin:      targetUser.IsAdmin,
+			IsActive:     targetUser.IsActive,
+			CreatedAt:    targetUser.CreatedAt,
+			UpdatedAt:    targetUser.UpdatedAt,
+			LastLogin:    targetUser.LastLogin,
+			OrgID:        targetUser.OrgID,
+			IsSuperAdmin: targetUser.IsSuperAdmin,
 		},
 	})
 }
 
+// BulkUpdateUsersHandler applies admin/active flags to many users in one transaction (admin only)
+func (a *AuthService) BulkUpdateUsersHandler(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if a.auditService != nil {
+			a.auditService.LogEvent(c, "bulk_update_users", "user", "", success, err, details)
+		}
+	}
+
+	var req BulkUpdateUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Track active admins per organization so the last one cannot be removed
+	allUsers, err := a.GetAllUsers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get users"})
+		return
+	}
+	adminCounts := make(map[string]int)
+	for _, u := range allUsers {
+		if u.IsActive && u.IsAdmin {
+			adminCounts[u.OrgID]++
+		}
+	}
+
+	var results []BulkUpdateUserResult
+	pending := make(map[string]*User)
+	var order []string
+	wasActive := make(map[string]bool) // Stored IsActive of each pending user
+	for _, entry := range req.Users {
+		user, ok := pending[entry.Username]
+		if !ok {
+			user, err = a.GetUserByUsername(entry.Username)
+			if err != nil || !canAccessOrg(c, user.OrgID) {
+				results = append(results, BulkUpdateUserResult{Username: entry.Username, Error: "User not found"})
+				continue
+			}
+			wasActive[entry.Username] = user.IsActive
+		}
+		if user.IsSuperAdmin && !c.GetBool("is_super_admin") {
+			results = append(results, BulkUpdateUserResult{Username: entry.Username, Error: "Super-admin privileges required to modify a super-admin"})
+			continue
+		}
+
+		wasAdmin := user.IsActive && user.IsAdmin
+		willBeAdmin := entry.IsActive && entry.IsAdmin
+		if wasAdmin && !willBeAdmin {
+			if adminCounts[user.OrgID] <= 1 {
+				results = append(results, BulkUpdateUserResult{Username: entry.Username, Error: "Cannot remove the last active admin"})
+				continue
+			}
+			adminCounts[user.OrgID]--
+		} else if !wasAdmin && willBeAdmin {
+			adminCounts[user.OrgID]++
+		}
+
+		if entry.IsActive && !user.IsActive {
+			user.ReactivatedAt = time.Now()
+		}
+		user.IsAdmin = entry.IsAdmin
+		user.IsActive = entry.IsActive
+		user.UpdatedAt = time.Now()
+		if !ok {
+			pending[entry.Username] = user
+			order = append(order, entry.Username)
+		}
+		results = append(results, BulkUpdateUserResult{Username: entry.Username, Success: true})
+	}
+
+	err = a.db.Update(func(txn *badger.Txn) error {
+		for _, username := range order {
+			userData, err := json.Marshal(pending[username])
+			if err != nil {
+				return err
+			}
+			if err := txn.Set([]byte("user:"+username), userData); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logAudit(false, err, map[string]interface{}{"requested": len(req.Users)})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update users"})
+		return
+	}
+	for _, username := range order {
+		if wasActive[username] && !pending[username].IsActive {
+			a.revokeDisabledUserSessions(username)
+		}
+	}
+
+	failed := 0
+	for _, r := range results {
+		if !r.Success {
+			failed++
+		}
+	}
+	logAudit(true, nil, map[string]interface{}{
+		"requested": len(req.Users),
+		"updated":   len(order),
+		"failed":    failed,
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"results": results,
+		"updated": len(order),
+		"failed":  failed,
+	})
+}
+
+// activeAdminCount returns the number of active admins in an organization
+func (a *AuthService) activeAdminCount(orgID string) (int, error) {
+	users, err := a.GetAllUsers()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, u := range users {
+		if u.OrgID == orgID && u.IsActive && u.IsAdmin {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// revokeDisabledUserSessions ends the sessions of a user who was deactivated
+// or deleted. AuthMiddleware and Refresh reject such users anyway, so a
+// failure is only logged.
+func (a *AuthService) revokeDisabledUserSessions(username string) {
+	if err := a.revokeUserSessions(username); err != nil {
+		logger.Warn("Failed to revoke sessions of a disabled user", map[string]interface{}{
+			"username": username,
+			"error":    err.Error(),
+		})
+	}
+}
+
 func (a *AuthService) DeleteUser(c *gin.Context) {
 	// Check if current user is admin
 	currentUser, exists := c.Get("username")
@@ -609,11 +1359,28 @@ func (a *AuthService) DeleteUser(c *gin.Context) {
 	}
 
 	// Check if user exists
-	_, err = a.GetUserByUsername(username)
-	if err != nil {
+	targetUser, err := a.GetUserByUsername(username)
+	if err != nil || !canAccessOrg(c, targetUser.OrgID) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
+	if targetUser.IsSuperAdmin && !adminUser.IsSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Super-admin privileges required to delete a super-admin"})
+		return
+	}
+
+	// Never leave an organization without an active admin
+	if targetUser.IsActive && targetUser.IsAdmin {
+		count, err := a.activeAdminCount(targetUser.OrgID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check admin users"})
+			return
+		}
+		if count <= 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot remove the last active admin"})
+			return
+		}
+	}
 
 	// Delete user
 	err = a.db.Update(func(txn *badger.Txn) error {
@@ -625,6 +1392,7 @@ func (a *AuthService) DeleteUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
+	a.revokeDisabledUserSessions(username)
 
 	middleware.LogAuthEvent(c, "delete_user", currentUser.(string), true, nil)
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
@@ -651,22 +1419,38 @@ func (a *AuthService) ChangePassword(c *gin.Context) {
 	}
 
 	// Verify current password
-	if !a.checkPasswordHash(changePasswordRequest.CurrentPassword, user.Password) {
+	if !users.CheckPasswordHash(changePasswordRequest.CurrentPassword, user.Password) {
 		middleware.LogAuthEvent(c, "change_password", currentUser.(string), false, fmt.Errorf("invalid current password"))
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Current password is incorrect"})
 		return
 	}
 
+	if err := a.validatePassword(user.Username, changePasswordRequest.NewPassword); err != nil {
+		middleware.LogAuthEvent(c, "change_password", currentUser.(string), false, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "password_policy"})
+		return
+	}
+
+	// Reject reuse of recent passwords
+	if a.isPasswordReused(user, changePasswordRequest.NewPassword) {
+		middleware.LogAuthEvent(c, "change_password", currentUser.(string), false, fmt.Errorf("password reused"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("New password must not match any of your last %d passwords", a.cfg.Password.HistorySize)})
+		return
+	}
+
 	// Hash new password
-	hashedPassword, err := a.hashPassword(changePasswordRequest.NewPassword)
+	hashedPassword, err := users.HashPassword(changePasswordRequest.NewPassword)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
 	}
 
 	// Update password
+	a.recordPasswordHistory(user)
 	user.Password = hashedPassword
 	user.UpdatedAt = time.Now()
+	user.PasswordChangedAt = user.UpdatedAt
+	user.MustChangePassword = false
 
 	userData, _ := json.Marshal(user)
 	err = a.db.Update(func(txn *badger.Txn) error {
@@ -680,9 +1464,149 @@ func (a *AuthService) ChangePassword(c *gin.Context) {
 	}
 
 	middleware.LogAuthEvent(c, "change_password", currentUser.(string), true, nil)
+
+	// A password-change challenge is exchanged for a full session token
+	if c.GetString("token_scope") == tokenScopePasswordChange {
+		token, refreshToken, err := a.issueSession(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":       "Password changed successfully",
+			"token":         token,
+			"refresh_token": refreshToken,
+			"username":      user.Username,
+			"is_admin":      user.IsAdmin,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
 }
 
+// ResetPasswordHandler sets a new password for a user (admin only), ends
+// their existing sessions and forces them to change it at their next login.
+// Only super-admins may reset a super-admin's password.
+func (a *AuthService) ResetPasswordHandler(c *gin.Context) {
+	username := c.Param("username")
+
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if a.auditService != nil {
+			a.auditService.LogEvent(c, "reset_password", "user", username, success, err, details)
+		}
+	}
+
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	targetUser, err := a.GetUserByUsername(username)
+	if err != nil || !canAccessOrg(c, targetUser.OrgID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	// Otherwise an org admin could take over a super-admin account in their org
+	if targetUser.IsSuperAdmin && !c.GetBool("is_super_admin") {
+		logAudit(false, fmt.Errorf("target is a super-admin"), nil)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Super-admin privileges required to reset a super-admin's password"})
+		return
+	}
+
+	if err := a.validatePassword(targetUser.Username, req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "password_policy"})
+		return
+	}
+	if a.isPasswordReused(targetUser, req.NewPassword) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("New password must not match any of the user's last %d passwords", a.cfg.Password.HistorySize)})
+		return
+	}
+
+	hashedPassword, err := users.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	a.recordPasswordHistory(targetUser)
+	targetUser.Password = hashedPassword
+	targetUser.MustChangePassword = true
+	targetUser.UpdatedAt = time.Now()
+	targetUser.PasswordChangedAt = targetUser.UpdatedAt
+
+	userData, _ := json.Marshal(targetUser)
+	err = a.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("user:"+targetUser.Username), userData)
+	})
+	if err != nil {
+		logAudit(false, err, nil)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	// Whoever knew the old password may still hold its sessions
+	details := map[string]interface{}{"must_change_password": true, "sessions_revoked": true}
+	if err := a.revokeUserSessions(targetUser.Username); err != nil {
+		logger.Warn("Failed to revoke sessions after password reset", map[string]interface{}{
+			"username": targetUser.Username,
+			"error":    err.Error(),
+		})
+		details["sessions_revoked"] = false
+	}
+
+	logAudit(true, nil, details)
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully; the user must change it at next login"})
+}
+
+// SetQuotaHandler sets a user's storage quota in bytes (admin only)
+func (a *AuthService) SetQuotaHandler(c *gin.Context) {
+	username := c.Param("username")
+
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if a.auditService != nil {
+			a.auditService.LogEvent(c, "set_quota", "user", username, success, err, details)
+		}
+	}
+
+	var req SetQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if *req.QuotaBytes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quota_bytes must not be negative"})
+		return
+	}
+
+	targetUser, err := a.GetUserByUsername(username)
+	if err != nil || !canAccessOrg(c, targetUser.OrgID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	previous := targetUser.QuotaBytes
+	targetUser.QuotaBytes = *req.QuotaBytes
+	targetUser.UpdatedAt = time.Now()
+
+	userData, _ := json.Marshal(targetUser)
+	err = a.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("user:"+targetUser.Username), userData)
+	})
+	details := map[string]interface{}{"quota_bytes": targetUser.QuotaBytes, "previous_quota_bytes": previous}
+	if err != nil {
+		logAudit(false, err, details)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set quota"})
+		return
+	}
+
+	logAudit(true, nil, details)
+	c.JSON(http.StatusOK, gin.H{"message": "Quota updated", "username": username, "quota_bytes": targetUser.QuotaBytes})
+}
+
 func (a *AuthService) GetUserConfig(c *gin.Context) {
 	// Check if current user is admin
 	currentUser, exists := c.Get("username")
@@ -701,7 +1625,7 @@ func (a *AuthService) GetUserConfig(c *gin.Context) {
 	
 	// Get target user
 	targetUser, err := a.GetUserByUsername(username)
-	if err != nil {
+	if err != nil || !canAccessOrg(c, targetUser.OrgID) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -731,14 +1655,16 @@ func (a *AuthService) GetUserConfig(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"user": UserResponse{
-			ID:        targetUser.ID,
-			Username:  targetUser.Username,
-			Email:     targetUser.Email,
-			IsAdmin:   targetUser.IsAdmin,
-			IsActive:  targetUser.IsActive,
-			CreatedAt: targetUser.CreatedAt,
-			UpdatedAt: targetUser.UpdatedAt,
-			LastLogin: targetUser.LastLogin,
+			ID:           targetUser.ID,
+			Username:     targetUser.Username,
+			Email:        targetUser.Email,
+			IsAdmin:      targetUser.IsAdmin,
+			IsActive:     targetUser.IsActive,
+			CreatedAt:    targetUser.CreatedAt,
+			UpdatedAt:    targetUser.UpdatedAt,
+			LastLogin:    targetUser.LastLogin,
+			OrgID:        targetUser.OrgID,
+			IsSuperAdmin: targetUser.IsSuperAdmin,
 		},
 		"config": userConfig,
 	})
@@ -755,15 +1681,54 @@ func AuthMiddleware(authService *AuthService) gin.HandlerFunc {
 
 		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
 		claims, err := authService.validateToken(tokenString)
-		if err != nil {
+		if err != nil || claims.Scope == tokenScopeRefresh {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
+		if authService.isSessionRevoked(claims.SessionID) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			c.Abort()
+			return
+		}
 
 		c.Set("username", claims.Username)
 		c.Set("is_admin", claims.IsAdmin)
 		c.Set("user_id", claims.Username) // Set user_id to username for compatibility
+		c.Set("org_id", claims.OrgID)
+		c.Set("is_super_admin", claims.IsSuperAdmin)
+		c.Set("token_scope", claims.Scope)
+		if claims.SessionID != "" {
+			c.Set("session_id", claims.SessionID)
+		}
+
+		// Password-change challenge tokens may only be used to change the password
+		onChangePassword := strings.HasSuffix(c.FullPath(), "/auth/change-password")
+		if claims.Scope == tokenScopePasswordChange && !onChangePassword {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password change required", "code": "password_expired"})
+			c.Abort()
+			return
+		}
+
+		// Tokens die with the account: deactivated and deleted users are locked out at once
+		user, err := authService.GetUserByUsername(claims.Username)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+		if !user.IsActive {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is inactive"})
+			c.Abort()
+			return
+		}
+
+		// A forced change also applies to tokens issued before the flag was set
+		if !onChangePassword && user.MustChangePassword {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password change required", "code": "password_change_required"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/gin-gonic/gin"
+
+	"s3mgr/config"
+)
+
+// newTestDB opens an in-memory database that is closed when the test ends
+func newTestDB(t *testing.T) *badger.DB {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestAccountLockout(t *testing.T) {
+	tests := []struct {
+		name       string
+		threshold  int
+		failures   int
+		wantLocked bool
+	}{
+		{"below the threshold", 3, 2, false},
+		{"at the threshold", 3, 3, true},
+		{"past the threshold", 3, 5, true},
+		{"threshold of one", 1, 1, true},
+		{"lockout disabled", -1, 10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Security.LockoutThreshold = tt.threshold
+			cfg.Security.LockoutMinutes = 15
+			a := &AuthService{db: newTestDB(t), cfg: cfg}
+
+			var lockedUntil time.Time
+			for i := 0; i < tt.failures; i++ {
+				lockedUntil = a.recordFailedAttempt("alice")
+			}
+			if locked := !lockedUntil.IsZero(); locked != tt.wantLocked {
+				t.Fatalf("recordFailedAttempt locked = %v, want %v", locked, tt.wantLocked)
+			}
+			if locked := !a.accountLockedUntil("alice").IsZero(); locked != tt.wantLocked {
+				t.Errorf("accountLockedUntil locked = %v, want %v", locked, tt.wantLocked)
+			}
+			if !a.accountLockedUntil("bob").IsZero() {
+				t.Error("failures for alice locked bob")
+			}
+		})
+	}
+}
+
+func TestAccountLockoutWindow(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Security.LockoutThreshold = 2
+	cfg.Security.LockoutMinutes = 15
+	a := &AuthService{db: newTestDB(t), cfg: cfg}
+
+	// A failure from before the window does not count towards the lockout
+	stale, _ := json.Marshal(loginAttempts{Count: 1, FirstFailure: time.Now().Add(-time.Hour)})
+	if err := a.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(loginAttemptsKey("alice"), stale)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if lockedUntil := a.recordFailedAttempt("alice"); !lockedUntil.IsZero() {
+		t.Error("a failure outside the window counted towards the lockout")
+	}
+	if lockedUntil := a.recordFailedAttempt("alice"); lockedUntil.IsZero() {
+		t.Error("two failures within the window did not lock the account")
+	}
+
+	// Once the lock has passed the account can log in again
+	expired, _ := json.Marshal(loginAttempts{Count: 2, FirstFailure: time.Now().Add(-20 * time.Minute), LockedUntil: time.Now().Add(-5 * time.Minute)})
+	if err := a.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(loginAttemptsKey("alice"), expired)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !a.accountLockedUntil("alice").IsZero() {
+		t.Error("account still locked after the lock ended")
+	}
+}
+
+// putTestUser stores u as-is
+func putTestUser(t *testing.T, a *AuthService, u User) {
+	t.Helper()
+	data, _ := json.Marshal(u)
+	if err := a.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("user:"+u.Username), data)
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// importUsers posts body to ImportUsersHandler as an admin of orgID
+func importUsers(t *testing.T, a *AuthService, orgID string, superAdmin bool, format, body string) (imported int, rejected map[string]string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("org_id", orgID)
+		c.Set("is_super_admin", superAdmin)
+		c.Next()
+	})
+	r.POST("/users/import", a.ImportUsersHandler)
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, _ := mw.CreateFormFile("file", "users."+format)
+	fw.Write([]byte(body))
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/users/import?format="+format, &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("import status = %d, body %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Imported int               `json:"imported"`
+		Errors   []UserImportError `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	rejected = make(map[string]string)
+	for _, e := range resp.Errors {
+		rejected[e.Username] = e.Error
+	}
+	return resp.Imported, rejected
+}
+
+func TestImportUsersOrgIsolation(t *testing.T) {
+	a := &AuthService{db: newTestDB(t), cfg: &config.Config{}}
+	putTestUser(t, a, User{ID: "u1", Username: "root", Password: "root-hash", IsAdmin: true, IsActive: true, IsSuperAdmin: true})
+	putTestUser(t, a, User{ID: "u2", Username: "owner", Password: "owner-hash", IsAdmin: true, IsActive: true, OrgID: "acme"})
+	putTestUser(t, a, User{ID: "u3", Username: "owner2", Password: "owner2-hash", IsAdmin: true, IsActive: true, OrgID: "acme"})
+	putTestUser(t, a, User{ID: "u4", Username: "carol", Password: "carol-hash", IsActive: true, OrgID: "other"})
+
+	const csvHeader = "id,username,email,is_admin,is_active,created_at,updated_at,last_login,org_id\n"
+	imported, rejected := importUsers(t, a, "acme", false, "csv", csvHeader+
+		"u1,root,evil@example.com,true,true,,,,acme\n"+
+		"u4,carol,evil@example.com,true,true,,,,acme\n"+
+		"u5,dave,dave@example.com,false,true,,,,other\n")
+	if imported != 1 {
+		t.Errorf("imported = %d, want 1", imported)
+	}
+	if _, ok := rejected["root"]; !ok {
+		t.Error("org admin overwrote a super-admin")
+	}
+	if _, ok := rejected["carol"]; !ok {
+		t.Error("org admin overwrote a user in another organization")
+	}
+	if root, _ := a.GetUserByUsername("root"); root.Password != "root-hash" || !root.IsSuperAdmin || root.Email != "" {
+		t.Errorf("super-admin changed: %+v", root)
+	}
+	if dave, err := a.GetUserByUsername("dave"); err != nil || dave.OrgID != "acme" {
+		t.Errorf("new user not created in the importer's organization: %+v, %v", dave, err)
+	}
+
+	// A JSON record cannot grant super-admin or reach a super-admin either
+	_, rejected = importUsers(t, a, "acme", false, "json", `[{"username":"root","password":"x"},{"username":"owner2","is_admin":true,"is_active":true,"is_super_admin":true}]`)
+	if _, ok := rejected["root"]; !ok {
+		t.Error("org admin overwrote a super-admin from JSON")
+	}
+	if owner2, _ := a.GetUserByUsername("owner2"); owner2.IsSuperAdmin || owner2.OrgID != "acme" {
+		t.Errorf("org admin granted super-admin: %+v", owner2)
+	}
+}
+
+func TestImportUsersKeepsStoredFields(t *testing.T) {
+	a := &AuthService{db: newTestDB(t), cfg: &config.Config{}}
+	changedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	putTestUser(t, a, User{ID: "u1", Username: "owner", Password: "owner-hash", IsAdmin: true, IsActive: true, OrgID: "acme"})
+	putTestUser(t, a, User{
+		ID: "u2", Username: "bob", Password: "bob-hash", IsActive: true, OrgID: "acme",
+		PasswordHistory: []string{"old-hash"}, PasswordChangedAt: changedAt, MustChangePassword: true, QuotaBytes: 1 << 30,
+	})
+
+	// Re-importing an export changes the exported fields only
+	imported, rejected := importUsers(t, a, "acme", false, "csv",
+		"id,username,email,is_admin,is_active,created_at,updated_at,last_login,org_id\n"+
+			"u2,bob,bob@example.com,false,true,,,,acme\n"+
+			"u1,owner,,false,true,,,,acme\n")
+	if imported != 1 {
+		t.Errorf("imported = %d, want 1 (errors %v)", imported, rejected)
+	}
+	bob, _ := a.GetUserByUsername("bob")
+	if bob.Email != "bob@example.com" {
+		t.Errorf("email = %q, want the imported one", bob.Email)
+	}
+	if bob.Password != "bob-hash" || len(bob.PasswordHistory) != 1 || !bob.PasswordChangedAt.Equal(changedAt) ||
+		!bob.MustChangePassword || bob.QuotaBytes != 1<<30 {
+		t.Errorf("stored fields lost on re-import: %+v", bob)
+	}
+
+	// The organization's only admin cannot be demoted by an import
+	if _, ok := rejected["owner"]; !ok {
+		t.Error("import removed the last active admin")
+	}
+	if owner, _ := a.GetUserByUsername("owner"); !owner.IsAdmin {
+		t.Error("last active admin was demoted")
+	}
+}
+
+// userAdminRouter routes the user management handlers as username, an admin of orgID
+func userAdminRouter(a *AuthService, username, orgID string, superAdmin bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("username", username)
+		c.Set("org_id", orgID)
+		c.Set("is_super_admin", superAdmin)
+		c.Next()
+	})
+	r.POST("/users/bulk-update", a.BulkUpdateUsersHandler)
+	r.PUT("/users/:username", a.UpdateUser)
+	r.DELETE("/users/:username", a.DeleteUser)
+	return r
+}
+
+func TestUserManagementGuards(t *testing.T) {
+	a := &AuthService{db: newTestDB(t), cfg: &config.Config{}}
+	putTestUser(t, a, User{ID: "u1", Username: "root", IsAdmin: true, IsActive: true, IsSuperAdmin: true, OrgID: "acme"})
+	putTestUser(t, a, User{ID: "u2", Username: "owner", IsAdmin: true, IsActive: true, OrgID: "acme"})
+	putTestUser(t, a, User{ID: "u3", Username: "solo", IsAdmin: true, IsActive: true, OrgID: "beta"})
+	orgAdmin := userAdminRouter(a, "owner", "acme", false)
+	superAdmin := userAdminRouter(a, "root", "", true)
+
+	tests := []struct {
+		name   string
+		router *gin.Engine
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"org admin demotes a super-admin", orgAdmin, http.MethodPut, "/users/root", `{"is_admin":false,"is_active":true}`, http.StatusForbidden},
+		{"org admin deactivates a super-admin", orgAdmin, http.MethodPut, "/users/root", `{"is_admin":true,"is_active":false}`, http.StatusForbidden},
+		{"org admin deletes a super-admin", orgAdmin, http.MethodDelete, "/users/root", "", http.StatusForbidden},
+		{"super-admin deletes an org's last admin", superAdmin, http.MethodDelete, "/users/solo", "", http.StatusBadRequest},
+		{"super-admin moves an org's last admin out", superAdmin, http.MethodPut, "/users/solo", `{"is_admin":true,"is_active":true,"org_id":""}`, http.StatusBadRequest},
+		{"super-admin deactivates an org's last admin", superAdmin, http.MethodPut, "/users/solo", `{"is_admin":true,"is_active":false}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	orgAdmin.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/bulk-update",
+		bytes.NewBufferString(`{"users":[{"username":"root","is_admin":false,"is_active":false}]}`)))
+	var resp struct {
+		Results []BulkUpdateUserResult `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Results) != 1 || resp.Results[0].Success {
+		t.Errorf("bulk update of a super-admin by an org admin: %s", w.Body.String())
+	}
+
+	if root, _ := a.GetUserByUsername("root"); !root.IsAdmin || !root.IsActive || !root.IsSuperAdmin {
+		t.Errorf("super-admin changed: %+v", root)
+	}
+	if solo, err := a.GetUserByUsername("solo"); err != nil || !solo.IsAdmin || !solo.IsActive || solo.OrgID != "beta" {
+		t.Errorf("last admin of beta changed: %+v, %v", solo, err)
+	}
+}
+
+func TestDeactivationEndsSessions(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Inactivity.DisableAfterDays = 30
+	a := newTestAuthService(t, cfg)
+	putTestUser(t, a, User{ID: "u1", Username: "root", IsAdmin: true, IsActive: true, IsSuperAdmin: true, CreatedAt: time.Now()})
+	alice := &User{ID: "u2", Username: "alice", IsActive: true, CreatedAt: time.Now()}
+	bob := &User{ID: "u3", Username: "bob", IsActive: true, CreatedAt: time.Now().Add(-60 * 24 * time.Hour)}
+	putTestUser(t, a, *alice)
+	putTestUser(t, a, *bob)
+
+	gin.SetMode(gin.TestMode)
+	api := gin.New()
+	api.GET("/me", AuthMiddleware(a), func(c *gin.Context) { c.Status(http.StatusOK) })
+	call := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	aliceToken, _, err := a.issueSession(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobToken, _, err := a.issueSession(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := call(aliceToken); code != http.StatusOK {
+		t.Fatalf("active user: status = %d, want %d", code, http.StatusOK)
+	}
+
+	// Deactivated by an admin
+	w := httptest.NewRecorder()
+	userAdminRouter(a, "root", "", true).ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/users/alice",
+		bytes.NewBufferString(`{"is_admin":false,"is_active":false}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("deactivate: status = %d, body %s", w.Code, w.Body.String())
+	}
+	if code := call(aliceToken); code != http.StatusUnauthorized {
+		t.Errorf("deactivated user: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if claims := tokenClaims(t, a, aliceToken); !a.isSessionRevoked(claims.SessionID) {
+		t.Error("session of a deactivated user not revoked")
+	}
+
+	// Disabled by the inactivity job
+	a.disableInactiveUsers()
+	if code := call(bobToken); code != http.StatusUnauthorized {
+		t.Errorf("inactive user: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if claims := tokenClaims(t, a, bobToken); !a.isSessionRevoked(claims.SessionID) {
+		t.Error("session of an inactive user not revoked")
+	}
+}
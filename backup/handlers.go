@@ -0,0 +1,81 @@
+package backup
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"s3mgr/logger"
+)
+
+// BackupHandler handles POST /api/admin/backup. It streams a backup of the
+// database as a file download. since=<version> limits it to entries written
+// after an earlier backup; the version for the next incremental backup is
+// sent in the X-Backup-Version trailer.
+func (s *Service) BackupHandler(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "backup_database", "database", "", success, err, details)
+		}
+	}
+
+	var since uint64
+	if v := c.Query("since"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be a backup version"})
+			return
+		}
+		since = parsed
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName(time.Now())))
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Trailer", "X-Backup-Version")
+	c.Status(http.StatusOK)
+
+	version, err := s.Backup(c.Writer, since)
+	details := map[string]interface{}{"since": since, "version": version}
+	if err != nil {
+		// Headers are already sent, so the client only sees a truncated file
+		logger.Error("Database backup failed", err)
+		logAudit(false, err, details)
+		return
+	}
+	c.Writer.Header().Set("X-Backup-Version", strconv.FormatUint(version, 10))
+	logAudit(true, nil, details)
+}
+
+// RestoreHandler handles POST /api/admin/restore. It loads a backup uploaded
+// as the multipart "file" field into the running database.
+func (s *Service) RestoreHandler(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "restore_database", "database", "", success, err, details)
+		}
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		logAudit(false, err, map[string]interface{}{"stage": "parse_form_file"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File required"})
+		return
+	}
+	defer file.Close()
+
+	details := map[string]interface{}{"filename": header.Filename, "size": header.Size}
+	if err := s.Restore(file); err != nil {
+		details["stage"] = "load"
+		logAudit(false, err, details)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to restore backup: " + err.Error()})
+		return
+	}
+
+	logAudit(true, nil, details)
+	c.JSON(http.StatusOK, gin.H{"message": "Backup restored"})
+}
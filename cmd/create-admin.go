@@ -12,82 +12,112 @@ import (
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
-	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/term"
+
+	"s3mgr/config"
+	"s3mgr/users"
+)
+
+// Error codes reported in -json mode
+const (
+	errCodeInvalidInput = "invalid_input"
+	errCodeWeakPassword = "weak_password"
+	errCodeUserExists   = "user_exists"
+	errCodeDBLocked     = "db_locked"
+	errCodeInternal     = "internal_error"
 )
 
-type User struct {
-	ID        string    `json:"id"`
-	Username  string    `json:"username"`
-	Password  string    `json:"password,omitempty"`
-	Email     string    `json:"email,omitempty"`
-	IsAdmin   bool      `json:"is_admin"`
-	IsActive  bool      `json:"is_active"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	LastLogin time.Time `json:"last_login,omitempty"`
+// jsonOutput switches all results and errors to JSON on stdout for scripts
+var jsonOutput bool
+
+// fail reports an error and exits with status 1. In -json mode the error is
+// printed as {"error": ..., "code": ...}; otherwise it is logged as text.
+func fail(code, message string, err error) {
+	if err != nil {
+		message = fmt.Sprintf("%s: %v", message, err)
+	}
+	if jsonOutput {
+		json.NewEncoder(os.Stdout).Encode(map[string]string{"error": message, "code": code})
+		os.Exit(1)
+	}
+	log.Fatal(message)
 }
 
 func main() {
 	var (
-		interactive = flag.Bool("interactive", false, "Interactive mode")
-		username    = flag.String("username", "", "Admin username")
-		email       = flag.String("email", "", "Admin email")
-		password    = flag.String("password", "", "Admin password (for non-interactive mode)")
-		dbPath      = flag.String("db", "s3mgr.db", "Path to the database file")
+		interactive   = flag.Bool("interactive", false, "Interactive mode")
+		username      = flag.String("username", "", "Admin username")
+		email         = flag.String("email", "", "Admin email")
+		password      = flag.String("password", "", "Admin password (for non-interactive mode)")
+		dbPath        = flag.String("db", "s3mgr.db", "Path to the database file")
+		encryptionKey = flag.String("encryption-key", os.Getenv("DB_ENCRYPTION_KEY"), "Base64 key the database is encrypted with (defaults to $DB_ENCRYPTION_KEY)")
+		orgID         = flag.String("org", "", "Organization ID the admin belongs to (empty for the default organization)")
+		superAdmin    = flag.Bool("super-admin", false, "Grant super-admin privileges across all organizations")
+		promote       = flag.Bool("promote", false, "If the user exists, make it an active admin instead of failing (the password is reset only if given)")
 	)
+	flag.BoolVar(&jsonOutput, "json", false, "Print the created user or the error as JSON")
 	flag.Parse()
 
 	// Open database
-	opts := badger.DefaultOptions(*dbPath)
-	opts.Logger = nil // Disable badger logging
+	opts, err := config.BadgerOptions(*dbPath, *encryptionKey)
+	if err != nil {
+		fail(errCodeInvalidInput, "Invalid encryption key", err)
+	}
 	db, err := badger.Open(opts)
 	if err != nil {
-		log.Fatal("Failed to open database:", err)
+		// Badger holds an exclusive lock while the server has the database open
+		if strings.Contains(err.Error(), "directory lock") {
+			fail(errCodeDBLocked, "Database is locked by another process (is the server running?)", err)
+		}
+		fail(errCodeInternal, "Failed to open database", err)
 	}
 	defer db.Close()
 
 	var adminUsername, adminEmail, adminPassword string
 
 	if *interactive {
-		// Interactive mode
+		// Interactive mode; prompts go to stderr in -json mode so stdout stays parseable
 		reader := bufio.NewReader(os.Stdin)
+		prompt := os.Stdout
+		if jsonOutput {
+			prompt = os.Stderr
+		}
 
-		fmt.Print("Enter admin username: ")
+		fmt.Fprint(prompt, "Enter admin username: ")
 		adminUsername, _ = reader.ReadString('\n')
 		adminUsername = strings.TrimSpace(adminUsername)
 
-		fmt.Print("Enter admin email (optional): ")
+		fmt.Fprint(prompt, "Enter admin email (optional): ")
 		adminEmail, _ = reader.ReadString('\n')
 		adminEmail = strings.TrimSpace(adminEmail)
 
-		fmt.Print("Enter admin password: ")
+		fmt.Fprint(prompt, "Enter admin password: ")
 		passwordBytes, err := term.ReadPassword(int(syscall.Stdin))
 		if err != nil {
-			log.Fatal("Failed to read password:", err)
+			fail(errCodeInvalidInput, "Failed to read password", err)
 		}
 		adminPassword = string(passwordBytes)
-		fmt.Println() // New line after password input
+		fmt.Fprintln(prompt) // New line after password input
 
-		fmt.Print("Confirm admin password: ")
+		fmt.Fprint(prompt, "Confirm admin password: ")
 		confirmPasswordBytes, err := term.ReadPassword(int(syscall.Stdin))
 		if err != nil {
-			log.Fatal("Failed to read password confirmation:", err)
+			fail(errCodeInvalidInput, "Failed to read password confirmation", err)
 		}
 		confirmPassword := string(confirmPasswordBytes)
-		fmt.Println() // New line after password input
+		fmt.Fprintln(prompt) // New line after password input
 
 		if adminPassword != confirmPassword {
-			log.Fatal("Passwords do not match")
+			fail(errCodeInvalidInput, "Passwords do not match", nil)
 		}
 	} else {
 		// Non-interactive mode
 		if *username == "" {
-			log.Fatal("Username is required. Use -username flag or -interactive mode")
+			fail(errCodeInvalidInput, "Username is required. Use -username flag or -interactive mode", nil)
 		}
 
-		if *password == "" {
-			log.Fatal("Password is required for non-interactive mode. Use -password flag")
+		if *password == "" && !*promote {
+			fail(errCodeInvalidInput, "Password is required for non-interactive mode. Use -password flag", nil)
 		}
 
 		adminUsername = *username
@@ -96,44 +126,65 @@ func main() {
 	}
 
 	if adminUsername == "" {
-		log.Fatal("Username cannot be empty")
+		fail(errCodeInvalidInput, "Username cannot be empty", nil)
 	}
 
-	if len(adminPassword) < 8 {
-		log.Fatal("Password must be at least 8 characters long")
+	// With -promote an empty password keeps the existing user's password
+	if (adminPassword != "" || !*promote) && len(adminPassword) < 8 {
+		fail(errCodeWeakPassword, "Password must be at least 8 characters long", nil)
 	}
 
 	// Check if user already exists
+	var existing *users.User
 	err = db.View(func(txn *badger.Txn) error {
-		_, err := txn.Get([]byte("user:" + adminUsername))
-		return err
+		item, err := txn.Get([]byte("user:" + adminUsername))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			existing = &users.User{}
+			return json.Unmarshal(val, existing)
+		})
 	})
+	if err != nil && err != badger.ErrKeyNotFound {
+		fail(errCodeInternal, "Failed to look up user", err)
+	}
 
-	if err == nil {
-		log.Fatal("User already exists:", adminUsername)
+	if existing != nil {
+		if !*promote {
+			fail(errCodeUserExists, "User already exists: "+adminUsername, nil)
+		}
+		promoteUser(db, existing, adminEmail, adminPassword, *orgID, *superAdmin)
+		return
+	}
+	if adminPassword == "" {
+		fail(errCodeInvalidInput, "Password is required to create a new user", nil)
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(adminPassword), bcrypt.DefaultCost)
+	hashedPassword, err := users.HashPassword(adminPassword)
 	if err != nil {
-		log.Fatal("Failed to hash password:", err)
+		fail(errCodeInternal, "Failed to hash password", err)
 	}
 
 	// Create admin user
-	adminUser := User{
-		ID:        fmt.Sprintf("user_%d", time.Now().UnixNano()),
-		Username:  adminUsername,
-		Password:  string(hashedPassword),
-		Email:     adminEmail,
-		IsAdmin:   true,
-		IsActive:  true,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	adminUser := users.User{
+		ID:                fmt.Sprintf("user_%d", time.Now().UnixNano()),
+		Username:          adminUsername,
+		Password:          hashedPassword,
+		Email:             adminEmail,
+		IsAdmin:           true,
+		IsActive:          true,
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+		OrgID:             *orgID,
+		IsSuperAdmin:      *superAdmin,
+		PasswordChangedAt: time.Now(),
 	}
 
 	userData, err := json.Marshal(adminUser)
 	if err != nil {
-		log.Fatal("Failed to marshal user data:", err)
+		fail(errCodeInternal, "Failed to marshal user data", err)
 	}
 
 	// Save to database
@@ -142,7 +193,12 @@ func main() {
 	})
 
 	if err != nil {
-		log.Fatal("Failed to save admin user:", err)
+		fail(errCodeInternal, "Failed to save admin user", err)
+	}
+
+	if jsonOutput {
+		printJSON(adminUser, "created")
+		return
 	}
 
 	fmt.Printf("✅ Admin user '%s' created successfully!\n", adminUsername)
@@ -150,6 +206,82 @@ func main() {
 		fmt.Printf("📧 Email: %s\n", adminEmail)
 	}
 	fmt.Printf("🔑 User ID: %s\n", adminUser.ID)
+	if adminUser.OrgID != "" {
+		fmt.Printf("🏢 Organization: %s\n", adminUser.OrgID)
+	}
+	if adminUser.IsSuperAdmin {
+		fmt.Println("🛡️  Super-admin: yes")
+	}
 	fmt.Printf("⏰ Created at: %s\n", adminUser.CreatedAt.Format(time.RFC3339))
 	fmt.Println("\nYou can now use this admin account to log in and manage users.")
 }
+
+// promoteUser makes an existing user an active admin, for recovering admin
+// access from the command line. The password, email, organization and
+// super-admin flag are only changed when given.
+func promoteUser(db *badger.DB, user *users.User, email, password, orgID string, superAdmin bool) {
+	now := time.Now()
+	if password != "" {
+		hashedPassword, err := users.HashPassword(password)
+		if err != nil {
+			fail(errCodeInternal, "Failed to hash password", err)
+		}
+		user.Password = hashedPassword
+		user.PasswordChangedAt = now
+		user.MustChangePassword = false
+	}
+	if !user.IsActive {
+		// Restart the inactivity clock so the account is not disabled again right away
+		user.ReactivatedAt = now
+	}
+	user.IsAdmin = true
+	user.IsActive = true
+	if email != "" {
+		user.Email = email
+	}
+	if orgID != "" {
+		user.OrgID = orgID
+	}
+	if superAdmin {
+		user.IsSuperAdmin = true
+	}
+	user.UpdatedAt = now
+
+	userData, err := json.Marshal(user)
+	if err != nil {
+		fail(errCodeInternal, "Failed to marshal user data", err)
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("user:"+user.Username), userData)
+	})
+	if err != nil {
+		fail(errCodeInternal, "Failed to save user", err)
+	}
+
+	if jsonOutput {
+		printJSON(*user, "promoted")
+		return
+	}
+
+	fmt.Printf("✅ User '%s' promoted to active admin!\n", user.Username)
+	fmt.Printf("🔑 User ID: %s\n", user.ID)
+	if password != "" {
+		fmt.Println("🔒 Password: reset")
+	} else {
+		fmt.Println("🔒 Password: unchanged")
+	}
+	if user.IsSuperAdmin {
+		fmt.Println("🛡️  Super-admin: yes")
+	}
+}
+
+// printJSON prints user for -json mode along with what was done to it
+// ("created" or "promoted"). The password hash and history are left out.
+func printJSON(user users.User, action string) {
+	user.Password = ""
+	user.PasswordHistory = nil
+	json.NewEncoder(os.Stdout).Encode(struct {
+		users.User
+		Action string `json:"action"`
+	}{user, action})
+}
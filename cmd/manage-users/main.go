@@ -0,0 +1,262 @@
+// Command manage-users inspects and fixes user accounts directly in the
+// database while the server is stopped, e.g. to re-enable a locked-out admin.
+//
+//	go run ./cmd/manage-users -db s3mgr.db list
+//	go run ./cmd/manage-users -db s3mgr.db set-active alice false
+//	go run ./cmd/manage-users -db s3mgr.db set-admin alice true
+//	go run ./cmd/manage-users -db s3mgr.db delete alice
+//
+// Pass -audit-db when the server keeps its audit log in a separate database
+// (audit.database_path), so the changes are audited there.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"s3mgr/audit"
+	"s3mgr/config"
+	"s3mgr/logger"
+	"s3mgr/users"
+)
+
+const usage = `Usage: manage-users [-db path] [-audit-db path] [-audit-chain-key key] [-json] <command> [args]
+
+Commands:
+  list                              List all users
+  set-active <username> true|false  Enable or disable a user
+  set-admin <username> true|false   Grant or revoke admin privileges
+  delete <username>                 Delete a user
+`
+
+// tool identifies this command in the audit details of every change it makes
+const tool = "manage-users"
+
+func main() {
+	// A separate flag set keeps flags registered by dependencies out of the usage text
+	flags := flag.NewFlagSet("manage-users", flag.ExitOnError)
+	dbPath := flags.String("db", "s3mgr.db", "Path to the database file")
+	auditDBPath := flags.String("audit-db", os.Getenv("AUDIT_DB_PATH"), "Path to the separate audit log database, if the server uses one (defaults to $AUDIT_DB_PATH)")
+	encryptionKey := flags.String("encryption-key", os.Getenv("DB_ENCRYPTION_KEY"), "Base64 key the database is encrypted with (defaults to $DB_ENCRYPTION_KEY)")
+	chainKey := flags.String("audit-chain-key", os.Getenv("AUDIT_CHAIN_KEY"), "Key the server's audit hash chain is keyed with, if any (defaults to $AUDIT_CHAIN_KEY)")
+	jsonOutput := flags.Bool("json", false, "Print list output as JSON")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage+"\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	args := flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	// Open database
+	db := openDB(*dbPath, *encryptionKey)
+	defer db.Close()
+
+	// Audit events go where the server keeps them, which is the main
+	// database unless audit.database_path is set
+	auditDB := db
+	if *auditDBPath != "" {
+		auditDB = openDB(*auditDBPath, *encryptionKey)
+		defer auditDB.Close()
+	}
+
+	// Audit failures are logged to stderr
+	logger.Initialize(logger.LogConfig{Level: "warn"})
+	auditService := audit.NewAuditService(auditDB)
+	// Without the server's key, entries written here would break a keyed chain
+	auditService.SetChainKey(*chainKey)
+
+	var err error
+
+	switch command := args[0]; command {
+	case "list":
+		err = listUsers(db, *jsonOutput)
+	case "set-active", "set-admin":
+		if len(args) != 3 {
+			err = fmt.Errorf("usage: %s <username> true|false", command)
+			break
+		}
+		value, parseErr := strconv.ParseBool(args[2])
+		if parseErr != nil {
+			err = fmt.Errorf("value must be true or false, got %q", args[2])
+			break
+		}
+		err = setFlag(db, auditService, args[1], command, value)
+	case "delete":
+		if len(args) != 2 {
+			err = fmt.Errorf("usage: delete <username>")
+			break
+		}
+		err = deleteUser(db, auditService, args[1])
+	default:
+		closeDBs(db, auditDB)
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		// log.Fatal would skip the deferred Close and leave the database unflushed
+		closeDBs(db, auditDB)
+		log.Fatal(err)
+	}
+}
+
+// openDB opens the Badger database at path, exiting if it can't
+func openDB(path, encryptionKey string) *badger.DB {
+	opts, err := config.BadgerOptions(path, encryptionKey)
+	if err != nil {
+		log.Fatal("Invalid encryption key: ", err)
+	}
+	db, err := badger.Open(opts)
+	if err != nil {
+		// Badger holds an exclusive lock while the server has the database open
+		if strings.Contains(err.Error(), "directory lock") {
+			log.Fatalf("Database %s is locked by another process; stop the server first", path)
+		}
+		log.Fatalf("Failed to open database %s: %v", path, err)
+	}
+	return db
+}
+
+// closeDBs closes the main database and the audit database when it is separate
+func closeDBs(db, auditDB *badger.DB) {
+	db.Close()
+	if auditDB != db {
+		auditDB.Close()
+	}
+}
+
+// listUsers prints every user as a table, or as JSON without password hashes
+func listUsers(db *badger.DB, jsonOutput bool) error {
+	var all []users.User
+	err := db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte("user:")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var user users.User
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &user)
+			})
+			if err != nil {
+				return err
+			}
+			user.Password = ""
+			user.PasswordHistory = nil
+			all = append(all, user)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read users: %v", err)
+	}
+
+	if jsonOutput {
+		if all == nil {
+			all = []users.User{}
+		}
+		return json.NewEncoder(os.Stdout).Encode(all)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USERNAME\tID\tADMIN\tSUPER-ADMIN\tACTIVE\tORG\tLAST LOGIN")
+	for _, user := range all {
+		lastLogin := "never"
+		if !user.LastLogin.IsZero() {
+			lastLogin = user.LastLogin.Format(time.RFC3339)
+		}
+		org := user.OrgID
+		if org == "" {
+			org = "default"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%v\t%v\t%v\t%s\t%s\n",
+			user.Username, user.ID, user.IsAdmin, user.IsSuperAdmin, user.IsActive, org, lastLogin)
+	}
+	return w.Flush()
+}
+
+// setFlag sets a user's active ("set-active") or admin ("set-admin") flag
+func setFlag(db *badger.DB, auditService *audit.AuditService, username, command string, value bool) error {
+	var user users.User
+	err := db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("user:" + username))
+		if err != nil {
+			return err
+		}
+		if err := item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &user)
+		}); err != nil {
+			return err
+		}
+
+		if command == "set-active" {
+			if value && !user.IsActive {
+				// Restart the inactivity clock so the account is not disabled again right away
+				user.ReactivatedAt = time.Now()
+			}
+			user.IsActive = value
+		} else {
+			user.IsAdmin = value
+		}
+		user.UpdatedAt = time.Now()
+
+		userData, err := json.Marshal(user)
+		if err != nil {
+			return err
+		}
+		return txn.Set([]byte("user:"+username), userData)
+	})
+	if err == badger.ErrKeyNotFound {
+		return fmt.Errorf("user not found: %s", username)
+	}
+	field := map[string]string{"set-active": "is_active", "set-admin": "is_admin"}[command]
+	auditService.LogSystemEvent(user.OrgID, "update_user", "user", username, err == nil, err,
+		map[string]interface{}{field: value, "tool": tool})
+	if err != nil {
+		return fmt.Errorf("failed to update user: %v", err)
+	}
+
+	fmt.Printf("✅ User '%s' updated: %s=%v\n", username, field, value)
+	return nil
+}
+
+// deleteUser removes a user's record
+func deleteUser(db *badger.DB, auditService *audit.AuditService, username string) error {
+	var user users.User
+	err := db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("user:" + username))
+		if err != nil {
+			return err
+		}
+		if err := item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &user)
+		}); err != nil {
+			return err
+		}
+		return txn.Delete([]byte("user:" + username))
+	})
+	if err == badger.ErrKeyNotFound {
+		return fmt.Errorf("user not found: %s", username)
+	}
+	auditService.LogSystemEvent(user.OrgID, "delete_user", "user", username, err == nil, err,
+		map[string]interface{}{"tool": tool})
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %v", err)
+	}
+
+	fmt.Printf("🗑️  User '%s' deleted\n", username)
+	return nil
+}
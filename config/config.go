@@ -3,19 +3,38 @@ package config
 import (
 	"flag"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 	"s3mgr/logger"
 )
 
 type Config struct {
-	Logging     logger.LogConfig `yaml:"logging"`
-	Server      ServerConfig     `yaml:"server"`
-	Database    DatabaseConfig   `yaml:"database"`
-	JWT         JWTConfig        `yaml:"jwt"`
-	MinIOAdmin  MinIOAdminConfig `yaml:"minio_admin"`
-	MinIODefault MinIODefaultConfig `yaml:"minio_default"`
+	Logging       logger.LogConfig    `yaml:"logging"`
+	Server        ServerConfig        `yaml:"server"`
+	Database      DatabaseConfig      `yaml:"database"`
+	JWT           JWTConfig           `yaml:"jwt"`
+	Session       SessionConfig       `yaml:"session"`
+	MinIOAdmin    MinIOAdminConfig    `yaml:"minio_admin"`
+	MinIODefault  MinIODefaultConfig  `yaml:"minio_default"`
+	Password      PasswordConfig      `yaml:"password"`
+	LoginThrottle LoginThrottleConfig `yaml:"login_throttle"`
+	Security      SecurityConfig      `yaml:"security"`
+	RateLimit     RateLimitConfig     `yaml:"ratelimit"`
+	Inactivity    InactivityConfig    `yaml:"inactivity"`
+	Upload        UploadConfig        `yaml:"upload"`
+	Preview       PreviewConfig       `yaml:"preview"`
+	HealthCheck   HealthCheckConfig   `yaml:"health_check"`
+	Audit         AuditConfig         `yaml:"audit"`
+	Delivery      DeliveryConfig      `yaml:"delivery"`
+	Storage       StorageConfig       `yaml:"storage"`
+	Backup        BackupConfig        `yaml:"backup"`
 }
 
 type ServerConfig struct {
@@ -23,15 +42,209 @@ type ServerConfig struct {
 	Host         string `yaml:"host"`
 	ReadTimeout  int    `yaml:"read_timeout"`
 	WriteTimeout int    `yaml:"write_timeout"`
+	StaticDir    string `yaml:"static_dir"` // Serve the built frontend from this directory (empty disables)
+	BasePath     string `yaml:"base_path"`  // Prefix for all routes, e.g. "/s3mgr" (empty serves from the root)
+	// CORSOrigins lists the origins allowed to call the API from a browser, e.g.
+	// "https://s3mgr.example.com". "*" allows any origin and requires
+	// CORSDisableCredentials.
+	CORSOrigins            []string `yaml:"cors_origins"`
+	CORSDisableCredentials bool     `yaml:"cors_disable_credentials"` // Don't let browsers send cookies or auth headers cross-origin
+	// TrustedProxies lists the IPs and CIDR ranges of reverse proxies whose
+	// X-Forwarded-For header gives the client IP. Empty trusts none, so the
+	// client IP is the connection's remote address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// AllowsAllOrigins reports whether CORS is open to any origin ("*")
+func (s ServerConfig) AllowsAllOrigins() bool {
+	return len(s.CORSOrigins) == 1 && s.CORSOrigins[0] == "*"
+}
+
+// RoutePrefix returns the base path as "/prefix" without a trailing slash, or ""
+func (s ServerConfig) RoutePrefix() string {
+	prefix := strings.Trim(s.BasePath, "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
 }
 
 type DatabaseConfig struct {
-	Path string `yaml:"path"`
+	Path string `yaml:"path"` // Set to ":memory:" for a non-persistent in-memory database
+	// EncryptionKey encrypts the database (and the audit database) at rest with
+	// this base64-encoded 32-byte key. An existing database cannot switch keys
+	// in place; it has to be backed up and restored into a new one.
+	EncryptionKey string `yaml:"encryption_key"`
 }
 
+// InMemoryDatabasePath selects an in-memory Badger database that never touches disk
+const InMemoryDatabasePath = ":memory:"
+
 type JWTConfig struct {
-	Secret      string `yaml:"secret"`
-	ExpiryHours int    `yaml:"expiry_hours"`
+	Secret            string `yaml:"secret"`
+	ExpiryHours       int    `yaml:"expiry_hours"`
+	RefreshExpiryDays int    `yaml:"refresh_expiry_days"` // Lifetime of a login session; refreshing does not extend it
+	Issuer            string `yaml:"issuer"`              // "iss" claim set on issued tokens and required on incoming ones (empty skips it)
+	Audience          string `yaml:"audience"`            // "aud" claim set on issued tokens and required on incoming ones (empty skips it)
+}
+
+// Session store backends
+const (
+	SessionStoreBadger = "badger"
+	SessionStoreRedis  = "redis"
+)
+
+type SessionConfig struct {
+	Store string      `yaml:"store"` // "badger" keeps sessions in the local database; "redis" shares them between instances
+	Redis RedisConfig `yaml:"redis"`
+}
+
+type RedisConfig struct {
+	Addr      string `yaml:"addr"`       // host:port of the Redis server
+	Username  string `yaml:"username"`   // ACL username (optional)
+	Password  string `yaml:"password"`   // Password (optional)
+	DB        int    `yaml:"db"`         // Database number
+	KeyPrefix string `yaml:"key_prefix"` // Prepended to every key so instances can share a Redis server with other apps
+}
+
+// placeholderJWTSecrets are the example secrets shipped in this repository's
+// config and docs; tokens signed with them can be forged by anyone
+var placeholderJWTSecrets = map[string]bool{
+	"your-secret-key":                                     true,
+	"your-secret-key-here":                                true,
+	"your-production-secret":                              true,
+	"your-production-jwt-secret":                          true,
+	"your-super-secret-jwt-key-change-this-in-production": true,
+}
+
+// InsecureSecret reports whether the JWT secret is empty or a known placeholder
+func (j JWTConfig) InsecureSecret() bool {
+	return j.Secret == "" || placeholderJWTSecrets[j.Secret]
+}
+
+type PasswordConfig struct {
+	HistorySize  int            `yaml:"history_size"`  // Number of recent passwords that cannot be reused (0 disables)
+	MaxAgeDays   int            `yaml:"max_age_days"`  // Days before a password must be changed (0 disables)
+	ExemptAdmins bool           `yaml:"exempt_admins"` // Admins are not subject to password expiry
+	Policy       PasswordPolicy `yaml:"policy"`
+}
+
+// PasswordPolicy is the complexity every new password must meet
+type PasswordPolicy struct {
+	MinLength        int  `yaml:"min_length"`        // Minimum number of characters
+	RequireUpper     bool `yaml:"require_upper"`     // At least one uppercase letter
+	RequireLower     bool `yaml:"require_lower"`     // At least one lowercase letter
+	RequireDigit     bool `yaml:"require_digit"`     // At least one digit
+	RequireSymbol    bool `yaml:"require_symbol"`    // At least one character that is not a letter or digit
+	DisallowUsername bool `yaml:"disallow_username"` // Password must not contain the username
+}
+
+type LoginThrottleConfig struct {
+	BaseDelayMS  int `yaml:"base_delay_ms"` // Delay after the first failed login, doubled per consecutive failure (0 disables)
+	MaxDelayMS   int `yaml:"max_delay_ms"`  // Upper bound for the delay
+	ResetMinutes int `yaml:"reset_minutes"` // Failures older than this are forgotten
+}
+
+type SecurityConfig struct {
+	LockoutThreshold int `yaml:"lockout_threshold"` // Failed logins that lock an account (negative disables lockout)
+	LockoutMinutes   int `yaml:"lockout_minutes"`   // How long a locked account stays locked; also the window failures are counted in
+	// IsolationCheck lists a sample of configs at startup to verify the backend honors key prefixes
+	IsolationCheck       bool `yaml:"isolation_check"`
+	IsolationCheckSample int  `yaml:"isolation_check_sample"` // Configs checked, one per distinct bucket
+	// ExportLimit caps the exports (users, configs, audit logs) one user may run per window
+	ExportLimit         int `yaml:"export_limit"`          // Exports allowed per window (negative disables the limit)
+	ExportWindowMinutes int `yaml:"export_window_minutes"` // Length of the sliding export window
+}
+
+// RateLimitConfig limits how fast one client IP may call the API, using a
+// token bucket that refills at the per-minute rate and holds a minute's worth
+type RateLimitConfig struct {
+	RequestsPerMinute     int      `yaml:"requests_per_minute"`      // Requests per client IP (negative disables the limiter)
+	AuthRequestsPerMinute int      `yaml:"auth_requests_per_minute"` // Stricter limit for /api/auth/*, counted separately
+	Allowlist             []string `yaml:"allowlist"`                // IPs or CIDR ranges that are never limited, e.g. ["10.0.0.0/8"]
+}
+
+type InactivityConfig struct {
+	DisableAfterDays     int  `yaml:"disable_after_days"`     // Disable accounts with no login for this many days (0 disables)
+	ExemptAdmins         bool `yaml:"exempt_admins"`          // Admins are never disabled for inactivity
+	CheckIntervalMinutes int  `yaml:"check_interval_minutes"` // How often the inactivity scan runs
+}
+
+type UploadConfig struct {
+	SpoolToDisk         bool     `yaml:"spool_to_disk"`         // Spool large uploads to a temp file instead of buffering in memory
+	TempDir             string   `yaml:"temp_dir"`              // Directory for spooled uploads (empty uses the OS temp dir)
+	Concurrency         int      `yaml:"concurrency"`           // Parts uploaded in parallel per multipart upload
+	PartSizeMB          int      `yaml:"part_size_mb"`          // Multipart part size in MB (S3 minimum is 5)
+	VerifyMultipart     bool     `yaml:"verify_multipart"`      // Check the stored size after a multipart upload completes, deleting the object on mismatch
+	AllowedACLs         []string `yaml:"allowed_acls"`          // Canned ACLs users may request on upload
+	MaxSizeMB           int      `yaml:"max_size_mb"`           // Largest accepted upload in MB (0 means no limit)
+	AllowedContentTypes []string `yaml:"allowed_content_types"` // Accepted upload types, e.g. "image/*" (empty allows any)
+	ExpirySweepSeconds  int      `yaml:"expiry_sweep_seconds"`  // How often uploads with expires_in are checked for deletion
+	MaxFilenameLength   int      `yaml:"max_filename_length"`   // Longest accepted filename in characters
+	FilenameCharset     string   `yaml:"filename_charset"`      // "unicode" allows any printable character; "safe" restricts to FilenameSafeChars
+}
+
+// Filename character policies for uploads. Control characters and invalid
+// UTF-8 are rejected under both.
+const (
+	FilenameCharsetUnicode = "unicode"
+	FilenameCharsetSafe    = "safe"
+)
+
+// FilenameSafeChars are the punctuation characters allowed, besides ASCII
+// letters and digits, by the "safe" filename charset. They match the object
+// key characters S3 documents as safe for any application.
+const FilenameSafeChars = "!-_.*'()/"
+
+// MinPartSizeMB is the smallest multipart part size S3 accepts
+const MinPartSizeMB = 5
+
+type StorageConfig struct {
+	RequestTimeoutSeconds int    `yaml:"request_timeout_seconds"` // How long a storage request may wait for the backend to respond (0 disables); configs can override it
+	GlobalKeyPrefix       string `yaml:"global_key_prefix"`       // Prefix prepended to every object key, e.g. "s3mgr/", to namespace the app in a shared bucket
+	MaxConcurrentPerUser  int    `yaml:"max_concurrent_per_user"` // Uploads and downloads one user may run at once (0 = unlimited)
+}
+
+// MaxRequestTimeoutSeconds bounds the request timeout a storage config may set
+const MaxRequestTimeoutSeconds = 3600
+
+type PreviewConfig struct {
+	MaxTextBytes int64 `yaml:"max_text_bytes"` // Maximum bytes returned for text previews
+}
+
+type HealthCheckConfig struct {
+	DownTTLSeconds   int `yaml:"down_ttl_seconds"`  // Fail fast (503) for this long after a backend connection failure
+	FailureThreshold int `yaml:"failure_threshold"` // Consecutive failures before failing fast
+}
+
+type AuditConfig struct {
+	RedactFields   []string `yaml:"redact_fields"`   // Detail keys whose values are masked (case-insensitive)
+	RedactPatterns []string `yaml:"redact_patterns"` // Regular expressions masked in detail values, errors and resource IDs
+	ForwardURL     string   `yaml:"forward_url"`     // Every stored audit entry is POSTed here as JSON, e.g. a SIEM collector (empty disables)
+	DatabasePath   string   `yaml:"database_path"`   // Keep audit logs in their own Badger database at this path (empty shares the main database)
+	// ChainKey keys the audit hash chain with HMAC-SHA256 so that database
+	// access alone cannot forge it; keep it outside the database (empty uses plain SHA-256)
+	ChainKey string `yaml:"chain_key"`
+}
+
+type DeliveryConfig struct {
+	MaxAttempts           int `yaml:"max_attempts"`            // Attempts before a delivery is moved to the dead-letter list
+	InitialBackoffSeconds int `yaml:"initial_backoff_seconds"` // Wait after the first failure, doubled per further failure
+	MaxBackoffSeconds     int `yaml:"max_backoff_seconds"`     // Upper bound for the wait between attempts
+	TimeoutSeconds        int `yaml:"timeout_seconds"`         // HTTP timeout per attempt
+	PollSeconds           int `yaml:"poll_seconds"`            // How often pending deliveries are checked for a due retry
+}
+
+type BackupConfig struct {
+	Interval string `yaml:"interval"` // How often to write a scheduled backup, e.g. "24h" (empty disables)
+	Dir      string `yaml:"dir"`      // Directory scheduled backups are written to
+	Keep     int    `yaml:"keep"`     // Number of scheduled backups to retain; older ones are deleted
+}
+
+// IntervalDuration returns the scheduled backup interval, or 0 if scheduling is disabled
+func (b BackupConfig) IntervalDuration() time.Duration {
+	d, _ := time.ParseDuration(b.Interval)
+	return d
 }
 
 type MinIOAdminConfig struct {
@@ -67,6 +280,10 @@ func LoadConfig() (*Config, error) {
 	// Override with environment variables if present
 	overrideWithEnv(config)
 
+	if err := validate(config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+
 	AppConfig = config
 	return config, nil
 }
@@ -108,6 +325,12 @@ func setDefaults(config *Config) {
 	if config.Logging.Format == "" {
 		config.Logging.Format = "json"
 	}
+	if config.Logging.BodyMaxBytes == 0 {
+		config.Logging.BodyMaxBytes = 2048
+	}
+	if config.Logging.ExcludePaths == nil {
+		config.Logging.ExcludePaths = []string{"/health", "/metrics"}
+	}
 
 	// Server defaults
 	if config.Server.Port == 0 {
@@ -122,6 +345,9 @@ func setDefaults(config *Config) {
 	if config.Server.WriteTimeout == 0 {
 		config.Server.WriteTimeout = 30
 	}
+	if len(config.Server.CORSOrigins) == 0 {
+		config.Server.CORSOrigins = []string{"http://localhost:5173", "http://localhost:3000"}
+	}
 
 	// Database defaults
 	if config.Database.Path == "" {
@@ -132,6 +358,255 @@ func setDefaults(config *Config) {
 	if config.JWT.ExpiryHours == 0 {
 		config.JWT.ExpiryHours = 24
 	}
+	if config.JWT.RefreshExpiryDays == 0 {
+		config.JWT.RefreshExpiryDays = 30
+	}
+
+	// Session defaults
+	if config.Session.Store == "" {
+		config.Session.Store = SessionStoreBadger
+	}
+	if config.Session.Redis.KeyPrefix == "" {
+		config.Session.Redis.KeyPrefix = "s3mgr:"
+	}
+
+	// Password policy defaults
+	if config.Password.Policy.MinLength == 0 {
+		config.Password.Policy.MinLength = 8
+	}
+
+	// Login throttle defaults
+	if config.LoginThrottle.MaxDelayMS == 0 {
+		config.LoginThrottle.MaxDelayMS = 5000
+	}
+	if config.LoginThrottle.ResetMinutes == 0 {
+		config.LoginThrottle.ResetMinutes = 15
+	}
+
+	// Security defaults
+	if config.Security.LockoutThreshold == 0 {
+		config.Security.LockoutThreshold = 5
+	}
+	if config.Security.LockoutMinutes == 0 {
+		config.Security.LockoutMinutes = 15
+	}
+	if config.Security.IsolationCheckSample == 0 {
+		config.Security.IsolationCheckSample = 3
+	}
+	if config.Security.ExportLimit == 0 {
+		config.Security.ExportLimit = 10
+	}
+	if config.Security.ExportWindowMinutes == 0 {
+		config.Security.ExportWindowMinutes = 60
+	}
+
+	// Inactivity defaults
+	if config.Inactivity.CheckIntervalMinutes == 0 {
+		config.Inactivity.CheckIntervalMinutes = 60
+	}
+
+	// Preview defaults
+	if config.Preview.MaxTextBytes == 0 {
+		config.Preview.MaxTextBytes = 64 * 1024
+	}
+
+	// Health check defaults
+	if config.HealthCheck.DownTTLSeconds == 0 {
+		config.HealthCheck.DownTTLSeconds = 30
+	}
+	if config.HealthCheck.FailureThreshold == 0 {
+		config.HealthCheck.FailureThreshold = 3
+	}
+
+	// Upload defaults
+	if config.Upload.ExpirySweepSeconds == 0 {
+		config.Upload.ExpirySweepSeconds = 60
+	}
+	if config.Upload.Concurrency == 0 {
+		config.Upload.Concurrency = 5
+	}
+	if config.Upload.PartSizeMB == 0 {
+		config.Upload.PartSizeMB = MinPartSizeMB
+	}
+	if len(config.Upload.AllowedACLs) == 0 {
+		config.Upload.AllowedACLs = []string{"private"}
+	}
+	if config.Upload.MaxFilenameLength == 0 {
+		config.Upload.MaxFilenameLength = 255
+	}
+	if config.Upload.FilenameCharset == "" {
+		config.Upload.FilenameCharset = FilenameCharsetUnicode
+	}
+
+	// Rate limit defaults
+	if config.RateLimit.RequestsPerMinute == 0 {
+		config.RateLimit.RequestsPerMinute = 300
+	}
+	if config.RateLimit.AuthRequestsPerMinute == 0 {
+		config.RateLimit.AuthRequestsPerMinute = 20
+	}
+
+	// Storage defaults
+	if config.Storage.RequestTimeoutSeconds == 0 {
+		config.Storage.RequestTimeoutSeconds = 30
+	}
+
+	// Delivery defaults
+	if config.Delivery.MaxAttempts == 0 {
+		config.Delivery.MaxAttempts = 8
+	}
+	if config.Delivery.InitialBackoffSeconds == 0 {
+		config.Delivery.InitialBackoffSeconds = 10
+	}
+	if config.Delivery.MaxBackoffSeconds == 0 {
+		config.Delivery.MaxBackoffSeconds = 3600
+	}
+	if config.Delivery.TimeoutSeconds == 0 {
+		config.Delivery.TimeoutSeconds = 10
+	}
+	if config.Delivery.PollSeconds == 0 {
+		config.Delivery.PollSeconds = 5
+	}
+
+	// Backup defaults
+	if config.Backup.Dir == "" {
+		config.Backup.Dir = "backups"
+	}
+	if config.Backup.Keep == 0 {
+		config.Backup.Keep = 7
+	}
+}
+
+func validate(config *Config) error {
+	if err := validateCORSOrigins(config.Server); err != nil {
+		return err
+	}
+	if _, err := DecodeEncryptionKey(config.Database.EncryptionKey); err != nil {
+		return err
+	}
+	if config.Upload.PartSizeMB < MinPartSizeMB {
+		return fmt.Errorf("upload.part_size_mb must be at least %d", MinPartSizeMB)
+	}
+	if config.Upload.Concurrency < 1 {
+		return fmt.Errorf("upload.concurrency must be at least 1")
+	}
+	if config.Upload.MaxFilenameLength < 1 {
+		return fmt.Errorf("upload.max_filename_length must be at least 1")
+	}
+	if config.Upload.FilenameCharset != FilenameCharsetUnicode && config.Upload.FilenameCharset != FilenameCharsetSafe {
+		return fmt.Errorf("upload.filename_charset must be %q or %q", FilenameCharsetUnicode, FilenameCharsetSafe)
+	}
+	switch config.Session.Store {
+	case SessionStoreBadger:
+	case SessionStoreRedis:
+		if config.Session.Redis.Addr == "" {
+			return fmt.Errorf("session.redis.addr is required when session.store is %q", SessionStoreRedis)
+		}
+	default:
+		return fmt.Errorf("session.store must be %q or %q", SessionStoreBadger, SessionStoreRedis)
+	}
+	for _, pattern := range config.Audit.RedactPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("audit.redact_patterns: invalid pattern %q: %v", pattern, err)
+		}
+	}
+	// A 0 in the config file means the default, so only the environment can set it
+	if config.Security.LockoutThreshold == 0 {
+		return fmt.Errorf("SECURITY_LOCKOUT_THRESHOLD must be at least 1, or negative to disable lockout (0 in the config file means the default of 5)")
+	}
+	if config.Audit.DatabasePath != "" && config.Audit.DatabasePath != InMemoryDatabasePath &&
+		filepath.Clean(config.Audit.DatabasePath) == filepath.Clean(config.Database.Path) {
+		return fmt.Errorf("audit.database_path must differ from database.path")
+	}
+	if config.Audit.ChainKey != "" && len(config.Audit.ChainKey) < 32 {
+		return fmt.Errorf("audit.chain_key must be at least 32 characters")
+	}
+	if config.HealthCheck.FailureThreshold < 1 {
+		return fmt.Errorf("health_check.failure_threshold must be at least 1")
+	}
+	if config.Logging.BodyMaxBytes < 1 {
+		return fmt.Errorf("logging.body_max_bytes must be at least 1")
+	}
+	if config.Security.ExportWindowMinutes < 1 {
+		return fmt.Errorf("security.export_window_minutes must be at least 1")
+	}
+	for _, entry := range config.Server.TrustedProxies {
+		if net.ParseIP(entry) == nil {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return fmt.Errorf("server.trusted_proxies: %q is not an IP address or CIDR range", entry)
+			}
+		}
+	}
+	for _, entry := range config.RateLimit.Allowlist {
+		if net.ParseIP(entry) == nil {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return fmt.Errorf("ratelimit.allowlist: %q is not an IP address or CIDR range", entry)
+			}
+		}
+	}
+	if config.Audit.ForwardURL != "" {
+		u, err := url.Parse(config.Audit.ForwardURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("audit.forward_url must be an http or https URL")
+		}
+	}
+	if config.Storage.MaxConcurrentPerUser < 0 {
+		return fmt.Errorf("storage.max_concurrent_per_user must not be negative")
+	}
+	if config.Storage.RequestTimeoutSeconds < 0 {
+		config.Storage.RequestTimeoutSeconds = 0
+	}
+	if config.Storage.RequestTimeoutSeconds > MaxRequestTimeoutSeconds {
+		return fmt.Errorf("storage.request_timeout_seconds must be at most %d", MaxRequestTimeoutSeconds)
+	}
+	// Normalize the global key prefix to "a/b/" form so keys are built by concatenation
+	if prefix := strings.Trim(strings.TrimSpace(config.Storage.GlobalKeyPrefix), "/"); prefix != "" {
+		for _, segment := range strings.Split(prefix, "/") {
+			if segment == "" || segment == "." || segment == ".." {
+				return fmt.Errorf("storage.global_key_prefix must not contain empty, '.' or '..' segments")
+			}
+		}
+		config.Storage.GlobalKeyPrefix = prefix + "/"
+	} else {
+		config.Storage.GlobalKeyPrefix = ""
+	}
+	if config.Delivery.MaxAttempts < 1 {
+		return fmt.Errorf("delivery.max_attempts must be at least 1")
+	}
+	if config.Delivery.InitialBackoffSeconds < 1 || config.Delivery.MaxBackoffSeconds < config.Delivery.InitialBackoffSeconds {
+		return fmt.Errorf("delivery.initial_backoff_seconds must be at least 1 and no more than delivery.max_backoff_seconds")
+	}
+	if config.Backup.Interval != "" {
+		d, err := time.ParseDuration(config.Backup.Interval)
+		if err != nil || d < time.Minute {
+			return fmt.Errorf("backup.interval must be a duration of at least 1m, e.g. \"24h\"")
+		}
+	}
+	if config.Backup.Keep < 1 {
+		return fmt.Errorf("backup.keep must be at least 1")
+	}
+	return nil
+}
+
+// validateCORSOrigins checks that every origin is a bare scheme://host[:port]
+// as browsers send it, and that "*" is used alone and without credentials
+func validateCORSOrigins(server ServerConfig) error {
+	for _, origin := range server.CORSOrigins {
+		if origin == "*" {
+			if len(server.CORSOrigins) > 1 {
+				return fmt.Errorf("server.cors_origins: \"*\" must be the only origin")
+			}
+			if !server.CORSDisableCredentials {
+				return fmt.Errorf("server.cors_origins: \"*\" requires server.cors_disable_credentials")
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.User != nil {
+			return fmt.Errorf("server.cors_origins: %q must be an origin like \"https://example.com\" without a path", origin)
+		}
+	}
+	return nil
 }
 
 func overrideWithEnv(config *Config) {
@@ -142,12 +617,155 @@ func overrideWithEnv(config *Config) {
 	if val := os.Getenv("LOG_FILE"); val != "" {
 		config.Logging.File = val
 	}
+	if val := os.Getenv("LOG_BODIES"); val != "" {
+		config.Logging.LogBodies = val == "true"
+	}
+	if val, ok := os.LookupEnv("LOG_EXCLUDE_PATHS"); ok {
+		config.Logging.ExcludePaths = []string{}
+		for _, p := range strings.Split(val, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				config.Logging.ExcludePaths = append(config.Logging.ExcludePaths, p)
+			}
+		}
+	}
 	if val := os.Getenv("SERVER_PORT"); val != "" {
 		fmt.Sscanf(val, "%d", &config.Server.Port)
 	}
+	if val := os.Getenv("BASE_PATH"); val != "" {
+		config.Server.BasePath = val
+	}
+	if val := os.Getenv("STATIC_DIR"); val != "" {
+		config.Server.StaticDir = val
+	}
+	if val := os.Getenv("DB_PATH"); val != "" {
+		config.Database.Path = val
+	}
+	if val := os.Getenv("DB_ENCRYPTION_KEY"); val != "" {
+		config.Database.EncryptionKey = val
+	}
 	if val := os.Getenv("JWT_SECRET"); val != "" {
 		config.JWT.Secret = val
 	}
+	if val := os.Getenv("JWT_ISSUER"); val != "" {
+		config.JWT.Issuer = val
+	}
+	if val := os.Getenv("JWT_AUDIENCE"); val != "" {
+		config.JWT.Audience = val
+	}
+	if val := os.Getenv("SESSION_STORE"); val != "" {
+		config.Session.Store = val
+	}
+	if val := os.Getenv("REDIS_ADDR"); val != "" {
+		config.Session.Redis.Addr = val
+	}
+	if val := os.Getenv("REDIS_PASSWORD"); val != "" {
+		config.Session.Redis.Password = val
+	}
+	if val := os.Getenv("CORS_ORIGINS"); val != "" {
+		config.Server.CORSOrigins = nil
+		for _, origin := range strings.Split(val, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				config.Server.CORSOrigins = append(config.Server.CORSOrigins, origin)
+			}
+		}
+	}
+	if val := os.Getenv("CORS_DISABLE_CREDENTIALS"); val != "" {
+		config.Server.CORSDisableCredentials = val == "true"
+	}
+	if val := os.Getenv("TRUSTED_PROXIES"); val != "" {
+		config.Server.TrustedProxies = nil
+		for _, entry := range strings.Split(val, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				config.Server.TrustedProxies = append(config.Server.TrustedProxies, entry)
+			}
+		}
+	}
+	if val := os.Getenv("STORAGE_REQUEST_TIMEOUT_SECONDS"); val != "" {
+		fmt.Sscanf(val, "%d", &config.Storage.RequestTimeoutSeconds)
+	}
+	if val := os.Getenv("STORAGE_MAX_CONCURRENT_PER_USER"); val != "" {
+		fmt.Sscanf(val, "%d", &config.Storage.MaxConcurrentPerUser)
+	}
+	if val := os.Getenv("STORAGE_GLOBAL_KEY_PREFIX"); val != "" {
+		config.Storage.GlobalKeyPrefix = val
+	}
+	if val := os.Getenv("AUDIT_DB_PATH"); val != "" {
+		config.Audit.DatabasePath = val
+	}
+	if val := os.Getenv("AUDIT_FORWARD_URL"); val != "" {
+		config.Audit.ForwardURL = val
+	}
+	if val := os.Getenv("AUDIT_CHAIN_KEY"); val != "" {
+		config.Audit.ChainKey = val
+	}
+	if val := os.Getenv("BACKUP_INTERVAL"); val != "" {
+		config.Backup.Interval = val
+	}
+	if val := os.Getenv("BACKUP_DIR"); val != "" {
+		config.Backup.Dir = val
+	}
+	if val := os.Getenv("DELIVERY_MAX_ATTEMPTS"); val != "" {
+		fmt.Sscanf(val, "%d", &config.Delivery.MaxAttempts)
+	}
+	if val := os.Getenv("PASSWORD_HISTORY_SIZE"); val != "" {
+		fmt.Sscanf(val, "%d", &config.Password.HistorySize)
+	}
+	if val := os.Getenv("PASSWORD_MAX_AGE_DAYS"); val != "" {
+		fmt.Sscanf(val, "%d", &config.Password.MaxAgeDays)
+	}
+	if val := os.Getenv("LOGIN_THROTTLE_BASE_DELAY_MS"); val != "" {
+		fmt.Sscanf(val, "%d", &config.LoginThrottle.BaseDelayMS)
+	}
+	if val := os.Getenv("SECURITY_LOCKOUT_THRESHOLD"); val != "" {
+		fmt.Sscanf(val, "%d", &config.Security.LockoutThreshold)
+	}
+	if val := os.Getenv("SECURITY_LOCKOUT_MINUTES"); val != "" {
+		fmt.Sscanf(val, "%d", &config.Security.LockoutMinutes)
+	}
+	if val := os.Getenv("SECURITY_EXPORT_LIMIT"); val != "" {
+		fmt.Sscanf(val, "%d", &config.Security.ExportLimit)
+	}
+	if val := os.Getenv("SECURITY_EXPORT_WINDOW_MINUTES"); val != "" {
+		fmt.Sscanf(val, "%d", &config.Security.ExportWindowMinutes)
+	}
+	if val := os.Getenv("RATELIMIT_REQUESTS_PER_MINUTE"); val != "" {
+		fmt.Sscanf(val, "%d", &config.RateLimit.RequestsPerMinute)
+	}
+	if val := os.Getenv("RATELIMIT_AUTH_REQUESTS_PER_MINUTE"); val != "" {
+		fmt.Sscanf(val, "%d", &config.RateLimit.AuthRequestsPerMinute)
+	}
+	if val := os.Getenv("RATELIMIT_ALLOWLIST"); val != "" {
+		config.RateLimit.Allowlist = nil
+		for _, entry := range strings.Split(val, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				config.RateLimit.Allowlist = append(config.RateLimit.Allowlist, entry)
+			}
+		}
+	}
+	if val := os.Getenv("SECURITY_ISOLATION_CHECK"); val != "" {
+		config.Security.IsolationCheck = val == "true"
+	}
+	if val := os.Getenv("INACTIVITY_DISABLE_AFTER_DAYS"); val != "" {
+		fmt.Sscanf(val, "%d", &config.Inactivity.DisableAfterDays)
+	}
+	if val := os.Getenv("UPLOAD_SPOOL_TO_DISK"); val != "" {
+		config.Upload.SpoolToDisk = val == "true"
+	}
+	if val := os.Getenv("UPLOAD_VERIFY_MULTIPART"); val != "" {
+		config.Upload.VerifyMultipart = val == "true"
+	}
+	if val := os.Getenv("UPLOAD_TEMP_DIR"); val != "" {
+		config.Upload.TempDir = val
+	}
+	if val := os.Getenv("UPLOAD_CONCURRENCY"); val != "" {
+		fmt.Sscanf(val, "%d", &config.Upload.Concurrency)
+	}
+	if val := os.Getenv("UPLOAD_MAX_SIZE_MB"); val != "" {
+		fmt.Sscanf(val, "%d", &config.Upload.MaxSizeMB)
+	}
+	if val := os.Getenv("UPLOAD_PART_SIZE_MB"); val != "" {
+		fmt.Sscanf(val, "%d", &config.Upload.PartSizeMB)
+	}
 	if val := os.Getenv("MINIO_ADMIN_URL"); val != "" {
 		config.MinIOAdmin.URL = val
 	}
@@ -180,6 +798,9 @@ func ReloadConfig() error {
 		return err
 	}
 	overrideWithEnv(config)
+	if err := validate(config); err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
 	AppConfig = config
 	
 	// Reinitialize logger with new config
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// encryptionIndexCacheSize is the block index cache Badger needs to avoid
+// decrypting table indexes on every read when encryption is enabled
+const encryptionIndexCacheSize = 100 << 20 // 100MB
+
+// DecodeEncryptionKey decodes a base64 database encryption key, which must be
+// 32 bytes (AES-256). An empty key returns nil.
+func DecodeEncryptionKey(encoded string) ([]byte, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("database.encryption_key must be base64: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("database.encryption_key must decode to 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// BadgerOptions returns the options every process opening the database at
+// path must use: the server and the command-line tools alike. A non-empty
+// encryptionKey (base64, see DecodeEncryptionKey) encrypts data at rest;
+// in-memory databases are never encrypted.
+func BadgerOptions(path, encryptionKey string) (badger.Options, error) {
+	if path == InMemoryDatabasePath {
+		// Ephemeral mode for tests and throwaway deployments; data is lost on exit
+		opts := badger.DefaultOptions("").WithInMemory(true)
+		opts.Logger = nil // Disable badger logging
+		return opts, nil
+	}
+
+	opts := badger.DefaultOptions(path)
+	opts.Logger = nil // Disable badger logging
+	key, err := DecodeEncryptionKey(encryptionKey)
+	if err != nil {
+		return opts, err
+	}
+	if key != nil {
+		opts = opts.WithEncryptionKey(key).WithIndexCacheSize(encryptionIndexCacheSize)
+	}
+	return opts, nil
+}
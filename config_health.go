@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigHealth is the last known connectivity state of a storage config
+type ConfigHealth struct {
+	ConfigID    string    `json:"config_id"`
+	Healthy     bool      `json:"healthy"`
+	LastSuccess time.Time `json:"last_success,omitempty"`
+	LastFailure time.Time `json:"last_failure,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	CheckedAt   time.Time `json:"checked_at"`
+	// ConsecutiveFailures counts failed requests since the last success
+	ConsecutiveFailures int `json:"consecutive_failures,omitempty"`
+}
+
+// configHealthCache keeps connectivity results in memory, updated
+// opportunistically by every storage request made through createS3Client
+type configHealthCache struct {
+	mu      sync.RWMutex
+	entries map[string]ConfigHealth
+}
+
+func newConfigHealthCache() *configHealthCache {
+	return &configHealthCache{entries: make(map[string]ConfigHealth)}
+}
+
+func (h *configHealthCache) record(configID string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	entry := h.entries[configID]
+	entry.ConfigID = configID
+	entry.CheckedAt = now
+	if err != nil {
+		entry.Healthy = false
+		entry.LastFailure = now
+		entry.LastError = err.Error()
+		entry.ConsecutiveFailures++
+	} else {
+		entry.Healthy = true
+		entry.LastSuccess = now
+		entry.LastError = ""
+		entry.ConsecutiveFailures = 0
+	}
+	h.entries[configID] = entry
+}
+
+func (h *configHealthCache) get(configID string) (ConfigHealth, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	entry, ok := h.entries[configID]
+	return entry, ok
+}
+
+// reset forgets the config's state, e.g. after its endpoint or credentials change
+func (h *configHealthCache) reset(configID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.entries, configID)
+}
+
+// isDown reports whether the config failed at least threshold requests in a
+// row, the last of them within ttl. A single failure is not enough, so one
+// slow or flaky response does not turn every request away.
+func (h *configHealthCache) isDown(configID string, ttl time.Duration, threshold int) bool {
+	entry, ok := h.get(configID)
+	return ok && !entry.Healthy && entry.ConsecutiveFailures >= threshold && time.Since(entry.LastFailure) < ttl
+}
+
+// trackHealth records the outcome of every request made by client. Only
+// connection failures and 5xx responses count as the backend being down;
+// errors like NoSuchKey or AccessDenied still prove it is reachable, as does
+// 501 from S3-compatible backends lacking an optional API like versioning.
+func (s *S3Service) trackHealth(client *s3.S3, configID string) *s3.S3 {
+	if configID == "" {
+		return client
+	}
+	client.Handlers.Complete.PushBack(func(r *request.Request) {
+		if r.Error != nil && (r.HTTPResponse == nil || r.HTTPResponse.StatusCode == 0 || (r.HTTPResponse.StatusCode >= 500 && r.HTTPResponse.StatusCode != http.StatusNotImplemented)) {
+			s.health.record(configID, r.Error)
+			return
+		}
+		s.health.record(configID, nil)
+	})
+	return client
+}
+
+// GetConfigHealth returns the cached health of a config. Pass refresh=true
+// (or query a config with no recorded state) to probe the backend now.
+func (s *S3Service) GetConfigHealth(c *gin.Context) {
+	userID := c.GetString("user_id")
+	configID := c.Param("id")
+
+	config, err := s.getConfigByID(userID, configID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Configuration not found"})
+		return
+	}
+
+	entry, ok := s.health.get(config.ID)
+	if !ok || c.Query("refresh") == "true" {
+		client := s.createS3Client(*config)
+		if client == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+			return
+		}
+		// The result is recorded by the client's health handler
+		client.ListObjects(&s3.ListObjectsInput{
+			Bucket:  aws.String(config.BucketName),
+			MaxKeys: aws.Int64(1),
+		})
+		entry, _ = s.health.get(config.ID)
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// connectionTestTimeout bounds a connection test so an unreachable endpoint
+// fails quickly
+const connectionTestTimeout = 10 * time.Second
+
+// Connection test failure classes
+const (
+	connErrorAuth           = "auth"
+	connErrorNetwork        = "network"
+	connErrorBucketNotFound = "bucket_not_found"
+	connErrorUnknown        = "unknown"
+)
+
+// ConnectionTestResult describes whether a storage config can reach its bucket
+type ConnectionTestResult struct {
+	Success   bool   `json:"success"`
+	Reachable bool   `json:"reachable"`            // The endpoint answered, even if it refused the request
+	Method    string `json:"method"`               // The request that decided the result: head_bucket or list_objects
+	LatencyMS int64  `json:"latency_ms"`           // Duration of that request
+	ErrorType string `json:"error_type,omitempty"` // auth, network, bucket_not_found or unknown
+	Error     string `json:"error,omitempty"`
+}
+
+// classifyConnectionError maps a storage error to a connection test failure class
+func classifyConnectionError(err error) string {
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		switch reqErr.Code() {
+		case "InvalidAccessKeyId", "SignatureDoesNotMatch", "AccessDenied", "ExpiredToken", "InvalidToken", "AuthorizationHeaderMalformed":
+			return connErrorAuth
+		case s3.ErrCodeNoSuchBucket:
+			return connErrorBucketNotFound
+		}
+		switch reqErr.StatusCode() {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return connErrorAuth
+		case http.StatusNotFound:
+			return connErrorBucketNotFound
+		case 0:
+			return connErrorNetwork
+		}
+		return connErrorUnknown
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case request.ErrCodeRequestError, request.CanceledErrorCode, request.ErrCodeResponseTimeout, "RequestTimeout":
+			return connErrorNetwork
+		case "EmptyStaticCreds":
+			return connErrorAuth
+		}
+	}
+	return connErrorUnknown
+}
+
+// testConnection checks that config can reach its bucket with HeadBucket,
+// falling back to a one-key ListObjects for backends or policies where
+// HeadBucket fails but listing works. Network failures skip the fallback.
+func (s *S3Service) testConnection(ctx context.Context, config S3Config) ConnectionTestResult {
+	// An empty ID keeps the transient client out of the health cache
+	config.ID = ""
+	client := s.createS3Client(config)
+	if client == nil {
+		return ConnectionTestResult{ErrorType: connErrorUnknown, Error: "Failed to create storage client"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, connectionTestTimeout)
+	defer cancel()
+
+	result := ConnectionTestResult{Method: "head_bucket"}
+	start := time.Now()
+	_, err := client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(config.BucketName)})
+	result.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil && classifyConnectionError(err) != connErrorNetwork {
+		result.Method = "list_objects"
+		start = time.Now()
+		_, err = client.ListObjectsWithContext(ctx, &s3.ListObjectsInput{
+			Bucket:  aws.String(config.BucketName),
+			MaxKeys: aws.Int64(1),
+		})
+		result.LatencyMS = time.Since(start).Milliseconds()
+	}
+
+	if err != nil {
+		result.ErrorType = classifyConnectionError(err)
+		reqErr, ok := err.(awserr.RequestFailure)
+		result.Reachable = ok && reqErr.StatusCode() != 0
+		result.Error = err.Error()
+		return result
+	}
+	result.Success = true
+	result.Reachable = true
+	return result
+}
+
+// TestConnection handles POST /api/configs/test. It checks a config's
+// credentials and bucket without saving anything, so the UI can validate a
+// config before it is created or updated.
+func (s *S3Service) TestConnection(c *gin.Context) {
+	var testRequest struct {
+		S3Config
+		UseSSL *bool `json:"use_ssl"`
+	}
+	if err := c.ShouldBindJSON(&testRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	config := testRequest.S3Config
+	if config.BucketName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bucket_name is required"})
+		return
+	}
+	if err := normalizeConfigEndpoint(&config, testRequest.UseSSL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateExtraHeaders(config.ExtraHeaders); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, s.testConnection(c.Request.Context(), config))
+}
+
+// maxParallelConnectionTests bounds how many configs ValidateAllConfigs
+// tests at once
+const maxParallelConnectionTests = 8
+
+// ConfigValidationResult is the connection test result of one saved config
+type ConfigValidationResult struct {
+	ConfigID    string `json:"config_id"`
+	Name        string `json:"name"`
+	StorageType string `json:"storage_type"`
+	Disabled    bool   `json:"disabled"`
+	ConnectionTestResult
+}
+
+// ValidateAllConfigs handles POST /api/configs/validate-all. It runs a
+// connection test against every one of the user's configs in parallel, e.g.
+// after rotating credentials, without changing the configs or their cached health.
+func (s *S3Service) ValidateAllConfigs(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	configs, err := s.getUserConfigs(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get configurations"})
+		return
+	}
+
+	results := make([]ConfigValidationResult, len(configs))
+	sem := make(chan struct{}, maxParallelConnectionTests)
+	var wg sync.WaitGroup
+	for i, config := range configs {
+		wg.Add(1)
+		go func(i int, config S3Config) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = ConfigValidationResult{
+				ConfigID:             config.ID,
+				Name:                 config.Name,
+				StorageType:          config.StorageType,
+				Disabled:             config.Disabled,
+				ConnectionTestResult: s.testConnection(c.Request.Context(), config),
+			}
+		}(i, config)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, result := range results {
+		if !result.Success {
+			failed++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"results":   results,
+		"total":     len(results),
+		"succeeded": len(results) - failed,
+		"failed":    failed,
+	})
+}
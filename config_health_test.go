@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConfigHealthIsDown(t *testing.T) {
+	failure := errors.New("connection refused")
+	tests := []struct {
+		name     string
+		outcomes []error // Recorded in order
+		reset    bool    // Reset the entry after recording
+		want     bool
+	}{
+		{"no requests", nil, false, false},
+		{"one failure", []error{failure}, false, false},
+		{"failures below the threshold", []error{failure, failure}, false, false},
+		{"failures at the threshold", []error{failure, failure, failure}, false, true},
+		{"success ends the streak", []error{failure, failure, nil, failure}, false, false},
+		{"reset after an update", []error{failure, failure, failure}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newConfigHealthCache()
+			for _, err := range tt.outcomes {
+				h.record("cfg1", err)
+			}
+			if tt.reset {
+				h.reset("cfg1")
+			}
+			if got := h.isDown("cfg1", time.Minute, 3); got != tt.want {
+				t.Errorf("isDown = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The backend is retried once the failures are older than the TTL
+	h := newConfigHealthCache()
+	for i := 0; i < 3; i++ {
+		h.record("cfg1", failure)
+	}
+	if h.isDown("cfg1", 0, 3) {
+		t.Error("isDown after the TTL passed")
+	}
+}
@@ -10,9 +10,23 @@ func InitDB(cfg *config.Config) (*badger.DB, error) {
 	if dbPath == "" {
 		dbPath = "s3mgr.db"
 	}
-	
-	opts := badger.DefaultOptions(dbPath)
-	opts.Logger = nil // Disable badger logging
+	return openDB(dbPath, cfg.Database.EncryptionKey)
+}
+
+// InitAuditDB opens the separate audit log database when audit.database_path
+// is set. It returns nil otherwise, and audit logs share the main database.
+func InitAuditDB(cfg *config.Config) (*badger.DB, error) {
+	if cfg.Audit.DatabasePath == "" {
+		return nil, nil
+	}
+	return openDB(cfg.Audit.DatabasePath, cfg.Database.EncryptionKey)
+}
+
+func openDB(dbPath, encryptionKey string) (*badger.DB, error) {
+	opts, err := config.BadgerOptions(dbPath, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
 	
 	db, err := badger.Open(opts)
 	if err != nil {
@@ -0,0 +1,64 @@
+package delivery
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"s3mgr/response"
+)
+
+// ListDeadLettersHandler handles GET /api/admin/deliveries/dead. It returns
+// every dead-lettered delivery along with the number still pending.
+func (q *Queue) ListDeadLettersHandler(c *gin.Context) {
+	dead, err := q.DeadLetters()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get dead-lettered deliveries"})
+		return
+	}
+	pending, err := q.PendingCount()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count pending deliveries"})
+		return
+	}
+	if dead == nil {
+		dead = []Delivery{}
+	}
+	response.List(c, "deliveries", dead, response.All(len(dead)), gin.H{"pending": pending})
+}
+
+// RetryDeadLetterHandler handles POST /api/admin/deliveries/dead/:id/retry
+func (q *Queue) RetryDeadLetterHandler(c *gin.Context) {
+	id := c.Param("id")
+	err := q.Retry(id)
+	if err == ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	if q.auditService != nil {
+		q.auditService.LogEvent(c, "retry_delivery", "delivery", id, err == nil, err, nil)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to requeue delivery"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Delivery requeued"})
+}
+
+// DiscardDeadLetterHandler handles DELETE /api/admin/deliveries/dead/:id
+func (q *Queue) DiscardDeadLetterHandler(c *gin.Context) {
+	id := c.Param("id")
+	err := q.Discard(id)
+	if err == ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	if q.auditService != nil {
+		q.auditService.LogEvent(c, "discard_delivery", "delivery", id, err == nil, err, nil)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to discard delivery"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Delivery discarded"})
+}
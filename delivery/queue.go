@@ -0,0 +1,305 @@
+// Package delivery sends outbound notifications (such as forwarded audit
+// events) to external HTTP endpoints. Deliveries are persisted in Badger
+// before they are attempted, so pending ones survive a restart. Failed
+// deliveries are retried with exponential backoff; once the attempt limit is
+// reached they move to a dead-letter list that admins can inspect and replay.
+package delivery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/sirupsen/logrus"
+
+	"s3mgr/audit"
+	"s3mgr/config"
+	"s3mgr/logger"
+)
+
+const (
+	pendingPrefix = "delivery:pending:"
+	deadPrefix    = "delivery:dead:"
+)
+
+// ErrNotFound is returned for a dead-lettered delivery that does not exist
+var ErrNotFound = errors.New("delivery not found")
+
+// Delivery is one outbound HTTP POST and its retry state
+type Delivery struct {
+	ID          string          `json:"id"`
+	Target      string          `json:"target"` // What produced the delivery, e.g. "audit_forward"
+	URL         string          `json:"url"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	DeadAt      *time.Time      `json:"dead_at,omitempty"` // Set once the delivery is dead-lettered
+}
+
+// Queue persists deliveries and retries them in the background
+type Queue struct {
+	db           *badger.DB
+	auditService *audit.AuditService
+	cfg          config.DeliveryConfig
+	client       *http.Client
+	wake         chan struct{} // Signals the worker that a new delivery is due
+}
+
+// NewQueue creates a delivery queue. Call Start to begin sending.
+func NewQueue(db *badger.DB, auditService *audit.AuditService, cfg config.DeliveryConfig) *Queue {
+	return &Queue{
+		db:           db,
+		auditService: auditService,
+		cfg:          cfg,
+		client:       &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second},
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Enqueue persists a delivery of payload to url and wakes the worker
+func (q *Queue) Enqueue(target, url string, payload []byte) error {
+	now := time.Now()
+	d := Delivery{
+		ID:          fmt.Sprintf("dlv_%d", now.UnixNano()),
+		Target:      target,
+		URL:         url,
+		Payload:     payload,
+		NextAttempt: now,
+		CreatedAt:   now,
+	}
+	if err := q.put(pendingPrefix, d); err != nil {
+		return err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start runs the delivery worker. Deliveries left pending by a previous run
+// are picked up on the first pass.
+func (q *Queue) Start() {
+	interval := time.Duration(q.cfg.PollSeconds) * time.Second
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			q.processDue()
+			select {
+			case <-ticker.C:
+			case <-q.wake:
+			}
+		}
+	}()
+}
+
+// processDue attempts every pending delivery whose next attempt is due
+func (q *Queue) processDue() {
+	due, err := q.list(pendingPrefix, func(d Delivery) bool {
+		return !d.NextAttempt.After(time.Now())
+	})
+	if err != nil {
+		logger.Error("Failed to load pending deliveries", err)
+		return
+	}
+	for _, d := range due {
+		q.attempt(d)
+	}
+}
+
+// attempt sends d once and records the outcome: removed on success,
+// rescheduled with backoff on failure, dead-lettered after MaxAttempts
+func (q *Queue) attempt(d Delivery) {
+	sendErr := q.send(d)
+	d.Attempts++
+	if sendErr == nil {
+		if err := q.delete(pendingPrefix, d.ID); err != nil {
+			logger.Error("Failed to remove sent delivery", err, logrus.Fields{"delivery_id": d.ID})
+		}
+		return
+	}
+
+	d.LastError = sendErr.Error()
+	fields := logrus.Fields{
+		"delivery_id": d.ID,
+		"target":      d.Target,
+		"attempts":    d.Attempts,
+		"error":       d.LastError,
+	}
+	if d.Attempts >= q.cfg.MaxAttempts {
+		now := time.Now()
+		d.DeadAt = &now
+		err := q.db.Update(func(txn *badger.Txn) error {
+			if err := setDelivery(txn, deadPrefix, d); err != nil {
+				return err
+			}
+			return txn.Delete([]byte(pendingPrefix + d.ID))
+		})
+		if err != nil {
+			logger.Error("Failed to dead-letter delivery", err, fields)
+			return
+		}
+		logger.Warn("Delivery failed permanently; moved to dead-letter list", fields)
+		return
+	}
+
+	d.NextAttempt = time.Now().Add(q.backoff(d.Attempts))
+	fields["next_attempt"] = d.NextAttempt
+	if err := q.put(pendingPrefix, d); err != nil {
+		logger.Error("Failed to reschedule delivery", err, fields)
+		return
+	}
+	logger.Warn("Delivery failed; will retry", fields)
+}
+
+// backoff is the wait after the given number of failed attempts: the initial
+// backoff doubled per attempt, capped at the maximum
+func (q *Queue) backoff(attempts int) time.Duration {
+	wait := time.Duration(q.cfg.InitialBackoffSeconds) * time.Second
+	limit := time.Duration(q.cfg.MaxBackoffSeconds) * time.Second
+	for i := 1; i < attempts && wait < limit; i++ {
+		wait *= 2
+	}
+	if wait > limit {
+		wait = limit
+	}
+	return wait
+}
+
+// send POSTs the payload; any non-2xx response counts as a failure
+func (q *Queue) send(d Delivery) error {
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-S3Mgr-Delivery-ID", d.ID)
+	req.Header.Set("X-S3Mgr-Delivery-Target", d.Target)
+
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// DeadLetters returns every delivery that exhausted its attempts, oldest first
+func (q *Queue) DeadLetters() ([]Delivery, error) {
+	return q.list(deadPrefix, nil)
+}
+
+// PendingCount returns the number of deliveries awaiting a (re)try
+func (q *Queue) PendingCount() (int, error) {
+	pending, err := q.list(pendingPrefix, nil)
+	return len(pending), err
+}
+
+// Retry moves a dead-lettered delivery back to the pending queue with a fresh
+// attempt budget
+func (q *Queue) Retry(id string) error {
+	err := q.db.Update(func(txn *badger.Txn) error {
+		d, err := getDelivery(txn, deadPrefix, id)
+		if err != nil {
+			return err
+		}
+		d.Attempts = 0
+		d.DeadAt = nil
+		d.NextAttempt = time.Now()
+		if err := setDelivery(txn, pendingPrefix, d); err != nil {
+			return err
+		}
+		return txn.Delete([]byte(deadPrefix + id))
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Discard deletes a dead-lettered delivery
+func (q *Queue) Discard(id string) error {
+	return q.db.Update(func(txn *badger.Txn) error {
+		if _, err := getDelivery(txn, deadPrefix, id); err != nil {
+			return err
+		}
+		return txn.Delete([]byte(deadPrefix + id))
+	})
+}
+
+func (q *Queue) put(prefix string, d Delivery) error {
+	return q.db.Update(func(txn *badger.Txn) error {
+		return setDelivery(txn, prefix, d)
+	})
+}
+
+func (q *Queue) delete(prefix, id string) error {
+	return q.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(prefix + id))
+	})
+}
+
+// list returns the deliveries under prefix that match keep (nil keeps all).
+// IDs embed their creation time, so key order is oldest first.
+func (q *Queue) list(prefix string, keep func(Delivery) bool) ([]Delivery, error) {
+	var deliveries []Delivery
+	err := q.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		p := []byte(prefix)
+		for it.Seek(p); it.ValidForPrefix(p); it.Next() {
+			var d Delivery
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &d)
+			})
+			if err != nil {
+				return err
+			}
+			if keep == nil || keep(d) {
+				deliveries = append(deliveries, d)
+			}
+		}
+		return nil
+	})
+	return deliveries, err
+}
+
+func getDelivery(txn *badger.Txn, prefix, id string) (Delivery, error) {
+	var d Delivery
+	item, err := txn.Get([]byte(prefix + id))
+	if err == badger.ErrKeyNotFound {
+		return d, ErrNotFound
+	}
+	if err != nil {
+		return d, err
+	}
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &d)
+	})
+	return d, err
+}
+
+func setDelivery(txn *badger.Txn, prefix string, d Delivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return txn.Set([]byte(prefix+d.ID), data)
+}
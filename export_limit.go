@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"s3mgr/audit"
+	"s3mgr/config"
+)
+
+// exportLimiter counts the exports each user started within a sliding window,
+// so repeated full dumps of users, configs or audit logs cannot hammer the
+// database. Counts are kept per instance, like upload locks.
+type exportLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	started map[string][]time.Time // Username -> start times of exports within the window, oldest first
+}
+
+func newExportLimiter(cfg config.SecurityConfig) *exportLimiter {
+	return &exportLimiter{
+		limit:   cfg.ExportLimit,
+		window:  time.Duration(cfg.ExportWindowMinutes) * time.Minute,
+		started: make(map[string][]time.Time),
+	}
+}
+
+// allow records an export by username, or returns false and how long until the
+// oldest export in the window expires when the user is over the limit
+func (l *exportLimiter) allow(username string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	recent := l.started[username]
+	for len(recent) > 0 && now.Sub(recent[0]) >= l.window {
+		recent = recent[1:]
+	}
+	if len(recent) >= l.limit {
+		l.started[username] = recent
+		return false, recent[0].Add(l.window).Sub(now)
+	}
+	l.started[username] = append(recent, now)
+	return true, 0
+}
+
+// exportRateLimit rejects export requests with 429 once the caller has used up
+// security.export_limit exports in the current window. Rejections are audited.
+func exportRateLimit(cfg config.SecurityConfig, auditService *audit.AuditService) gin.HandlerFunc {
+	if cfg.ExportLimit < 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	limiter := newExportLimiter(cfg)
+	return func(c *gin.Context) {
+		username := c.GetString("username")
+		ok, wait := limiter.allow(username)
+		if ok {
+			c.Next()
+			return
+		}
+
+		retryAfter := int(wait/time.Second) + 1
+		auditService.LogEvent(c, "export_rate_limited", "export", c.FullPath(), false,
+			fmt.Errorf("export limit of %d per %v reached", limiter.limit, limiter.window),
+			map[string]interface{}{"retry_after": retryAfter})
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many exports; try again later",
+			"code":        "export_rate_limited",
+			"retry_after": retryAfter,
+		})
+	}
+}
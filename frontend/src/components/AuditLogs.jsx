@@ -50,8 +50,8 @@ function AuditLogs() {
       // Add pagination params to filters
       const params = { ...filters, page, page_size: pageSize }
       const response = await adminAPI.getAuditLogs(token, params)
-      setLogs(response.data.audit_logs || [])
-      setTotal(response.data.total || 0)
+      setLogs(response.data.items || [])
+      setTotal(response.data.pagination?.total || 0)
     } catch (error) {
       console.error('Failed to load audit logs:', error)
       setError('Failed to load audit logs: ' + (error.response?.data?.error || error.message))
@@ -65,9 +65,9 @@ const [total, setTotal] = useState(0)
     setLoading(true)
     try {
       const response = await s3API.getConfigs({ page, page_size: pageSize })
-      const configList = Array.isArray(response.data.configurations) ? response.data.configurations : []
+      const configList = Array.isArray(response.data.items) ? response.data.items : []
       setConfigs(configList)
-      setTotal(response.data.total || 0)
+      setTotal(response.data.pagination?.total || 0)
       setError('')
     } catch (error) {
       console.error('Failed to load configs:', error)
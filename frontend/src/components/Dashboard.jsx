@@ -19,7 +19,9 @@ function Dashboard() {
   // Pagination state for files
   const [filesPage, setFilesPage] = useState(1)
   const [filesPageSize, setFilesPageSize] = useState(10)
-  const [filesTotal, setFilesTotal] = useState(0)
+  // Listings are paged by continuation token: filesTokens[n] fetches page n + 1
+  const [filesTokens, setFilesTokens] = useState([''])
+  const [filesHasMore, setFilesHasMore] = useState(false)
 
   useEffect(() => {
     loadConfigs()
@@ -31,12 +33,18 @@ function Dashboard() {
     }
   }, [selectedConfigId, filesPage, filesPageSize])
 
+  // Tokens are only valid for the listing they came from
+  useEffect(() => {
+    setFilesTokens([''])
+    setFilesPage(1)
+  }, [selectedConfigId, filesPageSize])
+
   const loadConfigs = async () => {
     try {
       setConfigsLoading(true)
       const response = await s3API.getConfigs()
-      // Backend returns {configurations: [...]} not direct array
-      const configList = Array.isArray(response.data.configurations) ? response.data.configurations : []
+      // Backend returns {kind, items: [...], pagination} not direct array
+      const configList = Array.isArray(response.data.items) ? response.data.items : []
       setConfigs(configList)
       
       // Auto-select default config or first config
@@ -63,19 +71,29 @@ function Dashboard() {
     setLoading(true)
     try {
       // Pass pagination params to API
-      const response = await s3API.getFiles(selectedConfigId, { page: filesPage, page_size: filesPageSize })
+      const token = filesTokens[filesPage - 1] || ''
+      const response = await s3API.getFiles(selectedConfigId, {
+        page_size: filesPageSize,
+        ...(token ? { continuation_token: token } : {}),
+      })
       console.log('loadFiles: API response:', response)
       console.log('loadFiles: Response data:', response.data)
       
-      // Backend returns files under 'files' key and total count
-      const fileList = Array.isArray(response.data.files) ? response.data.files : []
+      // Backend returns files under 'items' and the next page's token under 'pagination'
+      const fileList = Array.isArray(response.data.items) ? response.data.items : []
       setFiles(fileList)
-      setFilesTotal(response.data.total || 0)
+      const nextToken = response.data.pagination?.next_continuation_token || ''
+      setFilesHasMore(!!response.data.pagination?.has_more)
+      setFilesTokens(tokens => {
+        const updated = tokens.slice(0, filesPage)
+        updated[filesPage] = nextToken
+        return updated
+      })
     } catch (error) {
       console.error('loadFiles: Failed to load files:', error)
       console.error('loadFiles: Error response:', error.response)
       setFiles([])
-      setFilesTotal(0)
+      setFilesHasMore(false)
     } finally {
       setLoading(false)
     }
@@ -238,7 +256,7 @@ function Dashboard() {
                       setPage={setFilesPage}
                       pageSize={filesPageSize}
                       setPageSize={setFilesPageSize}
-                      total={filesTotal}
+                      hasMore={filesHasMore}
                     />
                   ) : Array.isArray(configs) && configs.length > 0 ? (
                     <div className="text-center py-12">
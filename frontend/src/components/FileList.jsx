@@ -1,8 +1,8 @@
 import React, { useState } from 'react'
 import { s3API } from '../services/api'
-import { Download, Trash2, RefreshCw, File, Folder } from 'lucide-react'
+import { Download, Trash2, RefreshCw, File, Folder, FolderPlus } from 'lucide-react'
 
-function FileList({ files, loading, onFileDeleted, onRefresh, configId, page, setPage, pageSize, setPageSize, total }) {
+function FileList({ files, loading, onFileDeleted, onRefresh, configId, page, setPage, pageSize, setPageSize, hasMore }) {
   const [deleting, setDeleting] = useState(new Set())
 
   // Ensure files is always an array
@@ -60,6 +60,37 @@ function FileList({ files, loading, onFileDeleted, onRefresh, configId, page, se
     }
   }
 
+  const handleCreateFolder = async () => {
+    if (!configId) {
+      alert('Please select a configuration first')
+      return
+    }
+
+    const path = prompt('Folder path (e.g. reports/2024)')
+    if (!path) {
+      return
+    }
+
+    try {
+      await s3API.createFolder(path, configId)
+      onRefresh()
+    } catch (error) {
+      console.error('Create folder failed:', error)
+      alert(error.response?.data?.error || 'Failed to create folder')
+    }
+  }
+
+  // Folder markers end in "/"; show their last path segment
+  const displayName = (file) => {
+    const key = file.is_folder ? file.key.slice(0, -1) : file.key
+    return key.split('/').pop() || key
+  }
+
+  const parentPath = (file) => {
+    const key = file.is_folder ? file.key.slice(0, -1) : file.key
+    return key.includes('/') ? key.substring(0, key.lastIndexOf('/')) : ''
+  }
+
   const formatFileSize = (bytes) => {
     if (bytes === 0) return '0 Bytes'
     const k = 1024
@@ -88,13 +119,22 @@ function FileList({ files, loading, onFileDeleted, onRefresh, configId, page, se
       <div className="px-6 py-4 border-b border-gray-200">
         <div className="flex items-center justify-between">
           <h2 className="text-lg font-medium text-gray-900">Files</h2>
-          <button
-            onClick={onRefresh}
-            className="inline-flex items-center px-3 py-2 border border-gray-300 shadow-sm text-sm leading-4 font-medium rounded-md text-gray-700 bg-white hover:bg-gray-50 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500"
-          >
-            <RefreshCw className="h-4 w-4 mr-2" />
-            Refresh
-          </button>
+          <div className="flex items-center space-x-2">
+            <button
+              onClick={handleCreateFolder}
+              className="inline-flex items-center px-3 py-2 border border-gray-300 shadow-sm text-sm leading-4 font-medium rounded-md text-gray-700 bg-white hover:bg-gray-50 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500"
+            >
+              <FolderPlus className="h-4 w-4 mr-2" />
+              New Folder
+            </button>
+            <button
+              onClick={onRefresh}
+              className="inline-flex items-center px-3 py-2 border border-gray-300 shadow-sm text-sm leading-4 font-medium rounded-md text-gray-700 bg-white hover:bg-gray-50 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500"
+            >
+              <RefreshCw className="h-4 w-4 mr-2" />
+              Refresh
+            </button>
+          </div>
         </div>
       </div>
       {/* Pagination and page size controls */}
@@ -136,30 +176,36 @@ function FileList({ files, loading, onFileDeleted, onRefresh, configId, page, se
                 <tr key={file.key} className="hover:bg-gray-50">
                   <td className="px-6 py-4 whitespace-nowrap">
                     <div className="flex items-center">
-                      <File className="h-5 w-5 text-gray-400 mr-3" />
+                      {file.is_folder ? (
+                        <Folder className="h-5 w-5 text-blue-400 mr-3" />
+                      ) : (
+                        <File className="h-5 w-5 text-gray-400 mr-3" />
+                      )}
                       <div>
                         <div className="text-sm font-medium text-gray-900">
-                          {file.key.split('/').pop() || file.key}
+                          {displayName(file)}
                         </div>
-                        {file.key.includes('/') && (
+                        {parentPath(file) && (
                           <div className="text-sm text-gray-500">
-                            {file.key.substring(0, file.key.lastIndexOf('/'))}
+                            {parentPath(file)}
                           </div>
                         )}
                       </div>
                     </div>
                   </td>
-                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{formatFileSize(file.size)}</td>
-                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{formatDate(file.last_modified)}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{file.is_folder ? '—' : formatFileSize(file.size)}</td>
+                  <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{file.last_modified ? formatDate(file.last_modified) : '—'}</td>
                   <td className="px-6 py-4 whitespace-nowrap text-right text-sm font-medium">
                     <div className="flex items-center justify-end space-x-2">
-                      <button
-                        onClick={() => handleDownload(file)}
-                        className="text-blue-600 hover:text-blue-900 p-1"
-                        title="Download"
-                      >
-                        <Download className="h-4 w-4" />
-                      </button>
+                      {!file.is_folder && (
+                        <button
+                          onClick={() => handleDownload(file)}
+                          className="text-blue-600 hover:text-blue-900 p-1"
+                          title="Download"
+                        >
+                          <Download className="h-4 w-4" />
+                        </button>
+                      )}
                       <button
                         onClick={() => handleDelete(file)}
                         disabled={deleting.has(file.key)}
@@ -185,11 +231,11 @@ function FileList({ files, loading, onFileDeleted, onRefresh, configId, page, se
               onClick={() => setPage(p => Math.max(1, p - 1))}
               disabled={page === 1}
             >Prev</button>
-            <span className="mx-2">Page {page} of {Math.max(1, Math.ceil(total / pageSize))}</span>
+            <span className="mx-2">Page {page}</span>
             <button
               className="px-3 py-1 rounded bg-gray-200 hover:bg-gray-300"
-              onClick={() => setPage(p => Math.min(Math.ceil(total / pageSize), p + 1))}
-              disabled={page >= Math.ceil(total / pageSize)}
+              onClick={() => setPage(p => p + 1)}
+              disabled={!hasMore}
             >Next</button>
           </div>
         </div>
@@ -29,7 +29,7 @@ function Login() {
 
     try {
       const response = await authAPI.login(formData)
-      login(response.data.token, response.data.username)
+      login(response.data.token, response.data.username, response.data.refresh_token)
       navigate('/dashboard')
     } catch (err) {
       setError(err.response?.data?.error || 'Login failed')
@@ -99,7 +99,7 @@ function S3Config({ config, onConfigUpdated, onCancel, isCreating = false }) {
         await s3API.createConfig(configData)
         setSuccess('Configuration created successfully!')
       } else {
-        await s3API.updateConfig(config.id, configData)
+        await s3API.updateConfig(config.id, { ...configData, version: config.version })
         setSuccess('Configuration updated successfully!')
       }
       
@@ -41,7 +41,7 @@ function UserManagement() {
       setLoading(true)
       setError('')
       const response = await adminAPI.getUsers(token)
-      setUsers(response.data.users || [])
+      setUsers(response.data.items || [])
     } catch (error) {
       console.error('Failed to load users:', error)
       setError('Failed to load users: ' + (error.response?.data?.error || error.message))
@@ -69,7 +69,10 @@ export function AuthProvider({ children }) {
     }
   }, [username])
 
-  const login = (token, username) => {
+  const login = (token, username, refreshToken) => {
+    if (refreshToken) {
+      localStorage.setItem('refresh_token', refreshToken)
+    }
     setToken(token)
     setUsername(username)
   }
@@ -81,6 +84,7 @@ export function AuthProvider({ children }) {
       // Even if logout fails (e.g. expired token), clear client state
       console.warn('Logout API call failed:', err)
     } finally {
+      localStorage.removeItem('refresh_token')
       setToken(null)
       setUsername(null)
       setUserInfo(null)
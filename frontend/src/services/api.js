@@ -15,11 +15,42 @@ api.interceptors.request.use((config) => {
   return config
 })
 
+// On 401, exchange the refresh token for a new token pair once and retry.
+// Refresh tokens rotate, so concurrent 401s share a single refresh request.
+let refreshing = null
+api.interceptors.response.use(
+  (response) => response,
+  async (error) => {
+    const original = error.config
+    const refreshToken = localStorage.getItem('refresh_token')
+    const isAuthCall = original?.url?.startsWith('/auth/')
+    if (error.response?.status !== 401 || !refreshToken || !original || original._retried || isAuthCall) {
+      return Promise.reject(error)
+    }
+    original._retried = true
+    try {
+      if (!refreshing) {
+        refreshing = axios
+          .post(`${API_BASE_URL}/auth/refresh`, { refresh_token: refreshToken })
+          .finally(() => { refreshing = null })
+      }
+      const { data } = await refreshing
+      localStorage.setItem('token', data.token)
+      localStorage.setItem('refresh_token', data.refresh_token)
+      return api(original)
+    } catch (refreshError) {
+      localStorage.removeItem('refresh_token')
+      return Promise.reject(error)
+    }
+  }
+)
+
 // Auth API
 export const authAPI = {
   login: (credentials) => api.post('/auth/login', credentials),
   register: (userData) => api.post('/auth/register', userData),
   logout: () => api.post('/auth/logout'), // New: call backend logout endpoint
+  refresh: (refreshToken) => api.post('/auth/refresh', { refresh_token: refreshToken }),
 }
 
 // S3 API
@@ -60,7 +91,10 @@ export const s3API = {
     })
   },
   deleteFile: async (key, configId) => {
-    return await api.delete(`/files/${key}?config_id=${configId}`)
+    return await api.delete(`/files/${encodeURIComponent(key)}?config_id=${configId}`)
+  },
+  createFolder: (path, configId = null) => {
+    return api.post('/files/folder', { path, ...(configId ? { config_id: configId } : {}) })
   },
   
   // Configuration management
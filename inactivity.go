@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"s3mgr/logger"
+)
+
+// StartInactivityJob periodically disables accounts that have not logged in
+// within the configured number of days. Only an admin can re-enable them.
+func (a *AuthService) StartInactivityJob() {
+	if a.cfg.Inactivity.DisableAfterDays <= 0 {
+		return
+	}
+	interval := time.Duration(a.cfg.Inactivity.CheckIntervalMinutes) * time.Minute
+
+	go func() {
+		a.disableInactiveUsers()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			a.disableInactiveUsers()
+		}
+	}()
+}
+
+// lastActivity is the most recent of the user's last login, creation and
+// reactivation by an admin
+func lastActivity(user *User) time.Time {
+	latest := user.LastLogin
+	for _, t := range []time.Time{user.CreatedAt, user.ReactivatedAt} {
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// isInactive reports whether an active user has exceeded the inactivity threshold
+func (a *AuthService) isInactive(user *User, now time.Time) bool {
+	if !user.IsActive {
+		return false
+	}
+	if a.cfg.Inactivity.ExemptAdmins && (user.IsAdmin || user.IsSuperAdmin) {
+		return false
+	}
+	last := lastActivity(user)
+	if last.IsZero() {
+		return false
+	}
+	threshold := time.Duration(a.cfg.Inactivity.DisableAfterDays) * 24 * time.Hour
+	return now.Sub(last) > threshold
+}
+
+// disableInactiveUsers sets IsActive=false on every inactive user and audit-logs each change
+func (a *AuthService) disableInactiveUsers() {
+	now := time.Now()
+
+	var candidates []string
+	err := a.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte("user:")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var user User
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &user)
+			})
+			if err != nil {
+				return err
+			}
+			if a.isInactive(&user, now) {
+				candidates = append(candidates, user.Username)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("Inactivity scan failed", err)
+		return
+	}
+
+	for _, username := range candidates {
+		var user User
+		disabled := false
+		// Re-check inside the write so a login since the scan is respected
+		err := a.db.Update(func(txn *badger.Txn) error {
+			item, err := txn.Get([]byte("user:" + username))
+			if err != nil {
+				return err
+			}
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &user)
+			}); err != nil {
+				return err
+			}
+			if !a.isInactive(&user, now) {
+				return nil
+			}
+
+			user.IsActive = false
+			user.UpdatedAt = now
+			userData, err := json.Marshal(user)
+			if err != nil {
+				return err
+			}
+			disabled = true
+			return txn.Set([]byte("user:"+username), userData)
+		})
+		if err != nil {
+			logger.Error("Failed to disable inactive user", err, map[string]interface{}{"username": username})
+			if a.auditService != nil {
+				a.auditService.LogSystemEvent(user.OrgID, "disable_inactive_user", "user", username, false, err, nil)
+			}
+			continue
+		}
+		if !disabled {
+			continue
+		}
+
+		details := map[string]interface{}{
+			"last_activity":      lastActivity(&user),
+			"disable_after_days": a.cfg.Inactivity.DisableAfterDays,
+		}
+		a.revokeDisabledUserSessions(username)
+		logger.Info("Disabled inactive user", map[string]interface{}{"username": username})
+		if a.auditService != nil {
+			a.auditService.LogSystemEvent(user.OrgID, "disable_inactive_user", "user", username, true, nil, details)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/sirupsen/logrus"
+
+	"s3mgr/logger"
+)
+
+// isolationCheckMaxKeys is how many keys each isolation probe lists
+const isolationCheckMaxKeys = 100
+
+// IsolationViolation is a key a prefixed listing returned outside its prefix
+type IsolationViolation struct {
+	Prefix string `json:"prefix"`
+	Key    string `json:"key"`
+}
+
+// checkPrefixIsolation lists config's bucket under the owner's user prefix
+// and under a prefix that cannot exist, and returns every key the backend
+// returned outside the requested prefix. A backend or proxy that ignores the
+// prefix would otherwise let users see each other's files.
+func (s *S3Service) checkPrefixIsolation(config S3Config) ([]IsolationViolation, error) {
+	client := s.createS3Client(config)
+	if client == nil {
+		return nil, fmt.Errorf("failed to create storage client")
+	}
+
+	prefixes := []string{
+		s.userPrefix(config.UserID),
+		fmt.Sprintf("s3mgr-isolation-probe-%d/", time.Now().UnixNano()),
+	}
+	var violations []IsolationViolation
+	for _, prefix := range prefixes {
+		result, err := client.ListObjectsV2(&s3.ListObjectsV2Input{
+			Bucket:  aws.String(config.BucketName),
+			Prefix:  aws.String(prefix),
+			MaxKeys: aws.Int64(isolationCheckMaxKeys),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range result.Contents {
+			key := aws.StringValue(obj.Key)
+			if !strings.HasPrefix(key, prefix) {
+				violations = append(violations, IsolationViolation{Prefix: prefix, Key: key})
+			}
+		}
+	}
+	return violations, nil
+}
+
+// RunIsolationCheck verifies prefix isolation on a sample of stored configs,
+// one per distinct bucket, when security.isolation_check is enabled. It runs
+// in the background so an unreachable backend does not delay startup.
+func (s *S3Service) RunIsolationCheck() {
+	if !s.cfg.Security.IsolationCheck {
+		return
+	}
+
+	go func() {
+		var sample []S3Config
+		seen := make(map[string]bool)
+		err := s.forEachConfig([]byte("user_config_"), func(config S3Config) error {
+			bucket := config.EndpointURL + "|" + config.BucketName
+			if config.Disabled || seen[bucket] || len(sample) >= s.cfg.Security.IsolationCheckSample {
+				return nil
+			}
+			seen[bucket] = true
+			sample = append(sample, config)
+			return nil
+		})
+		if err != nil {
+			logger.Error("Isolation check could not load configurations", err)
+			return
+		}
+
+		for _, config := range sample {
+			fields := logrus.Fields{
+				"config_id": config.ID,
+				"user_id":   config.UserID,
+				"bucket":    config.BucketName,
+			}
+			violations, err := s.checkPrefixIsolation(config)
+			if err != nil {
+				logger.Warn("Isolation check skipped: storage unreachable", logrus.Fields{
+					"config_id": config.ID,
+					"error":     err.Error(),
+				})
+				continue
+			}
+			if len(violations) == 0 {
+				logger.Info("Isolation check passed", fields)
+				continue
+			}
+
+			fields["violations"] = len(violations)
+			fields["example_key"] = violations[0].Key
+			logger.Error("SECURITY: storage backend ignores key prefixes; users may see each other's files", nil, fields)
+			if s.auditService != nil {
+				s.auditService.LogSystemEvent(config.OrgID, "isolation_check", "config", config.ID, false,
+					fmt.Errorf("listing returned %d keys outside the requested prefix", len(violations)),
+					map[string]interface{}{"bucket": config.BucketName, "violations": violations})
+			}
+		}
+	}()
+}
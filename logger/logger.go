@@ -26,6 +26,14 @@ type LogConfig struct {
 	Compress    bool   `yaml:"compress"`
 	Console     bool   `yaml:"console"`
 	Format      string `yaml:"format"`
+	// LogBodies adds redacted request/response body snapshots to request logs
+	// while the level is debug
+	LogBodies    bool `yaml:"log_bodies"`
+	BodyMaxBytes int  `yaml:"body_max_bytes"` // Longest body snapshot kept per request or response
+	// ExcludePaths are request paths, relative to server.base_path, left out of
+	// the request log along with everything below them unless the request fails
+	// with a 5xx. Unset defaults to /health and /metrics; [] logs everything.
+	ExcludePaths []string `yaml:"exclude_paths"`
 }
 
 type RequestLog struct {
@@ -41,6 +49,8 @@ type RequestLog struct {
 	RequestSize  int64     `json:"request_size"`
 	ResponseSize int       `json:"response_size"`
 	Error        string    `json:"error,omitempty"`
+	RequestBody  string    `json:"request_body,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"`
 }
 
 type AuthLog struct {
@@ -140,7 +150,7 @@ func Initialize(cfg LogConfig) error {
 
 // LogRequest logs HTTP request details
 func LogRequest(req RequestLog) {
-	Logger.WithFields(logrus.Fields{
+	fields := logrus.Fields{
 		"type":          "request",
 		"method":        req.Method,
 		"path":          req.Path,
@@ -153,7 +163,14 @@ func LogRequest(req RequestLog) {
 		"request_size":  req.RequestSize,
 		"response_size": req.ResponseSize,
 		"error":         req.Error,
-	}).Info("HTTP Request")
+	}
+	if req.RequestBody != "" {
+		fields["request_body"] = req.RequestBody
+	}
+	if req.ResponseBody != "" {
+		fields["response_body"] = req.ResponseBody
+	}
+	Logger.WithFields(fields).Info("HTTP Request")
 }
 
 // LogAuth logs authentication events
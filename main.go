@@ -1,10 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -13,6 +18,9 @@ import (
 	"s3mgr/logger"
 	"s3mgr/middleware"
 	"s3mgr/audit"
+	"s3mgr/delivery"
+	"s3mgr/backup"
+	"s3mgr/session"
 )
 
 // main.go
@@ -52,10 +60,56 @@ func main() {
 	}
 	defer db.Close()
 
+	// Audit logs live in the main database unless audit.database_path is set
+	auditDB := db
+	separateAuditDB, err := InitAuditDB(cfg)
+	if err != nil {
+		logger.Error("Failed to initialize audit database", err)
+		log.Fatal(err)
+	}
+	if separateAuditDB != nil {
+		defer separateAuditDB.Close()
+		auditDB = separateAuditDB
+		logger.Info("Audit logs use a separate database", map[string]interface{}{
+			"path": cfg.Audit.DatabasePath,
+		})
+	}
+
 	// Initialize services
-	auditService := audit.NewAuditService(db)
-	authService := NewAuthService(db, auditService)
-	s3Service := NewS3Service(db, auditService)
+	auditService := audit.NewAuditService(auditDB)
+	if err := auditService.SetRedactionRules(cfg.Audit.RedactFields, cfg.Audit.RedactPatterns); err != nil {
+		log.Fatal(err)
+	}
+	auditService.SetChainKey(cfg.Audit.ChainKey)
+	deliveryQueue := delivery.NewQueue(db, auditService, cfg.Delivery)
+	if forwardURL := cfg.Audit.ForwardURL; forwardURL != "" {
+		auditService.SetForwarder(func(entry audit.AuditLog) {
+			payload, err := json.Marshal(entry)
+			if err == nil {
+				err = deliveryQueue.Enqueue("audit_forward", forwardURL, payload)
+			}
+			if err != nil {
+				logger.Error("Failed to queue audit event for forwarding", err)
+			}
+		})
+	}
+	orgService := NewOrgService(db, auditService)
+	sessionStore, err := session.NewStore(cfg.Session, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer sessionStore.Close()
+	authService := NewAuthService(db, auditService, orgService, sessionStore, cfg)
+	s3Service := NewS3Service(db, auditService, cfg)
+	backupService := backup.NewService(db, auditService, cfg.Backup)
+
+	// Start background jobs
+	auditService.StartRetryJob()
+	deliveryQueue.Start()
+	authService.StartInactivityJob()
+	s3Service.StartObjectExpiryJob()
+	s3Service.RunIsolationCheck()
+	backupService.Start()
 
 	// Set Gin mode based on log level
 	if cfg.Logging.Level == "debug" {
@@ -64,33 +118,69 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	// Anyone who knows the JWT secret can forge tokens for any user
+	if cfg.JWT.InsecureSecret() {
+		if gin.Mode() == gin.ReleaseMode {
+			logger.Error("Refusing to start with an empty or placeholder JWT secret", nil)
+			log.Fatal("Set a strong random jwt.secret in config.yaml or the JWT_SECRET environment variable (e.g. `openssl rand -hex 32`)")
+		}
+		logger.Warn("Using an empty or placeholder JWT secret; this is only allowed with debug logging")
+	}
+
 	// Create Gin router
 	r := gin.New()
+	// Object keys may contain "/", which clients send escaped as %2F. Routing on
+	// the escaped path keeps such a key in one :key segment, and the value is
+	// unescaped before handlers read it.
+	r.UseRawPath = true
+	r.UnescapePathValues = true
+	// Only trusted proxies may set the client IP used for rate limits and audit logs
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal("Invalid server.trusted_proxies:", err)
+	}
 
 	// Add middleware
-	r.Use(gin.Recovery())
-	r.Use(middleware.RequestLogger()) // Custom request logger
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:5173", "http://localhost:3000"},
+	r.Use(middleware.Recovery(auditService)) // Audit-logged panic recovery
+	// Custom request logger; skips successful probes of logging.exclude_paths
+	r.Use(middleware.RequestLogger(cfg.Logging, cfg.Server.RoutePrefix()))
+	corsConfig := cors.Config{
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
 		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
+		AllowCredentials: !cfg.Server.CORSDisableCredentials,
 		MaxAge:           12 * time.Hour,
-	}))
+	}
+	if cfg.Server.AllowsAllOrigins() {
+		corsConfig.AllowAllOrigins = true
+	} else {
+		corsConfig.AllowOrigins = cfg.Server.CORSOrigins
+	}
+	r.Use(cors.New(corsConfig))
+	// Per-IP request limits, with a stricter bucket for the auth endpoints
+	r.Use(middleware.RateLimit(cfg.RateLimit, cfg.Server.RoutePrefix()+"/api/auth/"))
+
+	// All routes live under the configured base path (empty for the root)
+	basePath := cfg.Server.RoutePrefix()
+	base := r.Group(basePath)
 
 	// Health check endpoint
-	r.GET("/health", func(c *gin.Context) {
+	base.GET("/health", func(c *gin.Context) {
+		status := "healthy"
+		pending, dropped := auditService.QueueStats()
+		if pending > 0 || dropped > 0 {
+			status = "degraded"
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"status": "healthy",
+			"status":    status,
 			"timestamp": time.Now().UTC(),
-			"version": "1.0.0",
+			"version":   "1.0.0",
+			"audit":     gin.H{"pending": pending, "dropped": dropped},
 		})
 	})
 
 	// Debug endpoint to change log level (only in debug mode)
 	if cfg.Logging.Level == "debug" {
-		r.POST("/debug/log-level", func(c *gin.Context) {
+		base.POST("/debug/log-level", func(c *gin.Context) {
 			var req struct {
 				Level string `json:"level"`
 			}
@@ -109,13 +199,14 @@ func main() {
 	}
 
 	// API routes
-	api := r.Group("/api")
+	api := base.Group("/api")
 
 	// Authentication routes
 	auth := api.Group("/auth")
 	{
 		auth.POST("/register", authService.Register)
 		auth.POST("/login", authService.Login)
+		auth.POST("/refresh", authService.Refresh)
 	}
 
 	// Protected routes
@@ -128,46 +219,116 @@ func main() {
 
 		// Configuration routes
 		protected.GET("/configs", s3Service.GetConfigs)
+		protected.GET("/configs/default", s3Service.GetDefaultConfig)
 		protected.GET("/configs/:id", s3Service.GetConfigByID)
 		protected.POST("/configs", s3Service.CreateConfig)
 		protected.PUT("/configs/:id", s3Service.UpdateConfig)
 		protected.DELETE("/configs/:id", s3Service.DeleteConfig)
 		protected.POST("/configs/:id/set-default", s3Service.SetDefaultConfig)
+		protected.POST("/configs/:id/set-enabled", s3Service.SetConfigEnabled)
+		protected.GET("/configs/:id/health", s3Service.GetConfigHealth)
 		protected.POST("/configs/auto-minio", s3Service.AutoConfigureMinIO)
+		protected.POST("/configs/test", s3Service.TestConnection)
+		protected.POST("/configs/validate-all", s3Service.ValidateAllConfigs)
 
 		// File operation routes
-		protected.POST("/files/upload", s3Service.UploadFile)
-		protected.GET("/files/download/:key", s3Service.DownloadFile)
+		protected.POST("/files/upload", s3Service.limitTransfers, s3Service.UploadFile)
+		protected.GET("/files/download/:key", s3Service.limitTransfers, s3Service.DownloadFile)
+		protected.GET("/files/presign/:key", s3Service.PresignDownload)
+		protected.POST("/files/presign-batch", s3Service.PresignDownloadBatch)
+		protected.POST("/files/presign-upload", s3Service.PresignUpload)
+		protected.POST("/files/copy", s3Service.CopyFile)
+		protected.POST("/files/move", s3Service.MoveFile)
+		protected.POST("/files/duplicate", s3Service.DuplicateFile)
+		protected.POST("/files/move-prefix", s3Service.MovePrefix)
+		protected.POST("/files/batch-delete", s3Service.BatchDeleteFiles)
+		protected.POST("/files/upload/resume", s3Service.limitTransfers, s3Service.ResumeUpload)
+		protected.GET("/files/uploads", s3Service.ListUploads)
+		protected.DELETE("/files/uploads/:id", s3Service.AbortUpload)
+		protected.GET("/files/preview/:key", s3Service.limitTransfers, s3Service.PreviewFile)
+		protected.GET("/files/meta/:key", s3Service.GetFileMeta)
+		protected.GET("/files/:key/metadata", s3Service.GetObjectMetadata)
+		protected.GET("/files/:key/tags", s3Service.GetObjectTags)
+		protected.PUT("/files/:key/tags", s3Service.SetObjectTags)
+		protected.GET("/files/:key/versions", s3Service.GetObjectVersions)
 		protected.DELETE("/files/:key", s3Service.DeleteFile)
+		protected.POST("/files/delete-preview", s3Service.PreviewDelete)
+		protected.GET("/files/count", s3Service.CountFiles)
+		protected.GET("/files/manifest", s3Service.GetManifest)
+		protected.POST("/files/folder", s3Service.CreateFolder)
 		protected.GET("/files", s3Service.ListFiles)
+		protected.GET("/limits", s3Service.GetLimits)
+		protected.GET("/usage", s3Service.GetUsage)
+		protected.GET("/stats", s3Service.GetStats)
 	}
 
 	// Admin-only routes
 	admin := api.Group("/admin")
 	admin.Use(AuthMiddleware(authService))
 	admin.Use(AdminMiddleware(authService)) // Custom middleware to check admin status
+	// Full exports share one per-user rate limit
+	exportLimit := exportRateLimit(cfg.Security, auditService)
 	{
 		// Bulk user import/export
-		admin.GET("/users/export", authService.ExportUsersHandler)
+		admin.GET("/users/export", exportLimit, authService.ExportUsersHandler)
 		admin.POST("/users/import", authService.ImportUsersHandler)
 
 		// User management list
 		admin.GET("/users", authService.ListUsersHandler)
+		admin.GET("/users/search", authService.SearchUsersHandler)
 
 		// Bulk config import/export
-		admin.GET("/configs/export", s3Service.ExportConfigsHandler)
+		admin.GET("/configs/export", exportLimit, s3Service.ExportConfigsHandler)
 		admin.POST("/configs/import", s3Service.ImportConfigsHandler)
 
 		// User management routes
+		admin.POST("/users/bulk-update", authService.BulkUpdateUsersHandler)
 		admin.PUT("/users/:username", authService.UpdateUser)
 		admin.DELETE("/users/:username", authService.DeleteUser)
+		admin.POST("/users/:username/reset-password", authService.ResetPasswordHandler)
+		admin.PUT("/users/:username/quota", authService.SetQuotaHandler)
 		admin.GET("/users/:username/config", authService.GetUserConfig)
 
+		// Cross-user file access for investigations
+		admin.GET("/files/download", s3Service.limitTransfers, s3Service.AdminDownloadFile)
+
+		// Storage statistics across users
+		admin.GET("/stats", s3Service.GetAllStats)
+
 		// Audit log routes
 		admin.GET("/audit-logs", auditService.GetAuditLogsHandler)
-		admin.GET("/audit-logs/export", auditService.ExportAuditLogsHandler)
+		admin.GET("/audit-logs/export", exportLimit, auditService.ExportAuditLogsHandler)
+		admin.GET("/audit-logs/stream", auditService.StreamAuditLogsHandler)
+		admin.GET("/audit-logs/failures", auditService.GetAuditFailuresHandler)
 		admin.POST("/audit-logs/filter", auditService.PostAuditLogsFilterHandler)
 		admin.GET("/audit-logs/incident/:session_id", auditService.GetAuditLogsByIncidentHandler)
+		admin.GET("/audit-logs/verify", auditService.VerifyAuditChainHandler)
+	}
+
+	// Super-admin routes
+	superAdmin := admin.Group("")
+	superAdmin.Use(SuperAdminMiddleware(authService))
+	{
+		// Organization management
+		superAdmin.GET("/orgs", orgService.ListOrganizationsHandler)
+		superAdmin.POST("/orgs", orgService.CreateOrganizationHandler)
+
+		// Database backup and restore; a backup holds every organization's data
+		superAdmin.POST("/backup", backupService.BackupHandler)
+		superAdmin.POST("/restore", backupService.RestoreHandler)
+
+		// Outbound delivery dead-letter list; payloads are audit entries from every organization
+		superAdmin.GET("/deliveries/dead", deliveryQueue.ListDeadLettersHandler)
+		superAdmin.POST("/deliveries/dead/:id/retry", deliveryQueue.RetryDeadLetterHandler)
+		superAdmin.DELETE("/deliveries/dead/:id", deliveryQueue.DiscardDeadLetterHandler)
+	}
+
+	// Optionally serve the frontend for single-binary deployments
+	if cfg.Server.StaticDir != "" {
+		r.NoRoute(StaticFilesHandler(cfg.Server.StaticDir, basePath))
+		logger.Info("Serving frontend static files", map[string]interface{}{
+			"dir": cfg.Server.StaticDir,
+		})
 	}
 
 	// Start server
@@ -187,6 +348,35 @@ func main() {
 	log.Fatal(server.ListenAndServe())
 }
 
+// StaticFilesHandler serves files from dir and falls back to index.html for
+// unknown non-API paths under basePath so client-side routing works
+func StaticFilesHandler(dir, basePath string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestPath := c.Request.URL.Path
+		if basePath != "" {
+			if requestPath != basePath && !strings.HasPrefix(requestPath, basePath+"/") {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+				return
+			}
+			requestPath = strings.TrimPrefix(requestPath, basePath)
+		}
+		if strings.HasPrefix(requestPath, "/api/") || requestPath == "/api" ||
+			(c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+
+		// Cleaning against "/" keeps the path inside dir
+		filePath := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+requestPath)))
+		if info, err := os.Stat(filePath); err == nil && !info.IsDir() {
+			c.File(filePath)
+			return
+		}
+
+		c.File(filepath.Join(dir, "index.html"))
+	}
+}
+
 // AdminMiddleware checks if the user is an admin
 func AdminMiddleware(authService *AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -198,12 +388,16 @@ func AdminMiddleware(authService *AuthService) gin.HandlerFunc {
 		}
 
 		user, err := authService.GetUserByUsername(username.(string))
-		if err != nil || !user.IsAdmin {
+		if err != nil || !(user.IsAdmin || user.IsSuperAdmin) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Admin privileges required"})
 			c.Abort()
 			return
 		}
 
+		// Refresh organization scope from the stored user rather than the token
+		c.Set("org_id", user.OrgID)
+		c.Set("is_super_admin", user.IsSuperAdmin)
+
 		c.Next()
 	}
 }
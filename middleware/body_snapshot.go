@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// redacted replaces sensitive values in logged body snapshots
+const redacted = "[REDACTED]"
+
+// maxCapturedBody is the most of a JSON body kept for redaction; a larger
+// body is only summarized
+const maxCapturedBody = 1 << 20
+
+// sensitiveKeyParts mark JSON keys whose values are never logged; a key is
+// sensitive if it contains any of them, case-insensitively
+var sensitiveKeyParts = []string{
+	"password", "secret", "token", "access_key", "accesskey",
+	"authorization", "credential", "api_key", "apikey", "session_id",
+}
+
+// sensitiveValueParts mark string values that carry credentials whatever
+// their key, such as presigned URLs
+var sensitiveValueParts = []string{"X-Amz-Signature=", "X-Amz-Credential="}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValue returns v with sensitive values replaced, recursing into
+// objects and arrays
+func redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, inner := range val {
+			if isSensitiveKey(k) {
+				val[k] = redacted
+			} else {
+				val[k] = redactValue(inner)
+			}
+		}
+		return val
+	case []interface{}:
+		for i, inner := range val {
+			val[i] = redactValue(inner)
+		}
+		return val
+	case string:
+		for _, part := range sensitiveValueParts {
+			if strings.Contains(val, part) {
+				return redacted
+			}
+		}
+		return val
+	}
+	return v
+}
+
+// bodySnapshot returns a redacted copy of body for the request log, cut to
+// maxBytes. Only JSON can be redacted field by field, so any other content
+// type is summarized instead of logged.
+func bodySnapshot(body []byte, contentType string, maxBytes int) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if !isJSON(contentType) {
+		return fmt.Sprintf("[%d bytes of %s omitted]", len(body), contentTypeOrUnknown(contentType))
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		// Malformed JSON may still hold credentials, so it is not logged verbatim
+		return fmt.Sprintf("[%d bytes of invalid JSON omitted: %v]", len(body), err)
+	}
+	snapshot, err := json.Marshal(redactValue(parsed))
+	if err != nil {
+		return ""
+	}
+	if len(snapshot) > maxBytes {
+		// Cut on a character boundary
+		n := maxBytes
+		for n > 0 && !utf8.RuneStart(snapshot[n]) {
+			n--
+		}
+		return string(snapshot[:n]) + "...[truncated]"
+	}
+	return string(snapshot)
+}
+
+// bodyCapture keeps a JSON body for its snapshot, up to maxCapturedBody bytes
+type bodyCapture struct {
+	buf      bytes.Buffer
+	overflow bool
+}
+
+func (b *bodyCapture) add(p []byte) {
+	if b.overflow {
+		return
+	}
+	if b.buf.Len()+len(p) > maxCapturedBody {
+		b.overflow = true
+		b.buf = bytes.Buffer{}
+		return
+	}
+	b.buf.Write(p)
+}
+
+// capturedSnapshot returns the snapshot of a body of size bytes. capture is
+// nil when the body was not captured, e.g. because it is not JSON.
+func capturedSnapshot(capture *bodyCapture, size int64, contentType string, maxBytes int) string {
+	switch {
+	case size <= 0:
+		return ""
+	case capture == nil || !isJSON(contentType):
+		return fmt.Sprintf("[%d bytes of %s omitted]", size, contentTypeOrUnknown(contentType))
+	case capture.overflow:
+		return fmt.Sprintf("[%d bytes of JSON omitted: too large to redact]", size)
+	}
+	return bodySnapshot(capture.buf.Bytes(), contentType, maxBytes)
+}
+
+func isJSON(contentType string) bool {
+	return strings.Contains(strings.ToLower(contentType), "json")
+}
+
+func contentTypeOrUnknown(contentType string) string {
+	if contentType == "" {
+		return "unknown content type"
+	}
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return contentType
+}
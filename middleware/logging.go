@@ -1,43 +1,111 @@
 package middleware
 
 import (
-	"bytes"
 	"io"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	"s3mgr/logger"
 )
 
+// countingReader counts the request body bytes a handler reads, capturing
+// them too when capture is set
+type countingReader struct {
+	io.ReadCloser
+	n       int64
+	capture *bodyCapture
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	if r.capture != nil {
+		r.capture.add(p[:n])
+	}
+	return n, err
+}
+
+// responseWriter captures JSON responses for the request log; the size of
+// every response is counted by gin itself
 type responseWriter struct {
 	gin.ResponseWriter
-	body *bytes.Buffer
+	capture *bodyCapture
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	if isJSON(w.Header().Get("Content-Type")) {
+		w.capture.add(b[:n])
+	}
+	return n, err
+}
+
+func (w *responseWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	if isJSON(w.Header().Get("Content-Type")) {
+		w.capture.add([]byte(s[:n]))
+	}
+	return n, err
 }
 
-func (w responseWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
-	return w.ResponseWriter.Write(b)
+// excludedPath reports whether path is one of excluded or below one of them
+func excludedPath(path string, excluded []string) bool {
+	for _, p := range excluded {
+		p = strings.TrimSuffix(p, "/")
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
 }
 
-// RequestLogger creates a middleware that logs all HTTP requests with detailed information
-func RequestLogger() gin.HandlerFunc {
+// RequestLogger creates a middleware that logs all HTTP requests with detailed information.
+// With cfg.LogBodies set, requests logged while the level is debug also carry
+// redacted snapshots of JSON request and response bodies; other bodies, such
+// as file transfers, are only counted and never held in memory. Successful
+// requests to cfg.ExcludePaths under basePath, such as health probes, are not logged.
+func RequestLogger(cfg logger.LogConfig, basePath string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if excludedPath(strings.TrimPrefix(c.Request.URL.Path, basePath), cfg.ExcludePaths) {
+			c.Next()
+			if c.Writer.Status() < http.StatusInternalServerError {
+				return
+			}
+			logger.LogRequest(logger.RequestLog{
+				Timestamp:  time.Now(),
+				Method:     c.Request.Method,
+				Path:       c.Request.URL.Path,
+				StatusCode: c.Writer.Status(),
+				ClientIP:   c.ClientIP(),
+				UserAgent:  c.Request.UserAgent(),
+			})
+			return
+		}
+
 		start := time.Now()
 
-		// Capture request body size
-		var requestSize int64
+		// Body snapshots are checked against the current level, so they follow
+		// runtime log level changes
+		logBodies := cfg.LogBodies && logger.Logger.IsLevelEnabled(logrus.DebugLevel)
+		requestType := c.Request.Header.Get("Content-Type")
+
+		// Count the request body as the handler reads it
+		var requestBody *countingReader
 		if c.Request.Body != nil {
-			bodyBytes, _ := io.ReadAll(c.Request.Body)
-			requestSize = int64(len(bodyBytes))
-			c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+			requestBody = &countingReader{ReadCloser: c.Request.Body}
+			if logBodies && isJSON(requestType) {
+				requestBody.capture = &bodyCapture{}
+			}
+			c.Request.Body = requestBody
 		}
-
-		// Create custom response writer to capture response size
-		blw := &responseWriter{
-			ResponseWriter: c.Writer,
-			body:           bytes.NewBufferString(""),
+		var responseCapture *bodyCapture
+		if logBodies {
+			responseCapture = &bodyCapture{}
+			c.Writer = &responseWriter{ResponseWriter: c.Writer, capture: responseCapture}
 		}
-		c.Writer = blw
 
 		// Process request
 		c.Next()
@@ -55,6 +123,26 @@ func RequestLogger() gin.HandlerFunc {
 			errorMsg = c.Errors.String()
 		}
 
+		// The declared length also covers a body the handler did not read
+		requestSize := c.Request.ContentLength
+		if requestSize < 0 && requestBody != nil {
+			requestSize = requestBody.n
+		}
+		responseSize := c.Writer.Size()
+		if responseSize < 0 {
+			responseSize = 0
+		}
+
+		var requestSnapshot, responseSnapshot string
+		if logBodies {
+			var requestCapture *bodyCapture
+			if requestBody != nil {
+				requestCapture = requestBody.capture
+			}
+			requestSnapshot = capturedSnapshot(requestCapture, requestSize, requestType, cfg.BodyMaxBytes)
+			responseSnapshot = capturedSnapshot(responseCapture, int64(responseSize), c.Writer.Header().Get("Content-Type"), cfg.BodyMaxBytes)
+		}
+
 		// Log the request
 		logger.LogRequest(logger.RequestLog{
 			Timestamp:    start,
@@ -67,8 +155,10 @@ func RequestLogger() gin.HandlerFunc {
 			UserID:       getStringValue(userID),
 			Username:     getStringValue(username),
 			RequestSize:  requestSize,
-			ResponseSize: blw.body.Len(),
+			ResponseSize: responseSize,
 			Error:        errorMsg,
+			RequestBody:  requestSnapshot,
+			ResponseBody: responseSnapshot,
 		})
 	}
 }
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"s3mgr/logger"
+)
+
+func TestRequestLoggerBodies(t *testing.T) {
+	if err := logger.Initialize(logger.LogConfig{Level: "debug", Format: "json"}); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	logger.Logger.SetOutput(&out)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestLogger(logger.LogConfig{LogBodies: true, BodyMaxBytes: 1024}, ""))
+	r.POST("/login", func(c *gin.Context) {
+		var req map[string]string
+		c.ShouldBindJSON(&req)
+		c.JSON(http.StatusOK, gin.H{"token": "abc", "username": req["username"]})
+	})
+	r.POST("/upload", func(c *gin.Context) {
+		n, _ := io.Copy(io.Discard, c.Request.Body)
+		c.Data(http.StatusOK, "application/octet-stream", bytes.Repeat([]byte{1}, int(n)))
+	})
+
+	tests := []struct {
+		name             string
+		path             string
+		contentType      string
+		body             string
+		wantRequestBody  string
+		wantResponseBody string
+	}{
+		{"JSON is redacted", "/login", "application/json", `{"username":"alice","password":"hunter2"}`,
+			`{"password":"[REDACTED]","username":"alice"}`, `{"token":"[REDACTED]","username":"alice"}`},
+		{"files are only counted", "/upload", "application/octet-stream", strings.Repeat("x", 4096),
+			"[4096 bytes of application/octet-stream omitted]", "[4096 bytes of application/octet-stream omitted]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out.Reset()
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			var entry struct {
+				RequestSize  int64  `json:"request_size"`
+				ResponseSize int    `json:"response_size"`
+				RequestBody  string `json:"request_body"`
+				ResponseBody string `json:"response_body"`
+			}
+			if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+				t.Fatalf("parse log entry %q: %v", out.String(), err)
+			}
+			if entry.RequestSize != int64(len(tt.body)) || entry.ResponseSize == 0 {
+				t.Errorf("sizes = %d, %d; want %d and the response size", entry.RequestSize, entry.ResponseSize, len(tt.body))
+			}
+			if entry.RequestBody != tt.wantRequestBody {
+				t.Errorf("request_body = %q, want %q", entry.RequestBody, tt.wantRequestBody)
+			}
+			if entry.ResponseBody != tt.wantResponseBody {
+				t.Errorf("response_body = %q, want %q", entry.ResponseBody, tt.wantResponseBody)
+			}
+		})
+	}
+}
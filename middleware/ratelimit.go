@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"s3mgr/config"
+)
+
+// tokenBucket is one client's remaining allowance, refilled continuously
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter keeps a token bucket per client IP. Buckets are kept per
+// instance, like upload locks.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // Tokens added per second
+	capacity  float64 // Largest burst a client may send
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{
+		rate:      float64(perMinute) / 60,
+		capacity:  float64(perMinute),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// take spends one of key's tokens, or returns false and how long until the
+// next token is available
+func (l *rateLimiter) take(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	// Forget clients whose buckets have refilled, so the map does not grow with every IP ever seen
+	if now.Sub(l.lastSweep) >= time.Minute {
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= l.capacity {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.capacity, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(l.capacity, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// parseAllowlist turns IPs and CIDR ranges into networks; entries were
+// checked when the config was loaded
+func parseAllowlist(entries []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipNet)
+		}
+	}
+	return nets
+}
+
+// RateLimit creates a middleware that limits requests per client IP to
+// cfg.RequestsPerMinute, with a separate, stricter bucket for paths under
+// authPrefix. Clients over the limit get 429 with a Retry-After header;
+// clients in cfg.Allowlist are never limited.
+func RateLimit(cfg config.RateLimitConfig, authPrefix string) gin.HandlerFunc {
+	if cfg.RequestsPerMinute < 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	general := newRateLimiter(cfg.RequestsPerMinute)
+	var auth *rateLimiter
+	if cfg.AuthRequestsPerMinute > 0 {
+		auth = newRateLimiter(cfg.AuthRequestsPerMinute)
+	}
+	allowlist := parseAllowlist(cfg.Allowlist)
+
+	return func(c *gin.Context) {
+		clientIP := c.ClientIP()
+		if ip := net.ParseIP(clientIP); ip != nil {
+			for _, allowed := range allowlist {
+				if allowed.Contains(ip) {
+					c.Next()
+					return
+				}
+			}
+		}
+
+		limiter := general
+		if auth != nil && strings.HasPrefix(c.Request.URL.Path, authPrefix) {
+			limiter = auth
+		}
+		ok, wait := limiter.take(clientIP)
+		if ok {
+			c.Next()
+			return
+		}
+
+		retryAfter := int(wait/time.Second) + 1
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many requests; try again later",
+			"code":        "rate_limited",
+			"retry_after": retryAfter,
+		})
+	}
+}
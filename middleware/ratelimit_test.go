@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	tests := []struct {
+		name      string
+		perMinute int
+		takes     int
+		idle      time.Duration // How long the bucket sits unused before the last take
+		allowed   int
+	}{
+		{"within the burst", 5, 3, 0, 3},
+		{"whole burst", 5, 5, 0, 5},
+		{"beyond the burst", 5, 8, 0, 5},
+		{"refilled after a pause", 60, 61, 2 * time.Second, 61},
+		{"refill stops at capacity", 2, 4, time.Hour, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(tt.perMinute)
+			allowed := 0
+			for i := 0; i < tt.takes; i++ {
+				if i == tt.takes-1 && tt.idle > 0 {
+					l.buckets["client"].updated = time.Now().Add(-tt.idle)
+				}
+				if ok, _ := l.take("client"); ok {
+					allowed++
+				}
+			}
+			if allowed != tt.allowed {
+				t.Errorf("allowed %d of %d takes, want %d", allowed, tt.takes, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestRateLimiterRetryAfter(t *testing.T) {
+	l := newRateLimiter(60)
+	for i := 0; i < 60; i++ {
+		l.take("client")
+	}
+	ok, wait := l.take("client")
+	if ok {
+		t.Fatal("take succeeded with an empty bucket")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("wait = %v, want up to the 1s one token takes to refill", wait)
+	}
+}
+
+func TestRateLimiterKeysAreIndependent(t *testing.T) {
+	l := newRateLimiter(1)
+	if ok, _ := l.take("a"); !ok {
+		t.Fatal("first take for a was refused")
+	}
+	if ok, _ := l.take("a"); ok {
+		t.Error("second take for a was allowed")
+	}
+	if ok, _ := l.take("b"); !ok {
+		t.Error("b was limited by a's usage")
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	l := newRateLimiter(60)
+	l.take("idle")
+	l.take("busy")
+	for i := 0; i < 59; i++ {
+		l.take("busy")
+	}
+	// "idle" has refilled by the next sweep; "busy" has not
+	l.buckets["idle"].updated = time.Now().Add(-time.Minute)
+	l.lastSweep = time.Now().Add(-time.Minute)
+	l.take("other")
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("refilled bucket was not swept")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("bucket still in use was swept")
+	}
+}
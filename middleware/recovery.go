@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"s3mgr/audit"
+	"s3mgr/logger"
+)
+
+// Recovery creates a middleware that recovers from panics, logs the panic and
+// stack trace through our logger, records a "panic" audit event and returns a
+// sanitized 500 response
+func Recovery(auditService *audit.AuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				stack := string(debug.Stack())
+				path := c.Request.URL.Path
+
+				userID, _ := c.Get("user_id")
+				username, _ := c.Get("username")
+
+				logger.Error("Panic recovered", fmt.Errorf("%v", rec), logrus.Fields{
+					"method":    c.Request.Method,
+					"path":      path,
+					"client_ip": c.ClientIP(),
+					"user_id":   getStringValue(userID),
+					"username":  getStringValue(username),
+					"stack":     stack,
+				})
+
+				if auditService != nil {
+					auditService.LogEvent(c, "panic", "request", "", false, fmt.Errorf("%v", rec), map[string]interface{}{
+						"method": c.Request.Method,
+						"path":   path,
+					})
+				}
+
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			}
+		}()
+
+		c.Next()
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/gin-gonic/gin"
+
+	"s3mgr/logger"
+)
+
+// ObjectChecksum is the SHA-256 of an object's content as uploaded through the
+// server. Entries are stored under object_checksum:<configID>:<fullKey>,
+// follow the object when it is copied or moved and are dropped when it is
+// deleted or replaced by content the server never sees (presigned uploads).
+type ObjectChecksum struct {
+	SHA256     string    `json:"sha256"`
+	Size       int64     `json:"size"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+func objectChecksumKey(configID, fullKey string) []byte {
+	return []byte("object_checksum:" + configID + ":" + fullKey)
+}
+
+// checksumContent returns the hex SHA-256 of the first size bytes of r
+func checksumContent(r io.ReaderAt, size int64) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, size)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// setObjectChecksum records the checksum of fullKey, replacing any earlier one
+func (s *S3Service) setObjectChecksum(configID, fullKey string, sum ObjectChecksum) error {
+	data, err := json.Marshal(sum)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(objectChecksumKey(configID, fullKey), data)
+	})
+}
+
+// clearObjectChecksum drops the checksum of fullKey, if any
+func (s *S3Service) clearObjectChecksum(configID, fullKey string) {
+	err := s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(objectChecksumKey(configID, fullKey))
+	})
+	if err != nil {
+		logger.Warn("Failed to clear object checksum", map[string]interface{}{
+			"config_id": configID,
+			"key":       fullKey,
+			"error":     err.Error(),
+		})
+	}
+}
+
+// getObjectChecksum returns the checksum of fullKey, or nil if there is none
+func (s *S3Service) getObjectChecksum(configID, fullKey string) (*ObjectChecksum, error) {
+	var sum ObjectChecksum
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(objectChecksumKey(configID, fullKey))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &sum)
+		})
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sum, nil
+}
+
+// copyObjectChecksum gives destKey the checksum of sourceKey after a
+// server-side copy, removing the source's entry when move is set. A source
+// without a checksum leaves destKey without one too.
+func (s *S3Service) copyObjectChecksum(configID, sourceKey, destKey string, move bool) {
+	err := s.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(objectChecksumKey(configID, sourceKey))
+		if err == badger.ErrKeyNotFound {
+			return txn.Delete(objectChecksumKey(configID, destKey))
+		}
+		if err != nil {
+			return err
+		}
+		data, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if err := txn.Set(objectChecksumKey(configID, destKey), data); err != nil {
+			return err
+		}
+		if move {
+			return txn.Delete(objectChecksumKey(configID, sourceKey))
+		}
+		return nil
+	})
+	if err != nil {
+		// Better no checksum than one describing other content
+		logger.Warn("Failed to copy object checksum", map[string]interface{}{
+			"config_id":  configID,
+			"source_key": sourceKey,
+			"dest_key":   destKey,
+			"error":      err.Error(),
+		})
+		s.clearObjectChecksum(configID, destKey)
+	}
+}
+
+// recordUploadChecksum hashes an uploaded file and stores its checksum. The
+// upload has already succeeded, so a failure only leaves the key out of the
+// manifest.
+func (s *S3Service) recordUploadChecksum(configID, fullKey string, content io.ReaderAt, size int64) string {
+	sum, err := checksumContent(content, size)
+	if err == nil {
+		err = s.setObjectChecksum(configID, fullKey, ObjectChecksum{SHA256: sum, Size: size, UploadedAt: time.Now().UTC()})
+	}
+	if err != nil {
+		logger.Warn("Failed to record upload checksum", map[string]interface{}{
+			"config_id": configID,
+			"key":       fullKey,
+			"error":     err.Error(),
+		})
+		s.clearObjectChecksum(configID, fullKey)
+		return ""
+	}
+	return sum
+}
+
+// GetManifest returns the SHA-256 and size of every object under prefix that
+// was uploaded through the server, so clients can verify their local copies.
+// Objects uploaded with presigned URLs or directly to the bucket are not listed.
+func (s *S3Service) GetManifest(c *gin.Context) {
+	userID := c.GetString("user_id")
+	configID := c.Query("config_id")
+	prefix := c.Query("prefix")
+	if strings.HasPrefix(prefix, "/") || strings.Contains(prefix, "..") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prefix"})
+		return
+	}
+
+	config, err := s.resolveConfig(userID, configID)
+	if respondConfigError(c, err) {
+		return
+	}
+
+	entryPrefix := objectChecksumKey(config.ID, s.userPrefix(userID))
+	searchPrefix := objectChecksumKey(config.ID, s.userPrefix(userID)+prefix)
+	objects := make([]gin.H, 0)
+	err = s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(searchPrefix); it.ValidForPrefix(searchPrefix); it.Next() {
+			var sum ObjectChecksum
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &sum)
+			}); err != nil {
+				return err
+			}
+			objects = append(objects, gin.H{
+				"key":         strings.TrimPrefix(string(it.Item().Key()), string(entryPrefix)),
+				"sha256":      sum.SHA256,
+				"size":        sum.Size,
+				"uploaded_at": sum.UploadedAt,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read manifest"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"config_id": config.ID,
+		"prefix":    prefix,
+		"count":     len(objects),
+		"objects":   objects,
+	})
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/dgraph-io/badger/v4"
+
+	"s3mgr/logger"
+)
+
+// maxObjectTTL is the longest expires_in accepted on upload
+const maxObjectTTL = 365 * 24 * time.Hour
+
+// ObjectExpiry schedules an uploaded object for deletion. Entries are stored
+// under object_expiry:<configID>:<fullKey> and removed once the object is gone.
+type ObjectExpiry struct {
+	ConfigID  string    `json:"config_id"`
+	UserID    string    `json:"user_id"`
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func objectExpiryKey(configID, fullKey string) []byte {
+	return []byte("object_expiry:" + configID + ":" + fullKey)
+}
+
+// parseObjectTTL parses expires_in given as seconds ("86400") or a Go
+// duration ("24h"), bounded to 1s..maxObjectTTL
+func parseObjectTTL(value string) (time.Duration, error) {
+	var ttl time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		ttl = time.Duration(seconds) * time.Second
+	} else if ttl, err = time.ParseDuration(value); err != nil {
+		return 0, fmt.Errorf("invalid expires_in %q: use seconds or a duration like 24h", value)
+	}
+	if ttl < time.Second || ttl > maxObjectTTL {
+		return 0, fmt.Errorf("expires_in must be between 1s and %s", maxObjectTTL)
+	}
+	return ttl, nil
+}
+
+// setObjectExpiry schedules fullKey for deletion at expiresAt, replacing any earlier schedule
+func (s *S3Service) setObjectExpiry(expiry ObjectExpiry) error {
+	data, err := json.Marshal(expiry)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(objectExpiryKey(expiry.ConfigID, expiry.Key), data)
+	})
+}
+
+// clearObjectExpiry removes any scheduled deletion for fullKey
+func (s *S3Service) clearObjectExpiry(configID, fullKey string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(objectExpiryKey(configID, fullKey))
+	})
+}
+
+// dropObjectExpiry removes fullKey's schedule once the object it was set for
+// is deleted or replaced, so the sweep never deletes a later object written
+// under the same key
+func (s *S3Service) dropObjectExpiry(configID, fullKey string) {
+	if err := s.clearObjectExpiry(configID, fullKey); err != nil {
+		logger.Warn("Failed to clear object expiry", map[string]interface{}{
+			"config_id": configID,
+			"key":       fullKey,
+			"error":     err.Error(),
+		})
+	}
+}
+
+// moveObjectExpiry moves sourceKey's schedule to destKey after the object was
+// moved there. A source without a schedule leaves destKey without one too.
+func (s *S3Service) moveObjectExpiry(configID, sourceKey, destKey string) {
+	err := s.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(objectExpiryKey(configID, sourceKey))
+		if err == badger.ErrKeyNotFound {
+			return txn.Delete(objectExpiryKey(configID, destKey))
+		}
+		if err != nil {
+			return err
+		}
+		var expiry ObjectExpiry
+		if err := item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &expiry)
+		}); err != nil {
+			return err
+		}
+		expiry.Key = destKey
+		data, err := json.Marshal(expiry)
+		if err != nil {
+			return err
+		}
+		if err := txn.Set(objectExpiryKey(configID, destKey), data); err != nil {
+			return err
+		}
+		return txn.Delete(objectExpiryKey(configID, sourceKey))
+	})
+	if err != nil {
+		// Better an object that outlives its expiry than a schedule pointing at other content
+		logger.Warn("Failed to move object expiry", map[string]interface{}{
+			"config_id":  configID,
+			"source_key": sourceKey,
+			"dest_key":   destKey,
+			"error":      err.Error(),
+		})
+		s.dropObjectExpiry(configID, sourceKey)
+		s.dropObjectExpiry(configID, destKey)
+	}
+}
+
+// getObjectExpiry returns the scheduled deletion for fullKey, or nil if there is none
+func (s *S3Service) getObjectExpiry(configID, fullKey string) (*ObjectExpiry, error) {
+	var expiry ObjectExpiry
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(objectExpiryKey(configID, fullKey))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &expiry)
+		})
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &expiry, nil
+}
+
+// StartObjectExpiryJob periodically deletes uploaded objects whose expires_in has passed
+func (s *S3Service) StartObjectExpiryJob() {
+	interval := time.Duration(s.cfg.Upload.ExpirySweepSeconds) * time.Second
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.deleteExpiredObjects()
+		}
+	}()
+}
+
+// deleteExpiredObjects removes every object that is past its expiry and audit-logs each deletion
+func (s *S3Service) deleteExpiredObjects() {
+	now := time.Now()
+
+	var due []ObjectExpiry
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte("object_expiry:")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var expiry ObjectExpiry
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &expiry)
+			})
+			if err != nil {
+				return err
+			}
+			if !expiry.ExpiresAt.After(now) {
+				due = append(due, expiry)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("Object expiry scan failed", err)
+		return
+	}
+
+	for _, expiry := range due {
+		details := map[string]interface{}{
+			"config_id":  expiry.ConfigID,
+			"user_id":    expiry.UserID,
+			"expires_at": expiry.ExpiresAt,
+		}
+
+		// A deleted config leaves nothing to clean up through this service
+		config, err := s.getConfigByID(expiry.UserID, expiry.ConfigID)
+		if err != nil {
+			logger.Warn("Dropping expiry for missing configuration", map[string]interface{}{"config_id": expiry.ConfigID, "key": expiry.Key})
+			s.clearObjectExpiry(expiry.ConfigID, expiry.Key)
+			continue
+		}
+		client := s.createS3Client(*config)
+		if client == nil {
+			logger.Error("Failed to create storage client for object expiry", nil, details)
+			continue
+		}
+
+		_, err = client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(config.BucketName),
+			Key:    aws.String(expiry.Key),
+		})
+		if err != nil && !isObjectNotFound(err) {
+			// Keep the entry so the next sweep retries
+			logger.Error("Failed to delete expired object", err, details)
+			if s.auditService != nil {
+				s.auditService.LogSystemEvent(config.OrgID, "expire_object", "file", expiry.Key, false, err, details)
+			}
+			continue
+		}
+		if err := s.clearObjectExpiry(expiry.ConfigID, expiry.Key); err != nil {
+			logger.Error("Failed to clear object expiry", err, details)
+		}
+		s.invalidateUsage(expiry.UserID, expiry.ConfigID)
+		s.clearObjectChecksum(expiry.ConfigID, expiry.Key)
+		logger.Info("Deleted expired object", map[string]interface{}{"key": expiry.Key, "config_id": expiry.ConfigID})
+		if s.auditService != nil {
+			s.auditService.LogSystemEvent(config.OrgID, "expire_object", "file", expiry.Key, true, nil, details)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseObjectTTL(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"86400", 24 * time.Hour, false},
+		{"1", time.Second, false},
+		{"24h", 24 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"8760h", maxObjectTTL, false},
+		{"0", 0, true},
+		{"-5", 0, true},
+		{"500ms", 0, true},
+		{"8761h", 0, true},
+		{"31536001", 0, true},
+		{"", 0, true},
+		{"tomorrow", 0, true},
+		{"1d", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseObjectTTL(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseObjectTTL(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseObjectTTL(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gin-gonic/gin"
+)
+
+// S3 object tagging limits
+const (
+	maxObjectTags     = 10
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+	// tagPunctuation is allowed in tag keys and values besides letters, digits and spaces
+	tagPunctuation = "+-=._:/@"
+)
+
+type SetTagsRequest struct {
+	Tags map[string]string `json:"tags" binding:"required"`
+}
+
+// validTagText reports whether s only uses the characters S3 allows in tags
+func validTagText(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != ' ' && !strings.ContainsRune(tagPunctuation, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateTags checks a tag set against S3's limits: at most 10 tags, keys of
+// 1-128 characters not starting with the reserved "aws:" prefix, and values of
+// up to 256 characters
+func validateTags(tags map[string]string) error {
+	if len(tags) > maxObjectTags {
+		return fmt.Errorf("at most %d tags are allowed per object", maxObjectTags)
+	}
+	for k, v := range tags {
+		if k == "" || utf8.RuneCountInString(k) > maxTagKeyLength {
+			return fmt.Errorf("tag keys must be 1-%d characters", maxTagKeyLength)
+		}
+		if strings.HasPrefix(strings.ToLower(k), "aws:") {
+			return fmt.Errorf("tag key %q uses the reserved aws: prefix", k)
+		}
+		if utf8.RuneCountInString(v) > maxTagValueLength {
+			return fmt.Errorf("value of tag %q exceeds %d characters", k, maxTagValueLength)
+		}
+		if !validTagText(k) || !validTagText(v) {
+			return fmt.Errorf("tag %q may only contain letters, digits, spaces and %s", k, tagPunctuation)
+		}
+	}
+	return nil
+}
+
+// GetObjectMetadata returns the stored metadata of a file, including any user metadata
+func (s *S3Service) GetObjectMetadata(c *gin.Context) {
+	userID := c.GetString("user_id")
+	configID := c.Query("config_id")
+	key := c.Param("key")
+
+	fullKey, ok := s.userObjectKey(userID, key)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	config, err := s.resolveConfig(userID, configID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+
+	head, err := client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(config.BucketName),
+		Key:    aws.String(fullKey),
+	})
+	if isObjectNotFound(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file metadata: " + err.Error()})
+		return
+	}
+
+	// S3 omits the storage class header for STANDARD objects
+	storageClass := aws.StringValue(head.StorageClass)
+	if storageClass == "" {
+		storageClass = s3.StorageClassStandard
+	}
+	userMetadata := make(map[string]string, len(head.Metadata))
+	for k, v := range head.Metadata {
+		userMetadata[strings.ToLower(k)] = aws.StringValue(v)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key":           key,
+		"size":          aws.Int64Value(head.ContentLength),
+		"content_type":  aws.StringValue(head.ContentType),
+		"last_modified": aws.TimeValue(head.LastModified),
+		"etag":          aws.StringValue(head.ETag),
+		"storage_class": storageClass,
+		"metadata":      userMetadata,
+	})
+}
+
+// GetObjectTags returns the tags of a file as a JSON map
+func (s *S3Service) GetObjectTags(c *gin.Context) {
+	userID := c.GetString("user_id")
+	configID := c.Query("config_id")
+	key := c.Param("key")
+
+	fullKey, ok := s.userObjectKey(userID, key)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	config, err := s.resolveConfig(userID, configID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+
+	result, err := client.GetObjectTagging(&s3.GetObjectTaggingInput{
+		Bucket: aws.String(config.BucketName),
+		Key:    aws.String(fullKey),
+	})
+	if isObjectNotFound(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get tags: " + err.Error()})
+		return
+	}
+
+	tags := make(map[string]string, len(result.TagSet))
+	for _, tag := range result.TagSet {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	c.JSON(http.StatusOK, gin.H{"key": key, "tags": tags})
+}
+
+// SetObjectTags replaces the tags of a file with the given map. An empty map
+// removes all tags.
+func (s *S3Service) SetObjectTags(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "set_tags", "file", "", success, err, details)
+		}
+	}
+
+	userID := c.GetString("user_id")
+	configID := c.Query("config_id")
+	key := c.Param("key")
+
+	fullKey, ok := s.userObjectKey(userID, key)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	var req SetTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateTags(req.Tags); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	config, err := s.resolveConfig(userID, configID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+
+	// Sorted so the stored tag set and the audit entry are deterministic
+	keys := make([]string, 0, len(req.Tags))
+	for k := range req.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tagSet := make([]*s3.Tag, 0, len(keys))
+	for _, k := range keys {
+		tagSet = append(tagSet, &s3.Tag{Key: aws.String(k), Value: aws.String(req.Tags[k])})
+	}
+
+	_, err = client.PutObjectTagging(&s3.PutObjectTaggingInput{
+		Bucket:  aws.String(config.BucketName),
+		Key:     aws.String(fullKey),
+		Tagging: &s3.Tagging{TagSet: tagSet},
+	})
+	details := map[string]interface{}{
+		"config_id": config.ID,
+		"full_key":  fullKey,
+		"tag_keys":  keys,
+	}
+	if isObjectNotFound(err) {
+		logAudit(false, err, details)
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		logAudit(false, err, details)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set tags: " + err.Error()})
+		return
+	}
+
+	logAudit(true, nil, details)
+	c.JSON(http.StatusOK, gin.H{"key": key, "tags": req.Tags})
+}
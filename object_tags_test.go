@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidateTags(t *testing.T) {
+	tooMany := make(map[string]string)
+	for i := 0; i <= maxObjectTags; i++ {
+		tooMany[fmt.Sprintf("k%d", i)] = "v"
+	}
+	full := make(map[string]string)
+	for i := 0; i < maxObjectTags; i++ {
+		full[fmt.Sprintf("k%d", i)] = "v"
+	}
+
+	tests := []struct {
+		name    string
+		tags    map[string]string
+		wantErr bool
+	}{
+		{"no tags", map[string]string{}, false},
+		{"simple", map[string]string{"project": "alpha", "env": "prod"}, false},
+		{"allowed punctuation", map[string]string{"team:owner": "a.b+c-d=e_f/g@h"}, false},
+		{"unicode letters", map[string]string{"projekt": "größe 10"}, false},
+		{"empty value", map[string]string{"flag": ""}, false},
+		{"most tags allowed", full, false},
+		{"too many tags", tooMany, true},
+		{"empty key", map[string]string{"": "v"}, true},
+		{"longest key", map[string]string{strings.Repeat("k", maxTagKeyLength): "v"}, false},
+		{"key too long", map[string]string{strings.Repeat("k", maxTagKeyLength+1): "v"}, true},
+		{"longest value", map[string]string{"k": strings.Repeat("v", maxTagValueLength)}, false},
+		{"value too long", map[string]string{"k": strings.Repeat("v", maxTagValueLength+1)}, true},
+		{"length counted in characters", map[string]string{"k": strings.Repeat("é", maxTagValueLength)}, false},
+		{"reserved prefix", map[string]string{"aws:cost": "v"}, true},
+		{"reserved prefix in any case", map[string]string{"AWS:cost": "v"}, true},
+		{"invalid key character", map[string]string{"a*b": "v"}, true},
+		{"invalid value character", map[string]string{"k": "a#b"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTags(tt.tags)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateTags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
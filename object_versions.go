@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gin-gonic/gin"
+)
+
+// versioningCacheTTL is how long a bucket's versioning status is reused, so
+// listing files does not cost an extra request every time. Versioning can be
+// turned on outside the server, which shows up after at most this long.
+const versioningCacheTTL = 5 * time.Minute
+
+// Bucket versioning states. Buckets that never had versioning enabled report
+// no status at all, shown as versioningDisabled.
+const (
+	versioningEnabled  = s3.BucketVersioningStatusEnabled
+	versioningDisabled = "Disabled"
+)
+
+type versioningEntry struct {
+	status    string
+	err       error // Failed checks are cached too, so they are not retried on every listing
+	checkedAt time.Time
+}
+
+// versioningCache keeps recently checked bucket versioning states in memory,
+// keyed by config ID and bucket so a config pointed at another bucket is
+// checked again
+type versioningCache struct {
+	mu      sync.Mutex
+	entries map[string]versioningEntry
+}
+
+func newVersioningCache() *versioningCache {
+	return &versioningCache{entries: make(map[string]versioningEntry)}
+}
+
+func (vc *versioningCache) get(key string) (versioningEntry, bool) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	entry, ok := vc.entries[key]
+	if !ok || time.Since(entry.checkedAt) >= versioningCacheTTL {
+		delete(vc.entries, key)
+		return versioningEntry{}, false
+	}
+	return entry, true
+}
+
+func (vc *versioningCache) put(key, status string, err error) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	vc.entries[key] = versioningEntry{status: status, err: err, checkedAt: time.Now()}
+}
+
+// bucketVersioning returns the versioning status of config's bucket:
+// Enabled, Suspended or Disabled
+func (s *S3Service) bucketVersioning(client *s3.S3, config S3Config) (string, error) {
+	cacheKey := config.ID + ":" + config.BucketName
+	if entry, ok := s.versioning.get(cacheKey); ok {
+		return entry.status, entry.err
+	}
+	result, err := client.GetBucketVersioning(&s3.GetBucketVersioningInput{
+		Bucket: aws.String(config.BucketName),
+	})
+	if err != nil {
+		s.versioning.put(cacheKey, "", err)
+		return "", err
+	}
+	status := aws.StringValue(result.Status)
+	if status == "" {
+		status = versioningDisabled
+	}
+	s.versioning.put(cacheKey, status, nil)
+	return status, nil
+}
+
+// ObjectVersion is one version of an object, or a delete marker hiding the
+// versions before it
+type ObjectVersion struct {
+	VersionID      string    `json:"version_id"`
+	IsLatest       bool      `json:"is_latest"`
+	IsDeleteMarker bool      `json:"is_delete_marker"`
+	Size           int64     `json:"size"`
+	ETag           string    `json:"etag,omitempty"`
+	LastModified   time.Time `json:"last_modified"`
+}
+
+// listObjectVersions returns every version and delete marker of fullKey,
+// newest first. Objects written before versioning was enabled have the
+// version ID "null".
+func listObjectVersions(client *s3.S3, bucket, fullKey string) ([]ObjectVersion, error) {
+	var versions []ObjectVersion
+	err := client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(fullKey),
+	}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		// The prefix also matches longer keys, e.g. "a.txt.bak" for "a.txt"
+		for _, v := range page.Versions {
+			if aws.StringValue(v.Key) != fullKey {
+				continue
+			}
+			versions = append(versions, ObjectVersion{
+				VersionID:    aws.StringValue(v.VersionId),
+				IsLatest:     aws.BoolValue(v.IsLatest),
+				Size:         aws.Int64Value(v.Size),
+				ETag:         aws.StringValue(v.ETag),
+				LastModified: aws.TimeValue(v.LastModified),
+			})
+		}
+		for _, m := range page.DeleteMarkers {
+			if aws.StringValue(m.Key) != fullKey {
+				continue
+			}
+			versions = append(versions, ObjectVersion{
+				VersionID:      aws.StringValue(m.VersionId),
+				IsLatest:       aws.BoolValue(m.IsLatest),
+				IsDeleteMarker: true,
+				LastModified:   aws.TimeValue(m.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Versions and delete markers come back in separate lists
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].IsLatest != versions[j].IsLatest {
+			return versions[i].IsLatest
+		}
+		return versions[i].LastModified.After(versions[j].LastModified)
+	})
+	return versions, nil
+}
+
+// findObjectVersion returns the version of fullKey with the given ID, or nil
+// if the object has no such version
+func findObjectVersion(client *s3.S3, bucket, fullKey, versionID string) (*ObjectVersion, error) {
+	versions, err := listObjectVersions(client, bucket, fullKey)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		if versions[i].VersionID == versionID {
+			return &versions[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// GetObjectVersions lists every version and delete marker of a file, newest
+// first, along with the bucket's versioning status. A file deleted in a
+// versioned bucket still has versions here even though ListFiles no longer
+// shows it.
+func (s *S3Service) GetObjectVersions(c *gin.Context) {
+	userID := c.GetString("user_id")
+	configID := c.Query("config_id")
+	key := c.Param("key")
+
+	fullKey, ok := s.userObjectKey(userID, key)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	config, err := s.resolveConfig(userID, configID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+
+	versions, err := listObjectVersions(client, config.BucketName, fullKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list versions: " + err.Error()})
+		return
+	}
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	resp := gin.H{
+		"key":      key,
+		"count":    len(versions),
+		"versions": versions,
+	}
+	// Reading the status needs its own permission; the versions are useful without it
+	if status, err := s.bucketVersioning(client, *config); err == nil {
+		resp["versioning"] = status
+		resp["versioning_enabled"] = status == versioningEnabled
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// deleteObjectVersion permanently deletes one version of a file, or removes
+// a delete marker to bring back the version before it
+func (s *S3Service) deleteObjectVersion(c *gin.Context, client *s3.S3, config *S3Config, key, fullKey, versionID string) {
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "delete_file_version", "file", "", success, err, details)
+		}
+	}
+	userID := c.GetString("user_id")
+	details := map[string]interface{}{
+		"filename":   key,
+		"full_key":   fullKey,
+		"version_id": versionID,
+	}
+
+	// S3 reports success when deleting a missing version, so look it up first
+	version, err := findObjectVersion(client, config.BucketName, fullKey, versionID)
+	if err != nil {
+		logAudit(false, err, details)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list versions: " + err.Error()})
+		return
+	}
+	if version == nil {
+		logAudit(false, fmt.Errorf("version not found"), details)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return
+	}
+	details["is_latest"] = version.IsLatest
+	details["is_delete_marker"] = version.IsDeleteMarker
+
+	_, err = client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket:    aws.String(config.BucketName),
+		Key:       aws.String(fullKey),
+		VersionId: aws.String(versionID),
+	})
+	if err != nil {
+		logAudit(false, err, details)
+		if isObjectNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete version: " + err.Error()})
+		return
+	}
+	// Only the latest version is visible, so deleting an older one changes
+	// nothing the server tracks. Deleting the latest one makes an older
+	// version (or nothing) current, whose size and content are unknown.
+	if version.IsLatest {
+		s.invalidateUsage(userID, config.ID)
+		s.clearObjectChecksum(config.ID, fullKey)
+		s.dropObjectExpiry(config.ID, fullKey)
+	}
+	logAudit(true, nil, details)
+	message := "Version deleted permanently"
+	if version.IsDeleteMarker {
+		message = "Delete marker removed"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":          message,
+		"version_id":       versionID,
+		"is_delete_marker": version.IsDeleteMarker,
+	})
+}
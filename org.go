@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/gin-gonic/gin"
+
+	"s3mgr/audit"
+	"s3mgr/response"
+)
+
+// Organization groups users, configs and audit logs into an isolated tenant.
+// Users with an empty OrgID belong to the implicit default organization.
+type Organization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CreateOrganizationRequest struct {
+	ID   string `json:"id" binding:"required"`
+	Name string `json:"name"`
+}
+
+type OrgService struct {
+	db           *badger.DB
+	auditService *audit.AuditService
+}
+
+func NewOrgService(db *badger.DB, auditService *audit.AuditService) *OrgService {
+	return &OrgService{db: db, auditService: auditService}
+}
+
+// GetOrganization loads an organization by ID
+func (o *OrgService) GetOrganization(orgID string) (*Organization, error) {
+	var org Organization
+	err := o.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("org:" + orgID))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &org)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// GetAllOrganizations returns every organization
+func (o *OrgService) GetAllOrganizations() ([]Organization, error) {
+	var orgs []Organization
+
+	err := o.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = 10
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		prefix := []byte("org:")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			err := item.Value(func(val []byte) error {
+				var org Organization
+				if err := json.Unmarshal(val, &org); err != nil {
+					return err
+				}
+				orgs = append(orgs, org)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return orgs, err
+}
+
+// CreateOrganizationHandler creates a new organization (super-admin only)
+func (o *OrgService) CreateOrganizationHandler(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(orgID string, success bool, err error, details map[string]interface{}) {
+		if o.auditService != nil {
+			o.auditService.LogEvent(c, "create_org", "organization", orgID, success, err, details)
+		}
+	}
+
+	var req CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := o.GetOrganization(req.ID); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Organization already exists"})
+		return
+	}
+
+	org := Organization{
+		ID:        req.ID,
+		Name:      req.Name,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if org.Name == "" {
+		org.Name = org.ID
+	}
+
+	orgData, _ := json.Marshal(org)
+	err := o.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("org:"+org.ID), orgData)
+	})
+	if err != nil {
+		logAudit(org.ID, false, err, nil)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		return
+	}
+
+	logAudit(org.ID, true, nil, map[string]interface{}{"name": org.Name})
+	c.JSON(http.StatusCreated, gin.H{"message": "Organization created successfully", "organization": org})
+}
+
+// ListOrganizationsHandler returns all organizations (super-admin only)
+func (o *OrgService) ListOrganizationsHandler(c *gin.Context) {
+	orgs, err := o.GetAllOrganizations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get organizations"})
+		return
+	}
+	response.List(c, "organizations", orgs, response.All(len(orgs)), nil)
+}
+
+// canAccessOrg reports whether the current user may act on resources in orgID.
+// Super-admins can access every organization; everyone else only their own.
+func canAccessOrg(c *gin.Context, orgID string) bool {
+	if c.GetBool("is_super_admin") {
+		return true
+	}
+	return c.GetString("org_id") == orgID
+}
+
+// scopeUsersToOrg drops users outside the current user's organization
+func scopeUsersToOrg(c *gin.Context, users []UserResponse) []UserResponse {
+	if c.GetBool("is_super_admin") {
+		return users
+	}
+	var scoped []UserResponse
+	for _, u := range users {
+		if u.OrgID == c.GetString("org_id") {
+			scoped = append(scoped, u)
+		}
+	}
+	return scoped
+}
+
+// SuperAdminMiddleware checks if the user is a super-admin
+func SuperAdminMiddleware(authService *AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, exists := c.Get("username")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		user, err := authService.GetUserByUsername(username.(string))
+		if err != nil || !user.IsSuperAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Super-admin privileges required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// endpointStorageTypes are the storage types reached through a config's own
+// endpoint_url rather than AWS's regional endpoints
+var endpointStorageTypes = map[string]bool{
+	"minio":        true,
+	"gcs":          true,
+	"s3compatible": true,
+}
+
+// providerPreset fills in the endpoint and region of an s3compatible config
+// for a known provider
+type providerPreset struct {
+	Endpoint      string // Endpoint URL; "{region}" is replaced with the config's region
+	DefaultRegion string // Region used when the config has none ("" requires one)
+}
+
+// providerPresets are keyed by the config's provider hint. All of these
+// providers support virtual-host addressing, which is the default.
+var providerPresets = map[string]providerPreset{
+	"wasabi":       {Endpoint: "https://s3.{region}.wasabisys.com", DefaultRegion: "us-east-1"},
+	"backblaze":    {Endpoint: "https://s3.{region}.backblazeb2.com"}, // Region is part of the bucket's endpoint, e.g. us-west-004
+	"digitalocean": {Endpoint: "https://{region}.digitaloceanspaces.com", DefaultRegion: "nyc3"},
+}
+
+// providerNames lists the known provider hints for error messages
+func providerNames() string {
+	names := make([]string, 0, len(providerPresets))
+	for name := range providerPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// applyProviderPreset fills in an s3compatible config's region and endpoint
+// from its provider's preset, keeping any the client set explicitly. Configs
+// without a provider must give an endpoint and default to us-east-1.
+func applyProviderPreset(config *S3Config) error {
+	config.Provider = strings.ToLower(strings.TrimSpace(config.Provider))
+	if config.Provider == "" {
+		if strings.TrimSpace(config.Region) == "" {
+			config.Region = "us-east-1"
+		}
+		return nil
+	}
+	preset, ok := providerPresets[config.Provider]
+	if !ok {
+		return fmt.Errorf("unknown provider %q; use one of %s, or omit it and set endpoint_url", config.Provider, providerNames())
+	}
+	if strings.TrimSpace(config.Region) == "" {
+		if preset.DefaultRegion == "" {
+			return fmt.Errorf("region is required for provider %s", config.Provider)
+		}
+		config.Region = preset.DefaultRegion
+	}
+	if strings.TrimSpace(config.EndpointURL) == "" {
+		config.EndpointURL = strings.ReplaceAll(preset.Endpoint, "{region}", config.Region)
+	}
+	return nil
+}
+
+// forcePathStyle reports whether requests for config put the bucket in the
+// path (endpoint/bucket/key) instead of the host name (bucket.endpoint/key).
+// MinIO and GCS always use path-style; s3compatible configs choose.
+func (c S3Config) forcePathStyle() bool {
+	if c.StorageType == "s3compatible" {
+		return c.PathStyle
+	}
+	return true
+}
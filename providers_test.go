@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+func TestApplyProviderPreset(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       S3Config
+		wantRegion   string
+		wantEndpoint string
+		wantProvider string
+		wantErr      bool
+	}{
+		{
+			name:       "no provider defaults the region",
+			config:     S3Config{EndpointURL: "https://s3.example.com"},
+			wantRegion: "us-east-1", wantEndpoint: "https://s3.example.com",
+		},
+		{
+			name:       "no provider keeps the region",
+			config:     S3Config{Region: "eu-west-1", EndpointURL: "https://s3.example.com"},
+			wantRegion: "eu-west-1", wantEndpoint: "https://s3.example.com",
+		},
+		{
+			name:       "preset region and endpoint",
+			config:     S3Config{Provider: "wasabi"},
+			wantRegion: "us-east-1", wantEndpoint: "https://s3.us-east-1.wasabisys.com", wantProvider: "wasabi",
+		},
+		{
+			name:       "endpoint follows the region",
+			config:     S3Config{Provider: "digitalocean", Region: "ams3"},
+			wantRegion: "ams3", wantEndpoint: "https://ams3.digitaloceanspaces.com", wantProvider: "digitalocean",
+		},
+		{
+			name:       "explicit endpoint kept",
+			config:     S3Config{Provider: "wasabi", Region: "eu-central-1", EndpointURL: "https://s3.custom.example"},
+			wantRegion: "eu-central-1", wantEndpoint: "https://s3.custom.example", wantProvider: "wasabi",
+		},
+		{
+			name:       "provider name normalized",
+			config:     S3Config{Provider: "  BackBlaze ", Region: "us-west-004"},
+			wantRegion: "us-west-004", wantEndpoint: "https://s3.us-west-004.backblazeb2.com", wantProvider: "backblaze",
+		},
+		{
+			name:    "provider without a default region",
+			config:  S3Config{Provider: "backblaze"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown provider",
+			config:  S3Config{Provider: "acme"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			err := applyProviderPreset(&config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyProviderPreset() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if config.Region != tt.wantRegion || config.EndpointURL != tt.wantEndpoint || config.Provider != tt.wantProvider {
+				t.Errorf("got region %q, endpoint %q, provider %q; want %q, %q, %q",
+					config.Region, config.EndpointURL, config.Provider, tt.wantRegion, tt.wantEndpoint, tt.wantProvider)
+			}
+		})
+	}
+}
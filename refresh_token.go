@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+
+	"s3mgr/logger"
+	"s3mgr/middleware"
+	"s3mgr/session"
+)
+
+// tokenScopeRefresh marks a long-lived token that may only be exchanged at /auth/refresh
+const tokenScopeRefresh = "refresh"
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+var (
+	errRefreshTokenInvalid = errors.New("invalid refresh token")
+	errRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+func (a *AuthService) refreshTokenTTL() time.Duration {
+	return time.Duration(a.cfg.JWT.RefreshExpiryDays) * 24 * time.Hour
+}
+
+// newRefreshToken builds the record for a new token in family that expires at expiresAt
+func (a *AuthService) newRefreshToken(username, family string, expiresAt time.Time) session.RefreshToken {
+	now := time.Now()
+	id := fmt.Sprintf("rt_%d", now.UnixNano())
+	if family == "" {
+		family = id
+	}
+	return session.RefreshToken{
+		ID:        id,
+		Family:    family,
+		Username:  username,
+		IssuedAt:  now,
+		ExpiresAt: expiresAt,
+	}
+}
+
+// signRefreshToken returns the JWT handed to the client for record
+func (a *AuthService) signRefreshToken(user *User, record session.RefreshToken) (string, error) {
+	claims := &Claims{
+		Username:  user.Username,
+		Scope:     tokenScopeRefresh,
+		SessionID: record.Family,
+		RegisteredClaims: a.issuerClaims(jwt.RegisteredClaims{
+			ID:        record.ID,
+			IssuedAt:  jwt.NewNumericDate(record.IssuedAt),
+			ExpiresAt: jwt.NewNumericDate(record.ExpiresAt),
+		}),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.jwtSecret)
+}
+
+// issueSession starts a new session for user, returning an access token and
+// the refresh token that can renew it
+func (a *AuthService) issueSession(user *User) (string, string, error) {
+	record := a.newRefreshToken(user.Username, "", time.Now().Add(a.refreshTokenTTL()))
+	if err := a.sessions.SaveRefreshToken(record); err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := a.generateToken(user, record.Family)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := a.signRefreshToken(user, record)
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
+
+// rotateRefreshToken revokes the presented refresh token and issues its
+// replacement in the same session. Presenting an already revoked token means
+// it was stolen or replayed, so the whole session is revoked.
+func (a *AuthService) rotateRefreshToken(claims *Claims) (session.RefreshToken, error) {
+	if a.isSessionRevoked(claims.SessionID) {
+		return session.RefreshToken{}, errRefreshTokenInvalid
+	}
+
+	var next session.RefreshToken
+	reused := false
+	err := a.sessions.UpdateRefreshToken(claims.ID, func(current session.RefreshToken) ([]session.RefreshToken, error) {
+		reused = false
+		if current.Username != claims.Username || current.Family != claims.SessionID {
+			return nil, errRefreshTokenInvalid
+		}
+		if current.Revoked {
+			reused = true
+			return nil, nil
+		}
+
+		// Rotation does not extend the session past the expiry of its first token
+		next = a.newRefreshToken(current.Username, current.Family, current.ExpiresAt)
+		current.Revoked = true
+		current.ReplacedBy = next.ID
+		return []session.RefreshToken{current, next}, nil
+	})
+	if err == session.ErrNotFound {
+		return session.RefreshToken{}, errRefreshTokenInvalid
+	}
+	if err != nil {
+		return session.RefreshToken{}, err
+	}
+	if reused {
+		if err := a.revokeSession(claims.SessionID); err != nil {
+			return session.RefreshToken{}, err
+		}
+		return session.RefreshToken{}, errRefreshTokenReused
+	}
+	return next, nil
+}
+
+// revokeSession ends a login session: its refresh tokens can no longer be
+// exchanged and its access tokens are rejected by AuthMiddleware
+func (a *AuthService) revokeSession(family string) error {
+	if family == "" {
+		return nil
+	}
+	// Outlive every token of the session; access tokens are never longer-lived than refresh tokens
+	return a.sessions.RevokeSession(family, a.refreshTokenTTL())
+}
+
+// revokeUserSessions ends every login session of username, e.g. after an
+// admin resets their password
+func (a *AuthService) revokeUserSessions(username string) error {
+	return a.sessions.RevokeUserSessions(username, a.refreshTokenTTL())
+}
+
+// isSessionRevoked reports whether the session an access token belongs to has
+// been revoked. If the session store cannot be reached the session is treated
+// as active, so an outage does not log every user out.
+func (a *AuthService) isSessionRevoked(family string) bool {
+	if family == "" {
+		return false
+	}
+	revoked, err := a.sessions.IsSessionRevoked(family)
+	if err != nil {
+		logger.Warn("Failed to check session revocation", logrus.Fields{
+			"session_id": family,
+			"error":      err.Error(),
+		})
+	}
+	return revoked
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token. The presented refresh token is invalidated.
+func (a *AuthService) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := a.validateToken(req.RefreshToken)
+	if err != nil || claims.Scope != tokenScopeRefresh || claims.ID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	c.Set("username", claims.Username)
+	c.Set("user_id", claims.Username)
+	c.Set("session_id", claims.SessionID)
+
+	user, err := a.GetUserByUsername(claims.Username)
+	if err != nil || !user.IsActive {
+		a.revokeSession(claims.SessionID)
+		middleware.LogAuthEvent(c, "refresh_token", claims.Username, false, fmt.Errorf("user not found or inactive"))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	// Same password checks as Login, so a refresh cannot outlive an expired password
+	if code, message := a.passwordChallenge(user); code != "" {
+		a.respondPasswordChallenge(c, "refresh_token", user, code, message)
+		return
+	}
+
+	next, err := a.rotateRefreshToken(claims)
+	if err != nil {
+		middleware.LogAuthEvent(c, "refresh_token", claims.Username, false, err)
+		if err == errRefreshTokenInvalid || err == errRefreshTokenReused {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	a.recordLogin(user)
+
+	accessToken, err := a.generateToken(user, next.Family)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	refreshToken, err := a.signRefreshToken(user, next)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	middleware.LogAuthEvent(c, "refresh_token", claims.Username, true, nil)
+	c.JSON(http.StatusOK, gin.H{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"username":      user.Username,
+		"is_admin":      user.IsAdmin,
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"s3mgr/config"
+	"s3mgr/logger"
+	"s3mgr/session"
+)
+
+// newTestAuthService returns an AuthService with a session store in its own in-memory database
+func newTestAuthService(t *testing.T, cfg *config.Config) *AuthService {
+	t.Helper()
+	if err := logger.Initialize(logger.LogConfig{Level: "panic"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg.JWT.Secret = "test-secret"
+	cfg.JWT.ExpiryHours = 1
+	if cfg.JWT.RefreshExpiryDays == 0 {
+		cfg.JWT.RefreshExpiryDays = 7
+	}
+	db := newTestDB(t)
+	return NewAuthService(db, nil, nil, session.NewBadgerStore(db), cfg)
+}
+
+// tokenClaims validates a signed token
+func tokenClaims(t *testing.T, a *AuthService, token string) *Claims {
+	t.Helper()
+	claims, err := a.validateToken(token)
+	if err != nil {
+		t.Fatalf("validate token: %v", err)
+	}
+	return claims
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	a := newTestAuthService(t, &config.Config{})
+	user := &User{ID: "u1", Username: "alice", IsActive: true}
+	putTestUser(t, a, *user)
+
+	// A session an hour from its end, so a rotation that restarts the TTL shows
+	record := a.newRefreshToken(user.Username, "", time.Now().Add(time.Hour))
+	if err := a.sessions.SaveRefreshToken(record); err != nil {
+		t.Fatal(err)
+	}
+	token, err := a.signRefreshToken(user, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := tokenClaims(t, a, token)
+
+	// Each rotation stays in the session and keeps its expiry
+	second, err := a.rotateRefreshToken(first)
+	if err != nil {
+		t.Fatalf("first rotation: %v", err)
+	}
+	if second.Family != first.SessionID {
+		t.Errorf("rotated token family = %q, want %q", second.Family, first.SessionID)
+	}
+	if second.ExpiresAt.Unix() != first.ExpiresAt.Unix() {
+		t.Errorf("rotation moved the expiry from %v to %v", first.ExpiresAt.Time, second.ExpiresAt)
+	}
+	token, err = a.signRefreshToken(user, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := a.rotateRefreshToken(tokenClaims(t, a, token))
+	if err != nil {
+		t.Fatalf("second rotation: %v", err)
+	}
+	if third.ExpiresAt.Unix() != first.ExpiresAt.Unix() {
+		t.Errorf("rotation moved the expiry from %v to %v", first.ExpiresAt.Time, third.ExpiresAt)
+	}
+
+	// Replaying a rotated token revokes the whole session, including the latest token
+	if _, err := a.rotateRefreshToken(first); err != errRefreshTokenReused {
+		t.Fatalf("replayed token: err = %v, want %v", err, errRefreshTokenReused)
+	}
+	if !a.isSessionRevoked(first.SessionID) {
+		t.Error("session not revoked after reuse")
+	}
+	token, err = a.signRefreshToken(user, third)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.rotateRefreshToken(tokenClaims(t, a, token)); err != errRefreshTokenInvalid {
+		t.Errorf("latest token after reuse: err = %v, want %v", err, errRefreshTokenInvalid)
+	}
+}
+
+func TestRefreshPasswordExpired(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Password.MaxAgeDays = 30
+	a := newTestAuthService(t, cfg)
+	user := &User{ID: "u1", Username: "alice", IsActive: true, PasswordChangedAt: time.Now().Add(-60 * 24 * time.Hour)}
+	putTestUser(t, a, *user)
+	_, token, err := a.issueSession(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/auth/refresh", a.Refresh)
+	body, _ := json.Marshal(RefreshRequest{RefreshToken: token})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/refresh", bytes.NewReader(body)))
+
+	var resp struct {
+		Code           string `json:"code"`
+		ChallengeToken string `json:"challenge_token"`
+		Token          string `json:"token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusForbidden || resp.Code != "password_expired" || resp.ChallengeToken == "" || resp.Token != "" {
+		t.Errorf("refresh with an expired password: status %d, body %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRefreshRecordsLogin(t *testing.T) {
+	a := newTestAuthService(t, &config.Config{})
+	user := &User{ID: "u1", Username: "alice", IsActive: true}
+	putTestUser(t, a, *user)
+	_, token, err := a.issueSession(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/auth/refresh", a.Refresh)
+	body, _ := json.Marshal(RefreshRequest{RefreshToken: token})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/refresh", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh: status %d, body %s", w.Code, w.Body.String())
+	}
+
+	// Otherwise the inactivity job disables users who only ever refresh
+	if stored, _ := a.GetUserByUsername("alice"); time.Since(stored.LastLogin) > time.Minute {
+		t.Errorf("last login = %v, want it set by the refresh", stored.LastLogin)
+	}
+}
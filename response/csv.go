@@ -0,0 +1,57 @@
+package response
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// csvEscapePrefixes are the leading characters that make spreadsheet
+// applications evaluate a cell as a formula, plus the escape quote itself so
+// escaping can be reversed on import
+const csvEscapePrefixes = "=+-@\t\r'"
+
+// CSVSafe prefixes value with a single quote when a spreadsheet would
+// otherwise treat it as a formula (CSV injection)
+func CSVSafe(value string) string {
+	if value != "" && strings.ContainsRune(csvEscapePrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// CSVUnescape reverses CSVSafe for a value read back from an exported CSV
+func CSVUnescape(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(csvEscapePrefixes, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+// CSVUnescapeAll applies CSVUnescape to every field of records in place
+func CSVUnescapeAll(records [][]string) {
+	for _, record := range records {
+		for i, field := range record {
+			record[i] = CSVUnescape(field)
+		}
+	}
+}
+
+// CSVWriter is a csv.Writer that passes every field through CSVSafe, for
+// exports that may be opened in a spreadsheet
+type CSVWriter struct {
+	*csv.Writer
+}
+
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{Writer: csv.NewWriter(w)}
+}
+
+// Write writes one record with every field escaped
+func (w *CSVWriter) Write(record []string) error {
+	safe := make([]string, len(record))
+	for i, field := range record {
+		safe[i] = CSVSafe(field)
+	}
+	return w.Writer.Write(safe)
+}
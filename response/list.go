@@ -0,0 +1,75 @@
+package response
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pagination describes which slice of a collection a list response holds
+type Pagination struct {
+	Page     int `json:"page"`
+	PageSize int `json:"page_size"`
+	Total    int `json:"total"`
+}
+
+// Cursor describes a page of a collection paginated by opaque continuation
+// tokens, such as an object listing, whose total size is not known up front
+type Cursor struct {
+	PageSize              int    `json:"page_size"`
+	ContinuationToken     string `json:"continuation_token,omitempty"`
+	NextContinuationToken string `json:"next_continuation_token,omitempty"` // Empty on the last page
+	HasMore               bool   `json:"has_more"`
+	Total                 *int   `json:"total,omitempty"` // Only when the client asked for a count
+}
+
+// All describes an unpaginated collection of total items returned in one page
+func All(total int) Pagination {
+	return Pagination{Page: 1, PageSize: total, Total: total}
+}
+
+// Bounds returns the [start, end) indexes of the page within a collection of
+// total items, clamped to the collection
+func Bounds(total, page, pageSize int) (int, int) {
+	start := (page - 1) * pageSize
+	if start > total {
+		start = total
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// List writes the envelope shared by collection endpoints:
+//
+//	{"kind": "files", "items": [...], "pagination": {"page", "page_size", "total"}}
+//
+// kind names what items holds. extra adds endpoint-specific top-level fields
+// such as the applied filters.
+func List(c *gin.Context, kind string, items interface{}, pagination Pagination, extra gin.H) {
+	write(c, kind, items, pagination, extra)
+}
+
+// CursorList writes the same envelope as List for a token-paginated collection
+func CursorList(c *gin.Context, kind string, items interface{}, cursor Cursor, extra gin.H) {
+	write(c, kind, items, cursor, extra)
+}
+
+func write(c *gin.Context, kind string, items interface{}, pagination interface{}, extra gin.H) {
+	// Always send an array, never null, for an empty collection
+	if v := reflect.ValueOf(items); !v.IsValid() || (v.Kind() == reflect.Slice && v.IsNil()) {
+		items = []interface{}{}
+	}
+
+	body := gin.H{}
+	for k, v := range extra {
+		body[k] = v
+	}
+	body["kind"] = kind
+	body["items"] = items
+	body["pagination"] = pagination
+	c.JSON(http.StatusOK, body)
+}
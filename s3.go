@@ -1,22 +1,41 @@
 package main
 
 import (
+	"bytes"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/dgraph-io/badger/v4"
 	"github.com/gin-gonic/gin"
 
 	"s3mgr/audit"
+	"s3mgr/config"
+	"s3mgr/logger"
+	"s3mgr/response"
+	"s3mgr/users"
 )
 
 type S3Config struct {
@@ -33,15 +52,128 @@ type S3Config struct {
 	IsDefault   bool   `json:"is_default"`
 	CreatedAt   string `json:"created_at"`
 	UpdatedAt   string `json:"updated_at"`
+	OrgID       string `json:"org_id,omitempty"`
+	// Disabled configs are kept but skipped for default selection and file operations
+	Disabled bool `json:"disabled"`
+	// Version is incremented on every save and used for optimistic concurrency
+	Version int64 `json:"version"`
+	// ExtraHeaders are static headers sent with every storage request (e.g. gateway routing)
+	ExtraHeaders map[string]string `json:"extra_headers,omitempty"`
+	// DefaultSSE is the server-side encryption applied to uploads that don't request one
+	DefaultSSE         string `json:"default_sse,omitempty"`
+	DefaultSSEKMSKeyID string `json:"default_sse_kms_key_id,omitempty"`
+	// TimeoutSeconds overrides storage.request_timeout_seconds for this backend (0 uses the global default)
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+	// Provider picks endpoint and region defaults for s3compatible configs (wasabi, backblaze, digitalocean)
+	Provider string `json:"provider,omitempty"`
+	// PathStyle puts the bucket in the URL path instead of the host name (s3compatible only)
+	PathStyle bool `json:"path_style"`
+}
+
+// allowedSSE lists the server-side encryption modes accepted for uploads
+var allowedSSE = map[string]bool{
+	s3.ServerSideEncryptionAes256: true,
+	s3.ServerSideEncryptionAwsKms: true,
+}
+
+// validateSSE checks an encryption mode and KMS key pair. A KMS key is only
+// meaningful with aws:kms; without one the bucket's default KMS key is used.
+func validateSSE(sse, kmsKeyID string) error {
+	if sse != "" && !allowedSSE[sse] {
+		return fmt.Errorf("sse must be %s or %s", s3.ServerSideEncryptionAes256, s3.ServerSideEncryptionAwsKms)
+	}
+	if kmsKeyID != "" && sse != s3.ServerSideEncryptionAwsKms {
+		return fmt.Errorf("kms_key_id requires sse=%s", s3.ServerSideEncryptionAwsKms)
+	}
+	return nil
+}
+
+// uploadSSE returns the encryption for an upload: the requested mode, or the
+// config's default when none is requested
+func uploadSSE(config *S3Config, sse, kmsKeyID string) (string, string, error) {
+	if sse == "" && kmsKeyID == "" {
+		return config.DefaultSSE, config.DefaultSSEKMSKeyID, nil
+	}
+	if err := validateSSE(sse, kmsKeyID); err != nil {
+		return "", "", err
+	}
+	return sse, kmsKeyID, nil
+}
+
+// reservedHeaders are managed by the SDK and cannot be overridden per config
+var reservedHeaders = map[string]bool{
+	"Authorization":  true,
+	"Host":           true,
+	"Content-Length": true,
+	"Content-Md5":    true,
+	"Content-Type":   true,
+	"Expect":         true,
+}
+
+// validateExtraHeaders checks that header names are valid HTTP tokens, are not
+// reserved or x-amz-* headers, and that values contain no line breaks
+func validateExtraHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if name == "" {
+			return fmt.Errorf("header name must not be empty")
+		}
+		for _, r := range name {
+			if r > 127 || !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+				return fmt.Errorf("invalid header name %q", name)
+			}
+		}
+		canonical := http.CanonicalHeaderKey(name)
+		if reservedHeaders[canonical] || strings.HasPrefix(canonical, "X-Amz-") {
+			return fmt.Errorf("header %q cannot be overridden", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid value for header %q", name)
+		}
+	}
+	return nil
+}
+
+var (
+	// errConfigDisabled is returned when a disabled config is used for a file operation
+	errConfigDisabled = errors.New("configuration is disabled")
+	// errConfigVersionConflict is returned when a config changed since the client read it
+	errConfigVersionConflict = errors.New("configuration was modified by another request")
+	// errConfigUnavailable is returned when a config's backend recently failed to respond
+	errConfigUnavailable = errors.New("storage backend is unavailable")
+	// errNoConfigurations is returned when the user has not created any config yet
+	errNoConfigurations = errors.New("no configurations found")
+)
+
+// noConfigurationsResponse lets clients tell "create a config first" apart
+// from a specific config_id that does not exist
+var noConfigurationsResponse = gin.H{
+	"error": "You have no S3 configurations; create one first",
+	"code":  "no_configurations",
 }
 
 type S3Service struct {
 	db           *badger.DB
 	auditService *audit.AuditService
+	cfg          *config.Config
+	health       *configHealthCache
+	httpClients  sync.Map // Request timeout -> *http.Client, shared so connections are pooled
+	uploads      *uploadLocks
+	transfers    *transferSlots
+	stats        *statsCache
+	versioning   *versioningCache
 }
 
-func NewS3Service(db *badger.DB, auditService *audit.AuditService) *S3Service {
-	return &S3Service{db: db, auditService: auditService}
+func NewS3Service(db *badger.DB, auditService *audit.AuditService, cfg *config.Config) *S3Service {
+	return &S3Service{
+		db:           db,
+		auditService: auditService,
+		cfg:          cfg,
+		health:       newConfigHealthCache(),
+		uploads:      newUploadLocks(),
+		transfers:    newTransferSlots(cfg.Storage.MaxConcurrentPerUser),
+		stats:        newStatsCache(),
+		versioning:   newVersioningCache(),
+	}
 }
 
 func (s *S3Service) generateConfigID() string {
@@ -49,18 +181,20 @@ func (s *S3Service) generateConfigID() string {
 }
 
 func (s *S3Service) createS3Client(config S3Config) *s3.S3 {
-	if config.StorageType == "minio" {
+	if endpointStorageTypes[config.StorageType] {
 		sess, err := session.NewSession(&aws.Config{
 			Region:           aws.String(config.Region),
 			Endpoint:         aws.String(config.EndpointURL),
-			S3ForcePathStyle: aws.Bool(true),
+			S3ForcePathStyle: aws.Bool(config.forcePathStyle()),
 			Credentials:      credentials.NewStaticCredentials(config.AccessKey, config.SecretKey, ""),
 			DisableSSL:       aws.Bool(!config.UseSSL),
+			HTTPClient:       s.storageHTTPClient(config),
 		})
 		if err != nil {
 			return nil
 		}
-		return s3.New(sess)
+		addExtraHeaders(sess, config.ExtraHeaders)
+		return s.trackHealth(s3.New(sess), config.ID)
 	} else {
 		sess := session.Must(session.NewSession(&aws.Config{
 			Region: aws.String(config.Region),
@@ -69,9 +203,152 @@ func (s *S3Service) createS3Client(config S3Config) *s3.S3 {
 				config.SecretKey,
 				"",
 			),
+			HTTPClient: s.storageHTTPClient(config),
 		}))
-		return s3.New(sess)
+		addExtraHeaders(sess, config.ExtraHeaders)
+		return s.trackHealth(s3.New(sess), config.ID)
+	}
+}
+
+// requestTimeout is how long a request to config's backend may wait for a
+// response: the config's own timeout, or the global default
+func (s *S3Service) requestTimeout(config S3Config) time.Duration {
+	if config.TimeoutSeconds > 0 {
+		return time.Duration(config.TimeoutSeconds) * time.Second
+	}
+	if s.cfg == nil {
+		return 0
+	}
+	return time.Duration(s.cfg.Storage.RequestTimeoutSeconds) * time.Second
+}
+
+// storageHTTPClient returns the HTTP client for config's backend. The timeout
+// bounds connecting and waiting for response headers, not streaming a body,
+// so large uploads and downloads are not cut off. nil means the SDK default.
+func (s *S3Service) storageHTTPClient(config S3Config) *http.Client {
+	timeout := s.requestTimeout(config)
+	if timeout <= 0 {
+		return nil
+	}
+	if client, ok := s.httpClients.Load(timeout); ok {
+		return client.(*http.Client)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = timeout
+	transport.ResponseHeaderTimeout = timeout
+	client, _ := s.httpClients.LoadOrStore(timeout, &http.Client{Transport: transport})
+	return client.(*http.Client)
+}
+
+// gcsEndpoint is Google Cloud Storage's S3-compatible XML API
+const gcsEndpoint = "https://storage.googleapis.com"
+
+// gcsRegion is the signing region GCS expects when a config doesn't name one
+const gcsRegion = "auto"
+
+// normalizeConfigEndpoint validates the endpoint URL of a config reached
+// through its own endpoint (MinIO, GCS, s3compatible) and stores it as
+// scheme://host[:port][/path]. An endpoint without a scheme gets one from
+// useSSL; otherwise useSSL, when set, must agree with the scheme and, when
+// omitted, is derived from it. GCS configs default to the public XML API
+// endpoint and the "auto" region, and must carry HMAC keys; s3compatible
+// configs take their defaults from the provider preset. AWS configs don't use
+// the endpoint.
+func normalizeConfigEndpoint(config *S3Config, useSSL *bool) error {
+	if useSSL != nil {
+		config.UseSSL = *useSSL
+	}
+	if config.StorageType == "gcs" {
+		// GCS only accepts HMAC keys over the XML API; service account JSON keys don't work here
+		if config.AccessKey == "" || config.SecretKey == "" {
+			return fmt.Errorf("gcs storage requires an HMAC access_key and secret_key")
+		}
+		if !strings.HasPrefix(config.AccessKey, "GOOG") {
+			return fmt.Errorf("access_key is not a GCS HMAC access ID (they start with GOOG)")
+		}
+		if strings.TrimSpace(config.Region) == "" {
+			config.Region = gcsRegion
+		}
+		if strings.TrimSpace(config.EndpointURL) == "" {
+			// The public endpoint is HTTPS only, whatever use_ssl says
+			config.EndpointURL = gcsEndpoint
+			useSSL = nil
+		}
+	} else if config.StorageType == "s3compatible" {
+		presetEndpoint := strings.TrimSpace(config.EndpointURL) == ""
+		if err := applyProviderPreset(config); err != nil {
+			return err
+		}
+		if presetEndpoint && config.EndpointURL != "" {
+			// Preset endpoints are HTTPS only, whatever use_ssl says
+			useSSL = nil
+		}
+	} else if !endpointStorageTypes[config.StorageType] {
+		return nil
+	}
+
+	raw := strings.TrimSpace(config.EndpointURL)
+	if raw == "" {
+		return fmt.Errorf("endpoint_url is required for %s storage", config.StorageType)
+	}
+	if !strings.Contains(raw, "://") {
+		scheme := "http"
+		if config.UseSSL {
+			scheme = "https"
+		}
+		raw = scheme + "://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("endpoint_url is not a valid URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("endpoint_url must use http or https, not %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("endpoint_url has no host")
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("endpoint_url has an invalid port %q", port)
+		}
+	}
+	if u.User != nil {
+		return fmt.Errorf("endpoint_url must not contain credentials; use access_key and secret_key")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("endpoint_url must not contain a query string or fragment")
+	}
+
+	ssl := u.Scheme == "https"
+	if useSSL != nil && *useSSL != ssl {
+		return fmt.Errorf("use_ssl is %v but endpoint_url uses %s", *useSSL, u.Scheme)
+	}
+	config.UseSSL = ssl
+	config.EndpointURL = u.Scheme + "://" + u.Host + strings.TrimRight(u.EscapedPath(), "/")
+	return nil
+}
+
+// validateTimeout checks a config's request timeout override
+func validateTimeout(seconds int) error {
+	if seconds < 0 || seconds > config.MaxRequestTimeoutSeconds {
+		return fmt.Errorf("timeout_seconds must be between 0 and %d", config.MaxRequestTimeoutSeconds)
+	}
+	return nil
+}
+
+// addExtraHeaders injects the config's static headers into every request
+// before it is signed
+func addExtraHeaders(sess *session.Session, headers map[string]string) {
+	if len(headers) == 0 {
+		return
 	}
+	sess.Handlers.Build.PushBack(func(r *request.Request) {
+		for name, value := range headers {
+			r.HTTPRequest.Header.Set(name, value)
+		}
+	})
 }
 
 func (s *S3Service) getUserConfigs(userID string) ([]S3Config, error) {
@@ -100,6 +377,19 @@ func (s *S3Service) getUserConfigs(userID string) ([]S3Config, error) {
 		return nil
 	})
 
+	// Sort by creation time, then ID, so listings and default fallback are stable
+	sort.SliceStable(configs, func(i, j int) bool {
+		ti, errI := time.Parse(time.RFC3339, configs[i].CreatedAt)
+		tj, errJ := time.Parse(time.RFC3339, configs[j].CreatedAt)
+		if errI == nil && errJ == nil && !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		if (errI != nil || errJ != nil) && configs[i].CreatedAt != configs[j].CreatedAt {
+			return configs[i].CreatedAt < configs[j].CreatedAt
+		}
+		return configs[i].ID < configs[j].ID
+	})
+
 	return configs, err
 }
 
@@ -125,21 +415,98 @@ func (s *S3Service) getConfigByID(userID, configID string) (*S3Config, error) {
 	return &config, nil
 }
 
+// findConfigByID looks up a config by ID across all users
+func (s *S3Service) findConfigByID(configID string) (*S3Config, error) {
+	var found *S3Config
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte("user_config_")
+		suffix := []byte("_" + configID)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			if !bytes.HasSuffix(item.Key(), suffix) {
+				continue
+			}
+			err := item.Value(func(val []byte) error {
+				var config S3Config
+				if err := json.Unmarshal(val, &config); err != nil {
+					return err
+				}
+				if config.ID == configID {
+					found = &config
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if found != nil {
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, badger.ErrKeyNotFound
+	}
+
+	return found, nil
+}
+
 func (s *S3Service) saveConfig(config S3Config) error {
+	_, err := s.saveConfigIfVersion(config, -1)
+	return err
+}
+
+// saveConfigIfVersion stores a config and bumps its version. When expectedVersion
+// is non-negative the write only happens if the stored version still matches,
+// otherwise errConfigVersionConflict is returned. It returns the new version.
+func (s *S3Service) saveConfigIfVersion(config S3Config, expectedVersion int64) (int64, error) {
 	config.UpdatedAt = time.Now().Format(time.RFC3339)
 	if config.CreatedAt == "" {
 		config.CreatedAt = config.UpdatedAt
 	}
 
-	data, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-
-	return s.db.Update(func(txn *badger.Txn) error {
+	err := s.db.Update(func(txn *badger.Txn) error {
 		key := fmt.Sprintf("user_config_%s_%s", config.UserID, config.ID)
+
+		var storedVersion int64
+		item, err := txn.Get([]byte(key))
+		if err == nil {
+			err = item.Value(func(val []byte) error {
+				var stored S3Config
+				if err := json.Unmarshal(val, &stored); err != nil {
+					return err
+				}
+				storedVersion = stored.Version
+				return nil
+			})
+		}
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		if expectedVersion >= 0 && storedVersion != expectedVersion {
+			return errConfigVersionConflict
+		}
+
+		config.Version = storedVersion + 1
+		data, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
 		return txn.Set([]byte(key), data)
 	})
+	if err == badger.ErrConflict {
+		err = errConfigVersionConflict
+	}
+
+	return config.Version, err
 }
 
 // DeleteConfig is a Gin handler for deleting a user config
@@ -173,7 +540,7 @@ func (s *S3Service) DeleteConfig(c *gin.Context) {
 	}
 	if deletedWasDefault && len(configs) > 1 {
 		for _, cfg := range configs {
-			if cfg.ID != configID {
+			if cfg.ID != configID && !cfg.Disabled {
 				s.setDefaultConfig(userID, cfg.ID)
 				break
 			}
@@ -185,16 +552,91 @@ func (s *S3Service) DeleteConfig(c *gin.Context) {
 
 // SetDefaultConfig is a Gin handler for setting a config as default
 func (s *S3Service) SetDefaultConfig(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(configID string, success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "set_default", "config", configID, success, err, details)
+		}
+	}
+
 	userID := c.GetString("user_id")
 	configID := c.Param("id")
 
+	config, err := s.getConfigByID(userID, configID)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "Configuration not found"})
+		return
+	}
+	if config.Disabled {
+		c.JSON(409, gin.H{"error": "Cannot set a disabled configuration as default"})
+		return
+	}
+
+	// Record the config operations were actually using, including the
+	// first-enabled fallback when no default was set
+	oldDefaultID := ""
+	if oldDefault, err := s.getDefaultConfig(userID); err == nil {
+		oldDefaultID = oldDefault.ID
+	}
+	details := map[string]interface{}{
+		"old_default_config_id": oldDefaultID,
+		"new_default_config_id": configID,
+		"bucket_name":           config.BucketName,
+	}
+
 	if err := s.setDefaultConfig(userID, configID); err != nil {
-		c.JSON(500, gin.H{"error": "Failed to set default configuration"})
+		logAudit(configID, false, err, details)
+		switch err {
+		case badger.ErrKeyNotFound:
+			c.JSON(404, gin.H{"error": "Configuration not found"})
+		case errConfigDisabled:
+			c.JSON(409, gin.H{"error": "Cannot set a disabled configuration as default"})
+		default:
+			c.JSON(500, gin.H{"error": "Failed to set default configuration"})
+		}
 		return
 	}
+	logAudit(configID, true, nil, details)
 	c.JSON(200, gin.H{"message": "Default configuration set"})
 }
 
+// SetConfigEnabled is a Gin handler for enabling or disabling a config without deleting it
+func (s *S3Service) SetConfigEnabled(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(configID string, success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "set_config_enabled", "config", configID, success, err, details)
+		}
+	}
+
+	userID := c.GetString("user_id")
+	configID := c.Param("id")
+
+	var req struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "enabled is required"})
+		return
+	}
+
+	config, err := s.getConfigByID(userID, configID)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "Configuration not found"})
+		return
+	}
+
+	config.Disabled = !*req.Enabled
+	if err := s.saveConfig(*config); err != nil {
+		logAudit(configID, false, err, map[string]interface{}{"enabled": *req.Enabled})
+		c.JSON(500, gin.H{"error": "Failed to update configuration"})
+		return
+	}
+
+	logAudit(configID, true, nil, map[string]interface{}{"enabled": *req.Enabled})
+	c.JSON(200, gin.H{"message": "Configuration updated", "enabled": *req.Enabled})
+}
+
 // Internal utility for deleting a config
 func (s *S3Service) deleteConfig(userID, configID string) error {
 	return s.db.Update(func(txn *badger.Txn) error {
@@ -203,28 +645,73 @@ func (s *S3Service) deleteConfig(userID, configID string) error {
 	})
 }
 
-// Internal utility for setting a config as default
+// setDefaultConfigAttempts bounds retries when a concurrent write conflicts with a default change
+const setDefaultConfigAttempts = 5
+
+// Internal utility for setting a config as default. The old default is cleared
+// and the new one set in a single transaction, so concurrent calls can never
+// leave a user with two defaults or none; conflicting transactions are retried.
 func (s *S3Service) setDefaultConfig(userID, configID string) error {
-	configs, err := s.getUserConfigs(userID)
-	if err != nil {
-		return err
+	var err error
+	for attempt := 0; attempt < setDefaultConfigAttempts; attempt++ {
+		err = s.db.Update(func(txn *badger.Txn) error {
+			return setDefaultConfigTxn(txn, userID, configID)
+		})
+		if err != badger.ErrConflict {
+			return err
+		}
 	}
+	return err
+}
 
-	for _, config := range configs {
-		if config.IsDefault {
-			config.IsDefault = false
-			if err := s.saveConfig(config); err != nil {
+func setDefaultConfigTxn(txn *badger.Txn, userID, configID string) error {
+	var configs []S3Config
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	prefix := []byte(fmt.Sprintf("user_config_%s_", userID))
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		err := it.Item().Value(func(val []byte) error {
+			var config S3Config
+			if err := json.Unmarshal(val, &config); err != nil {
 				return err
 			}
+			configs = append(configs, config)
+			return nil
+		})
+		if err != nil {
+			it.Close()
+			return err
 		}
 	}
+	it.Close()
+
+	var target *S3Config
+	for i := range configs {
+		if configs[i].ID == configID {
+			target = &configs[i]
+		}
+	}
+	if target == nil {
+		return badger.ErrKeyNotFound
+	}
+	if target.Disabled {
+		return errConfigDisabled
+	}
+
+	now := time.Now().Format(time.RFC3339)
 	for _, config := range configs {
-		if config.ID == configID {
-			config.IsDefault = true
-			if err := s.saveConfig(config); err != nil {
-				return err
-			}
-			break
+		isDefault := config.ID == configID
+		if config.IsDefault == isDefault {
+			continue
+		}
+		config.IsDefault = isDefault
+		config.Version++
+		config.UpdatedAt = now
+		data, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+		if err := txn.Set([]byte(fmt.Sprintf("user_config_%s_%s", userID, config.ID)), data); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -237,17 +724,66 @@ func (s *S3Service) getDefaultConfig(userID string) (*S3Config, error) {
 	}
 
 	for _, config := range configs {
-		if config.IsDefault {
+		if config.IsDefault && !config.Disabled {
+			return &config, nil
+		}
+	}
+
+	// If no enabled default, return the first enabled config
+	for _, config := range configs {
+		if !config.Disabled {
 			return &config, nil
 		}
 	}
 
-	// If no default, return the first config
 	if len(configs) > 0 {
-		return &configs[0], nil
+		return nil, errConfigDisabled
 	}
 
-	return nil, fmt.Errorf("no configurations found")
+	return nil, errNoConfigurations
+}
+
+// resolveConfig returns the config a file operation should use: the requested
+// config if configID is set, otherwise the user's default. Disabled configs
+// are rejected, and so are configs whose backend is known to be down.
+func (s *S3Service) resolveConfig(userID, configID string) (*S3Config, error) {
+	var config *S3Config
+	var err error
+	if configID == "" {
+		config, err = s.getDefaultConfig(userID)
+	} else {
+		config, err = s.getConfigByID(userID, configID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if config.Disabled {
+		return nil, errConfigDisabled
+	}
+	// Fail fast while the backend is known to be down
+	downTTL := time.Duration(s.cfg.HealthCheck.DownTTLSeconds) * time.Second
+	if s.health.isDown(config.ID, downTTL, s.cfg.HealthCheck.FailureThreshold) {
+		return nil, errConfigUnavailable
+	}
+	return config, nil
+}
+
+// respondConfigError writes the response for an error from resolveConfig
+// and reports whether there was one
+func respondConfigError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case err == errConfigDisabled:
+		c.JSON(http.StatusConflict, gin.H{"error": "Configuration is disabled"})
+	case err == errConfigUnavailable:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Storage backend is temporarily unavailable"})
+	case err == errNoConfigurations:
+		c.JSON(http.StatusNotFound, noConfigurationsResponse)
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Configuration not found"})
+	}
+	return true
 }
 
 // API Handlers
@@ -264,15 +800,8 @@ func (s *S3Service) UploadFile(c *gin.Context) {
 	userID := c.GetString("user_id")
 	configID := c.Query("config_id")
 
-	var config *S3Config
-	var err error
-	if configID != "" {
-		config, err = s.getConfigByID(userID, configID)
-	} else {
-		config, err = s.getDefaultConfig(userID)
-	}
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Configuration not found"})
+	config, err := s.resolveConfig(userID, configID)
+	if respondConfigError(c, err) {
 		return
 	}
 	client := s.createS3Client(*config)
@@ -286,131 +815,501 @@ func (s *S3Service) UploadFile(c *gin.Context) {
 		return
 	}
 	defer file.Close()
-	userPrefix := fmt.Sprintf("users/%s/", userID)
+	if err := s.validateFilename(header.Filename); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_filename"})
+		return
+	}
+	userPrefix := s.userPrefix(userID)
 	key := userPrefix + header.Filename
 
-	// Detect file size
-	fileSize := header.Size
-	const multipartThreshold = 5 * 1024 * 1024 // 5MB
+	release, ok := s.lockUpload(c, userID, config.ID, header.Filename)
+	if !ok {
+		return
+	}
+	defer release()
 
-	if fileSize > multipartThreshold {
-		// --- Multipart upload for large files ---
-		createResp, err := client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
-			Bucket: aws.String(config.BucketName),
-			Key:    aws.String(key),
+	// Optional canned ACL, limited to the configured allow list
+	acl := c.PostForm("acl")
+	if acl != "" && !s.isAllowedACL(acl) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":        "ACL not allowed: " + acl,
+			"allowed_acls": s.cfg.Upload.AllowedACLs,
 		})
+		return
+	}
+
+	// Optional server-side encryption, defaulting to the config's
+	sse, kmsKeyID, err := uploadSSE(config, c.Query("sse"), c.Query("kms_key_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Optional TTL after which the object is deleted by the expiry job
+	var expiresAt time.Time
+	if expiresIn := c.PostForm("expires_in"); expiresIn != "" {
+		ttl, err := parseObjectTTL(expiresIn)
 		if err != nil {
-			logAudit(false, err, map[string]interface{}{
-				"stage": "initiate_multipart",
-				"filename": header.Filename,
-				"size": fileSize,
-			})
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate multipart upload: " + err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		expiresAt = time.Now().Add(ttl)
+	}
 
-		var completedParts []*s3.CompletedPart
-		const partSize = 5 * 1024 * 1024 // 5MB
-		buffer := make([]byte, partSize)
-		partNumber := int64(1)
-		for {
-			n, readErr := file.Read(buffer)
-			if n == 0 && readErr == io.EOF {
-				break
-			}
-			if n == 0 && readErr != nil {
-				logAudit(false, readErr, map[string]interface{}{
-					"stage": "read_part",
-					"filename": header.Filename,
-					"size": fileSize,
-					"part_number": partNumber,
-				})
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file part: " + readErr.Error()})
-				return
-			}
-			partInput := &s3.UploadPartInput{
-				Bucket:     aws.String(config.BucketName),
-				Key:        aws.String(key),
-				PartNumber: aws.Int64(partNumber),
-				UploadId:   createResp.UploadId,
-				Body:       strings.NewReader(string(buffer[:n])),
-			}
-			partResp, uploadErr := client.UploadPart(partInput)
-			if uploadErr != nil {
-				client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
-					Bucket:   aws.String(config.BucketName),
-					Key:      aws.String(key),
-					UploadId: createResp.UploadId,
-				})
-				logAudit(false, uploadErr, map[string]interface{}{
-					"stage": "upload_part",
-					"filename": header.Filename,
-					"size": fileSize,
-					"part_number": partNumber,
+	// Detect file size
+	fileSize := header.Size
+	if maxSize := s.maxUploadSize(); maxSize > 0 && fileSize > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":           "File exceeds the maximum upload size",
+			"max_upload_size": maxSize,
+		})
+		return
+	}
+	contentType := effectiveContentType(header.Header.Get("Content-Type"), header.Filename)
+	if !s.isAllowedContentType(contentType) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":                 "Content type not allowed: " + contentType,
+			"allowed_content_types": s.cfg.Upload.AllowedContentTypes,
+		})
+		return
+	}
+	// Checked against the declared size before any part is sent
+	if !s.checkQuota(c, userID, fileSize) {
+		return
+	}
+	const spoolThreshold = 5 * 1024 * 1024 // 5MB
+
+	// Files larger than one part go through a resumable multipart upload; smaller
+	// ones are sent by the managed uploader with a single PutObject
+	var body io.Reader = file
+	var source io.ReaderAt = file
+	spooled := false
+	if fileSize > spoolThreshold && s.cfg.Upload.SpoolToDisk {
+		tmp, err := spoolToTempFile(s.cfg.Upload.TempDir, file)
+		if err != nil {
+			logAudit(false, err, map[string]interface{}{
+				"stage":    "spool_to_disk",
+				"filename": header.Filename,
+				"size":     fileSize,
+			})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to spool upload: " + err.Error()})
+			return
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		body = tmp
+		source = tmp
+		spooled = true
+	}
+
+	partSize := s.uploadPartSize(fileSize)
+	multipart := fileSize > partSize
+	verifiedSize := int64(-1)
+	if multipart {
+		// Replace any interrupted upload of the same key in this config
+		if previous, err := s.getUploadSession(userID, config.ID, header.Filename); err == nil && previous != nil {
+			if err := s.abortUploadSession(userID, previous); err != nil {
+				logger.Warn("Failed to abort replaced upload", map[string]interface{}{
+					"upload_id": previous.ID,
+					"key":       previous.FullKey,
+					"error":     err.Error(),
 				})
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload part: " + uploadErr.Error()})
-				return
 			}
-			completedParts = append(completedParts, &s3.CompletedPart{
-				ETag:       partResp.ETag,
-				PartNumber: aws.Int64(partNumber),
+		}
+
+		session := &UploadSession{
+			UserID:      userID,
+			ConfigID:    config.ID,
+			Key:         header.Filename,
+			FullKey:     key,
+			ContentType: contentType,
+			ACL:         acl,
+			SSE:         sse,
+			SSEKMSKeyID: kmsKeyID,
+			Size:        fileSize,
+			PartSize:    partSize,
+			ExpiresAt:   expiresAt,
+		}
+		if err := s.startMultipartUpload(client, config, session); err != nil {
+			logAudit(false, err, map[string]interface{}{
+				"stage":    "create_multipart_upload",
+				"filename": header.Filename,
+				"size":     fileSize,
+				"spooled":  spooled,
+				"acl":      acl,
 			})
-			partNumber++
-			if readErr == io.EOF {
-				break
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file: " + err.Error()})
+			return
+		}
+		err := s.uploadMissingParts(client, config.BucketName, session, source)
+		if err == nil {
+			err = s.completeMultipartUpload(client, config.BucketName, session)
+		}
+		if err != nil {
+			// Keep the session so POST /files/upload/resume can pick up where this left off
+			logAudit(false, err, map[string]interface{}{
+				"stage":           "multipart_upload",
+				"filename":        header.Filename,
+				"size":            fileSize,
+				"spooled":         spooled,
+				"acl":             acl,
+				"upload_id":       session.ID,
+				"completed_parts": len(session.Parts),
+			})
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":           "Failed to upload file: " + err.Error(),
+				"upload_id":       session.ID,
+				"resumable":       true,
+				"completed_parts": len(session.Parts),
+				"total_parts":     session.partCount(),
+			})
+			return
+		}
+		if s.cfg.Upload.VerifyMultipart {
+			storedSize, err := verifyCompletedUpload(client, config.BucketName, key, fileSize)
+			if err != nil {
+				// The completed upload replaced whatever was stored under the key
+				s.invalidateUsage(userID, config.ID)
+				s.clearObjectChecksum(config.ID, key)
+				s.dropObjectExpiry(config.ID, key)
+				logAudit(false, err, map[string]interface{}{
+					"stage":       "verify",
+					"filename":    header.Filename,
+					"size":        fileSize,
+					"stored_size": storedSize,
+					"upload_id":   session.ID,
+				})
+				c.JSON(http.StatusBadGateway, gin.H{"error": "Upload failed verification: " + err.Error(), "code": "upload_verification_failed"})
+				return
 			}
+			verifiedSize = storedSize
 		}
-		// Complete multipart upload
-		_, err = client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
-			Bucket:   aws.String(config.BucketName),
-			Key:      aws.String(key),
-			UploadId: createResp.UploadId,
-			MultipartUpload: &s3.CompletedMultipartUpload{
-				Parts: completedParts,
-			},
+	} else {
+		uploader := s3manager.NewUploaderWithClient(client, func(u *s3manager.Uploader) {
+			u.Concurrency = s.cfg.Upload.Concurrency
+			u.PartSize = partSize
 		})
-		if err != nil {
+		uploadInput := &s3manager.UploadInput{
+			Bucket:      aws.String(config.BucketName),
+			Key:         aws.String(key),
+			Body:        body,
+			ContentType: aws.String(contentType),
+		}
+		if acl != "" {
+			uploadInput.ACL = aws.String(acl)
+		}
+		if sse != "" {
+			uploadInput.ServerSideEncryption = aws.String(sse)
+		}
+		if kmsKeyID != "" {
+			uploadInput.SSEKMSKeyId = aws.String(kmsKeyID)
+		}
+		if _, err := uploader.Upload(uploadInput); err != nil {
 			logAudit(false, err, map[string]interface{}{
-				"stage": "complete_multipart",
+				"stage":    "managed_upload",
 				"filename": header.Filename,
-				"size": fileSize,
+				"size":     fileSize,
+				"spooled":  spooled,
+				"acl":      acl,
 			})
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete multipart upload: " + err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file: " + err.Error()})
 			return
 		}
-		logAudit(true, nil, map[string]interface{}{
-			"stage": "multipart_upload",
-			"filename": header.Filename,
-			"size": fileSize,
-			"parts": len(completedParts),
+	}
+
+	s.adjustUsage(userID, config.ID, fileSize, 1)
+	checksum := s.recordUploadChecksum(config.ID, key, source, fileSize)
+
+	// Re-uploading a key replaces any earlier expiry
+	if expiresAt.IsZero() {
+		err = s.clearObjectExpiry(config.ID, key)
+	} else {
+		err = s.setObjectExpiry(ObjectExpiry{ConfigID: config.ID, UserID: userID, Key: key, ExpiresAt: expiresAt})
+	}
+	if err != nil {
+		logAudit(false, err, map[string]interface{}{
+			"stage":      "schedule_expiry",
+			"filename":   header.Filename,
+			"expires_at": expiresAt,
 		})
-		c.JSON(http.StatusOK, gin.H{"message": "File uploaded successfully (multipart)", "key": header.Filename})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "File uploaded but failed to record its expiry"})
 		return
 	}
 
-	// --- Small file: use PutObject ---
-	_, err = client.PutObject(&s3.PutObjectInput{
+	stage := "managed_upload"
+	if multipart {
+		stage = "multipart_upload"
+	}
+	details := map[string]interface{}{
+		"stage":     stage,
+		"filename":  header.Filename,
+		"size":      fileSize,
+		"spooled":   spooled,
+		"multipart": multipart,
+		"acl":       acl,
+		"sse":       sse,
+	}
+	if !expiresAt.IsZero() {
+		details["expires_at"] = expiresAt
+	}
+	if verifiedSize >= 0 {
+		details["verified_size"] = verifiedSize
+	}
+	if checksum != "" {
+		details["sha256"] = checksum
+	}
+	logAudit(true, nil, details)
+	message := "File uploaded successfully"
+	if multipart {
+		message = "File uploaded successfully (multipart)"
+	}
+	resp := gin.H{
+		"message":   message,
+		"key":       header.Filename,
+		"full_key":  key,
+		"bucket":    config.BucketName,
+		"config_id": config.ID,
+	}
+	if checksum != "" {
+		resp["sha256"] = checksum
+	}
+	// A link is a convenience; failing to build one doesn't fail the upload
+	if url, urlExpiresAt, err := objectURL(client, config.BucketName, key, acl); err == nil {
+		resp["url"] = url
+		if urlExpiresAt.IsZero() {
+			resp["url_type"] = "public"
+		} else {
+			resp["url_type"] = "presigned"
+			resp["url_expires_at"] = urlExpiresAt.UTC().Format(time.RFC3339)
+		}
+	}
+	if sse != "" {
+		resp["sse"] = sse
+	}
+	if !expiresAt.IsZero() {
+		resp["expires_at"] = expiresAt.UTC().Format(time.RFC3339)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// publicReadACLs are the canned ACLs under which anyone can GET an object
+var publicReadACLs = map[string]bool{
+	s3.ObjectCannedACLPublicRead:      true,
+	s3.ObjectCannedACLPublicReadWrite: true,
+}
+
+// objectURL returns a link to fullKey: the plain object URL when acl makes it
+// publicly readable, otherwise a GET URL presigned for defaultPresignExpiry.
+// The returned expiry is zero for public URLs.
+func objectURL(client *s3.S3, bucket, fullKey, acl string) (string, time.Time, error) {
+	req, _ := client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(fullKey),
+	})
+	if publicReadACLs[acl] {
+		if err := req.Build(); err != nil {
+			return "", time.Time{}, err
+		}
+		return req.HTTPRequest.URL.String(), time.Time{}, nil
+	}
+	url, err := req.Presign(defaultPresignExpiry)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return url, time.Now().Add(defaultPresignExpiry), nil
+}
+
+// maxPageSize is the largest page_size accepted by ListFiles
+const maxPageSize = 100
+
+// maxUploadSize returns the configured upload limit in bytes (0 means no limit)
+func (s *S3Service) maxUploadSize() int64 {
+	return int64(s.cfg.Upload.MaxSizeMB) * 1024 * 1024
+}
+
+// isAllowedContentType checks contentType against the configured upload types,
+// which may use a "type/*" wildcard. An empty list allows any type.
+func (s *S3Service) isAllowedContentType(contentType string) bool {
+	if len(s.cfg.Upload.AllowedContentTypes) == 0 {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, allowed := range s.cfg.Upload.AllowedContentTypes {
+		if allowed == mediaType || (strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(allowed, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateFilename checks an upload's filename against the configured length
+// and character policy, returning an error that names the offending character
+func (s *S3Service) validateFilename(name string) error {
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("filename is not valid UTF-8")
+	}
+	if n := utf8.RuneCountInString(name); n > s.cfg.Upload.MaxFilenameLength {
+		return fmt.Errorf("filename is %d characters long; the maximum is %d", n, s.cfg.Upload.MaxFilenameLength)
+	}
+	safe := s.cfg.Upload.FilenameCharset == config.FilenameCharsetSafe
+	for i, r := range []rune(name) {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("filename contains control character %U at position %d", r, i+1)
+		}
+		if safe && !isSafeFilenameChar(r) {
+			return fmt.Errorf("filename contains %q at position %d; only letters, digits and %s are allowed", r, i+1, config.FilenameSafeChars)
+		}
+	}
+	return nil
+}
+
+func isSafeFilenameChar(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || strings.ContainsRune(config.FilenameSafeChars, r)
+}
+
+// GetLimits returns the effective server limits so clients can configure themselves
+func (s *S3Service) GetLimits(c *gin.Context) {
+	previewTypes := make([]string, 0, len(previewImageTypes)+len(previewTextTypes)+1)
+	previewTypes = append(previewTypes, "text/*")
+	for t := range previewImageTypes {
+		previewTypes = append(previewTypes, t)
+	}
+	for t := range previewTextTypes {
+		previewTypes = append(previewTypes, t)
+	}
+	sort.Strings(previewTypes)
+
+	allowedContentTypes := s.cfg.Upload.AllowedContentTypes
+	if allowedContentTypes == nil {
+		allowedContentTypes = []string{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"max_upload_size":            s.maxUploadSize(),
+		"max_page_size":              maxPageSize,
+		"allowed_content_types":      allowedContentTypes,
+		"allowed_acls":               s.cfg.Upload.AllowedACLs,
+		"max_filename_length":        s.cfg.Upload.MaxFilenameLength,
+		"filename_charset":           s.cfg.Upload.FilenameCharset,
+		"multipart_threshold":        int64(s.cfg.Upload.PartSizeMB) * 1024 * 1024,
+		"multipart_concurrency":      s.cfg.Upload.Concurrency,
+		"preview_max_text_bytes":     s.cfg.Preview.MaxTextBytes,
+		"preview_content_types":      previewTypes,
+		"presign_max_expiry_seconds": int(maxPresignExpiry.Seconds()),
+		"presign_batch_max_keys":     maxPresignBatchKeys,
+	})
+}
+
+// isAllowedACL reports whether acl is in the configured upload allow list
+func (s *S3Service) isAllowedACL(acl string) bool {
+	for _, allowed := range s.cfg.Upload.AllowedACLs {
+		if acl == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// cannedACLFromGrants maps an object's grants back to the closest canned ACL
+func cannedACLFromGrants(grants []*s3.Grant) string {
+	const allUsers = "http://acs.amazonaws.com/groups/global/AllUsers"
+	acl := "private"
+	for _, grant := range grants {
+		if grant.Grantee == nil || aws.StringValue(grant.Grantee.URI) != allUsers {
+			continue
+		}
+		switch aws.StringValue(grant.Permission) {
+		case s3.PermissionWrite, s3.PermissionFullControl:
+			return "public-read-write"
+		case s3.PermissionRead:
+			acl = "public-read"
+		}
+	}
+	return acl
+}
+
+// GetFileMeta returns basic object metadata including its ACL
+func (s *S3Service) GetFileMeta(c *gin.Context) {
+	userID := c.GetString("user_id")
+	configID := c.Query("config_id")
+	key := c.Param("key")
+
+	fullKey, ok := s.userObjectKey(userID, key)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	config, err := s.resolveConfig(userID, configID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+
+	head, err := client.HeadObject(&s3.HeadObjectInput{
 		Bucket: aws.String(config.BucketName),
-		Key:    aws.String(key),
-		Body:   file,
+		Key:    aws.String(fullKey),
 	})
 	if err != nil {
-		logAudit(false, err, map[string]interface{}{
-			"stage": "put_object",
-			"filename": header.Filename,
-			"size": fileSize,
-		})
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file: " + err.Error()})
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
 		return
 	}
-	logAudit(true, nil, map[string]interface{}{
-		"stage": "put_object",
-		"filename": header.Filename,
-		"size": fileSize,
+
+	// Some S3-compatible backends don't support ACLs; report them as unknown
+	acl := ""
+	aclOutput, err := client.GetObjectAcl(&s3.GetObjectAclInput{
+		Bucket: aws.String(config.BucketName),
+		Key:    aws.String(fullKey),
 	})
-	c.JSON(http.StatusOK, gin.H{"message": "File uploaded successfully", "key": header.Filename})
+	if err == nil {
+		acl = cannedACLFromGrants(aclOutput.Grants)
+	}
+
+	meta := gin.H{
+		"key":           key,
+		"size":          aws.Int64Value(head.ContentLength),
+		"content_type":  aws.StringValue(head.ContentType),
+		"last_modified": aws.TimeValue(head.LastModified),
+		"etag":          aws.StringValue(head.ETag),
+		"acl":           acl,
+		"sse":           aws.StringValue(head.ServerSideEncryption),
+	}
+	if expiry, err := s.getObjectExpiry(config.ID, fullKey); err == nil && expiry != nil {
+		ttl := time.Until(expiry.ExpiresAt)
+		if ttl < 0 {
+			ttl = 0
+		}
+		meta["expires_at"] = expiry.ExpiresAt.UTC().Format(time.RFC3339)
+		meta["ttl_seconds"] = int64(ttl.Seconds())
+	}
+	if sum, err := s.getObjectChecksum(config.ID, fullKey); err == nil && sum != nil {
+		meta["sha256"] = sum.SHA256
+	}
+	c.JSON(http.StatusOK, meta)
 }
 
+// spoolToTempFile copies src into a new temp file in dir and rewinds it for reading
+func spoolToTempFile(dir string, src io.Reader) (*os.File, error) {
+	tmp, err := os.CreateTemp(dir, "s3mgr-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
 
 // DownloadFile handles file download from S3
 func (s *S3Service) DownloadFile(c *gin.Context) {
@@ -424,16 +1323,20 @@ func (s *S3Service) DownloadFile(c *gin.Context) {
 	userID := c.GetString("user_id")
 	configID := c.Query("config_id")
 	key := c.Param("key")
-
-	var config *S3Config
-	var err error
-	if configID != "" {
-		config, err = s.getConfigByID(userID, configID)
-	} else {
-		config, err = s.getDefaultConfig(userID)
+	disposition := c.DefaultQuery("disposition", "attachment")
+	if disposition != "attachment" && disposition != "inline" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "disposition must be inline or attachment"})
+		return
 	}
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Configuration not found"})
+	fullKey, ok := s.userObjectKey(userID, key)
+	if !ok {
+		logAudit(false, fmt.Errorf("invalid key"), map[string]interface{}{"filename": key})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	config, err := s.resolveConfig(userID, configID)
+	if respondConfigError(c, err) {
 		return
 	}
 	client := s.createS3Client(*config)
@@ -441,120 +1344,196 @@ func (s *S3Service) DownloadFile(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
 		return
 	}
-	userPrefix := fmt.Sprintf("users/%s/", userID)
-	fullKey := userPrefix + key
-	resp, err := client.GetObject(&s3.GetObjectInput{
+	input := &s3.GetObjectInput{
 		Bucket: aws.String(config.BucketName),
 		Key:    aws.String(fullKey),
-	})
+	}
+	// Pass byte ranges through so clients can seek and resume; any other
+	// Range unit is ignored and the whole object is sent, as HTTP allows
+	rangeHeader := c.GetHeader("Range")
+	if strings.HasPrefix(rangeHeader, "bytes=") {
+		input.Range = aws.String(rangeHeader)
+	}
+	resp, err := client.GetObject(input)
 	if err != nil {
+		// The detailed SDK error (bucket, request IDs) stays in the audit log
 		logAudit(false, err, map[string]interface{}{
 			"filename": key,
 			"full_key": fullKey,
-			"stage": "get_object",
+			"stage":    "get_object",
+			"range":    aws.StringValue(input.Range),
 		})
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download file: " + err.Error()})
+		if isObjectNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		if isInvalidRange(err) {
+			c.JSON(http.StatusRequestedRangeNotSatisfiable, gin.H{"error": "Requested range not satisfiable"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download file"})
 		return
 	}
 	defer resp.Body.Close()
-	c.Header("Content-Disposition", "attachment; filename="+key)
-	c.Header("Content-Type", *resp.ContentType)
-	c.Status(http.StatusOK)
+
+	// Only render inline when the content can't run script in our origin
+	contentType := effectiveContentType(aws.StringValue(resp.ContentType), key)
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if disposition == "inline" && !inlineSafeTypes[mediaType] && !previewImageTypes[mediaType] {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": path.Base(key)}))
+	c.Header("Content-Type", contentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Accept-Ranges", "bytes")
+	if resp.ContentLength != nil {
+		c.Header("Content-Length", strconv.FormatInt(*resp.ContentLength, 10))
+	}
+	status := http.StatusOK
+	if resp.ContentRange != nil {
+		c.Header("Content-Range", *resp.ContentRange)
+		status = http.StatusPartialContent
+	}
+	c.Status(status)
 	_, _ = io.Copy(c.Writer, resp.Body)
 	// Log success (content length may be nil for some S3 backends)
 	var size int64 = 0
 	if resp.ContentLength != nil {
 		size = *resp.ContentLength
 	}
-	logAudit(true, nil, map[string]interface{}{
-		"filename": key,
-		"full_key": fullKey,
-		"size": size,
-	})
+	details := map[string]interface{}{
+		"filename":    key,
+		"full_key":    fullKey,
+		"size":        size,
+		"disposition": disposition,
+	}
+	if resp.ContentRange != nil {
+		details["range"] = *resp.ContentRange
+	}
+	logAudit(true, nil, details)
 }
 
-// ListFiles lists files in S3 with pagination
-func (s *S3Service) ListFiles(c *gin.Context) {
-	userID := c.GetString("user_id")
+// AdminDownloadFile lets an admin download any user's object by full key (admin only).
+// Every attempt is audit-logged with the target user and key.
+func (s *S3Service) AdminDownloadFile(c *gin.Context) {
 	configID := c.Query("config_id")
-	page := 1
-	pageSize := 10
-	if p := c.Query("page"); p != "" {
-		fmt.Sscanf(p, "%d", &page)
-	}
-	if ps := c.Query("page_size"); ps != "" {
-		fmt.Sscanf(ps, "%d", &pageSize)
-	}
-	if page < 1 {
-		page = 1
+	fullKey := c.Query("key")
+
+	details := map[string]interface{}{
+		"config_id": configID,
+		"full_key":  fullKey,
 	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 10
+	// Audit logging helper
+	logAudit := func(success bool, err error) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "admin_download_file", "file", fullKey, success, err, details)
+		}
 	}
-	var config *S3Config
-	var err error
-	if configID != "" {
-		config, err = s.getConfigByID(userID, configID)
-	} else {
-		config, err = s.getDefaultConfig(userID)
+
+	if configID == "" || fullKey == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "config_id and key are required"})
+		return
 	}
-	if err != nil {
+
+	config, err := s.findConfigByID(configID)
+	if err != nil || !canAccessOrg(c, config.OrgID) {
+		details["stage"] = "get_config"
+		logAudit(false, fmt.Errorf("configuration not found"))
 		c.JSON(http.StatusNotFound, gin.H{"error": "Configuration not found"})
 		return
 	}
+	details["target_user"] = config.UserID
+	details["bucket"] = config.BucketName
+
 	client := s.createS3Client(*config)
 	if client == nil {
+		details["stage"] = "create_client"
+		logAudit(false, fmt.Errorf("failed to create storage client"))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
 		return
 	}
-	userPrefix := fmt.Sprintf("users/%s/", userID)
-	result, err := client.ListObjects(&s3.ListObjectsInput{
+	resp, err := client.GetObject(&s3.GetObjectInput{
 		Bucket: aws.String(config.BucketName),
-		Prefix: aws.String(userPrefix),
+		Key:    aws.String(fullKey),
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list files: " + err.Error()})
+		details["stage"] = "get_object"
+		logAudit(false, err)
+		if isObjectNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download file"})
 		return
 	}
-	var files []map[string]interface{}
-	for _, obj := range result.Contents {
-		displayKey := strings.TrimPrefix(*obj.Key, userPrefix)
-		if displayKey == "" {
-			continue
-		}
-		files = append(files, map[string]interface{}{
-			"key":           displayKey,
-			"full_key":      *obj.Key,
-			"size":          *obj.Size,
-			"last_modified": obj.LastModified.Format(time.RFC3339),
-		})
+	defer resp.Body.Close()
+
+	// Quoted and encoded as needed, so the key cannot add header parameters
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(fullKey)}))
+	if resp.ContentType != nil {
+		c.Header("Content-Type", *resp.ContentType)
 	}
-	total := len(files)
-	start := (page - 1) * pageSize
-	end := start + pageSize
-	if start > total {
-		start = total
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, resp.Body)
+	var size int64 = 0
+	if resp.ContentLength != nil {
+		size = *resp.ContentLength
 	}
-	if end > total {
-		end = total
+	details["size"] = size
+	logAudit(true, nil)
+}
+
+// previewImageTypes are the image content types that are safe to render inline
+var previewImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+}
+
+// inlineSafeTypes are the non-image content types DownloadFile may serve inline.
+// Anything that a browser could execute (HTML, SVG, XML) is always an attachment.
+var inlineSafeTypes = map[string]bool{
+	"application/pdf":  true,
+	"application/json": true,
+	"text/plain":       true,
+	"text/csv":         true,
+	"audio/mpeg":       true,
+	"audio/wav":        true,
+	"video/mp4":        true,
+	"video/webm":       true,
+}
+
+// effectiveContentType falls back to the file extension when storage only
+// knows a generic type
+func effectiveContentType(stored, key string) string {
+	if stored == "" || stored == "application/octet-stream" || stored == "binary/octet-stream" {
+		if byExt := mime.TypeByExtension(path.Ext(key)); byExt != "" {
+			return byExt
+		}
+		if stored == "" {
+			return "application/octet-stream"
+		}
 	}
-	paginated := files[start:end]
-	c.JSON(http.StatusOK, gin.H{
-		"files":       paginated,
-		"total":       total,
-		"page":        page,
-		"page_size":   pageSize,
-		"config_id":   config.ID,
-		"config_name": config.Name,
-	})
+	return stored
 }
 
-// DeleteFile deletes a file from S3
-func (s *S3Service) DeleteFile(c *gin.Context) {
+// previewTextTypes are the non text/* content types previewed as text. Text
+// types not in inlineSafeTypes (HTML, XML, ...) are served as text/plain so
+// the browser shows their source instead of rendering it.
+var previewTextTypes = map[string]bool{
+	"application/json": true,
+	"application/xml":  true,
+}
+
+// PreviewFile returns a whitelisted image or the first bytes of a text file inline
+func (s *S3Service) PreviewFile(c *gin.Context) {
 	// Audit logging helper
 	logAudit := func(success bool, err error, details map[string]interface{}) {
 		if s.auditService != nil {
-			s.auditService.LogEvent(c, "delete_file", "file", "", success, err, details)
+			s.auditService.LogEvent(c, "preview_file", "file", "", success, err, details)
 		}
 	}
 
@@ -562,45 +1541,1779 @@ func (s *S3Service) DeleteFile(c *gin.Context) {
 	configID := c.Query("config_id")
 	key := c.Param("key")
 
-	var config *S3Config
-	var err error
-	if configID != "" {
-		config, err = s.getConfigByID(userID, configID)
-	} else {
-		config, err = s.getDefaultConfig(userID)
+	fullKey, ok := s.userObjectKey(userID, key)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	config, err := s.resolveConfig(userID, configID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+	head, err := client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(config.BucketName),
+		Key:    aws.String(fullKey),
+	})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	contentType := effectiveContentType(aws.StringValue(head.ContentType), key)
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	isText := strings.HasPrefix(mediaType, "text/") || previewTextTypes[mediaType]
+	if !isText && !previewImageTypes[mediaType] {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "File type cannot be previewed", "content_type": contentType})
+		return
+	}
+	servedType := contentType
+	if isText && !inlineSafeTypes[mediaType] {
+		servedType = "text/plain; charset=utf-8"
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(config.BucketName),
+		Key:    aws.String(fullKey),
+	}
+	truncated := false
+	if isText && aws.Int64Value(head.ContentLength) > s.cfg.Preview.MaxTextBytes {
+		input.Range = aws.String(fmt.Sprintf("bytes=0-%d", s.cfg.Preview.MaxTextBytes-1))
+		truncated = true
+	}
+	resp, err := client.GetObject(input)
+	if err != nil {
+		logAudit(false, err, map[string]interface{}{
+			"filename": key,
+			"full_key": fullKey,
+			"stage":    "get_object",
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to preview file: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": path.Base(key)}))
+	c.Header("Content-Type", servedType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	if truncated {
+		c.Header("X-Preview-Truncated", "true")
+	}
+	c.Status(http.StatusOK)
+	n, _ := io.Copy(c.Writer, resp.Body)
+	logAudit(true, nil, map[string]interface{}{
+		"filename":  key,
+		"full_key":  fullKey,
+		"size":      n,
+		"truncated": truncated,
+	})
+}
+
+// PresignDownload returns a presigned GET URL for a file, optionally pinned to a specific object version
+func (s *S3Service) PresignDownload(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "presign_download", "file", "", success, err, details)
+		}
+	}
+
+	userID := c.GetString("user_id")
+	configID := c.Query("config_id")
+	versionID := c.Query("version_id")
+	key := c.Param("key")
+
+	expiry, err := parsePresignExpiry(c.Query("expiry"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	config, err := s.resolveConfig(userID, configID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+	fullKey, ok := s.userObjectKey(userID, key)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	// Make sure the requested version exists before handing out a link to it
+	if versionID != "" {
+		_, err = client.HeadObject(&s3.HeadObjectInput{
+			Bucket:    aws.String(config.BucketName),
+			Key:       aws.String(fullKey),
+			VersionId: aws.String(versionID),
+		})
+		if err != nil {
+			logAudit(false, err, map[string]interface{}{
+				"filename":   key,
+				"full_key":   fullKey,
+				"version_id": versionID,
+				"stage":      "head_object",
+			})
+			c.JSON(http.StatusNotFound, gin.H{"error": "Object version not found"})
+			return
+		}
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(config.BucketName),
+		Key:    aws.String(fullKey),
+	}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+	req, _ := client.GetObjectRequest(input)
+	url, err := req.Presign(expiry)
+	if err != nil {
+		logAudit(false, err, map[string]interface{}{
+			"filename":   key,
+			"full_key":   fullKey,
+			"version_id": versionID,
+			"stage":      "presign",
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to presign URL: " + err.Error()})
+		return
+	}
+	logAudit(true, nil, map[string]interface{}{
+		"filename":   key,
+		"full_key":   fullKey,
+		"version_id": versionID,
+		"expiry":     expiry.String(),
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"url":        url,
+		"key":        key,
+		"version_id": versionID,
+		"expires_at": time.Now().Add(expiry).UTC().Format(time.RFC3339),
+	})
+}
+
+const (
+	// defaultPresignExpiry is used when the client does not ask for an expiry
+	defaultPresignExpiry = 15 * time.Minute
+	// maxPresignExpiry is the longest lifetime S3 allows for SigV4 presigned URLs
+	maxPresignExpiry = 7 * 24 * time.Hour
+	// maxPresignBatchKeys bounds the number of keys in one batch request
+	maxPresignBatchKeys = 500
+)
+
+// parsePresignExpiry parses an expiry given as seconds ("3600") or a Go
+// duration ("1h"), defaulting to defaultPresignExpiry and capped at the SigV4 limit
+func parsePresignExpiry(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultPresignExpiry, nil
+	}
+	var expiry time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		expiry = time.Duration(seconds) * time.Second
+	} else if expiry, err = time.ParseDuration(value); err != nil {
+		return 0, fmt.Errorf("invalid expiry %q: use seconds or a duration like 1h", value)
+	}
+	if expiry < time.Second || expiry > maxPresignExpiry {
+		return 0, fmt.Errorf("expiry must be between 1s and %s", maxPresignExpiry)
+	}
+	return expiry, nil
+}
+
+// PresignBatchRequest asks for download URLs for several keys at once
+type PresignBatchRequest struct {
+	ConfigID      string   `json:"config_id"`
+	Keys          []string `json:"keys" binding:"required"`
+	ExpirySeconds int      `json:"expiry_seconds"`
+}
+
+// userPrefix is the key prefix of userID's objects: users/<userID>/ under the
+// configured global key prefix
+func (s *S3Service) userPrefix(userID string) string {
+	return s.cfg.Storage.GlobalKeyPrefix + "users/" + userID + "/"
+}
+
+// userObjectKey maps a client-supplied key to its full key under the user's
+// prefix, reporting false if the key would escape that prefix
+func (s *S3Service) userObjectKey(userID, key string) (string, bool) {
+	userPrefix := s.userPrefix(userID)
+	cleaned := strings.TrimPrefix(path.Clean("/"+key), "/")
+	if key == "" || cleaned == "" || cleaned != strings.TrimPrefix(key, "/") {
+		return "", false
+	}
+	return userPrefix + cleaned, true
+}
+
+// PresignDownloadBatch generates presigned download URLs for a list of keys
+func (s *S3Service) PresignDownloadBatch(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "presign_download_batch", "file", "", success, err, details)
+		}
+	}
+
+	userID := c.GetString("user_id")
+
+	var req PresignBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Keys) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one key is required"})
+		return
+	}
+	if len(req.Keys) > maxPresignBatchKeys {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d keys are allowed per request", maxPresignBatchKeys)})
+		return
+	}
+
+	expiry := defaultPresignExpiry
+	if req.ExpirySeconds != 0 {
+		expiry = time.Duration(req.ExpirySeconds) * time.Second
+		if expiry <= 0 || expiry > maxPresignExpiry {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("expiry_seconds must be between 1 and %d", int(maxPresignExpiry.Seconds()))})
+			return
+		}
+	}
+
+	// Validate every key before signing anything
+	fullKeys := make(map[string]string, len(req.Keys))
+	for _, key := range req.Keys {
+		fullKey, ok := s.userObjectKey(userID, key)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key: " + key})
+			return
+		}
+		fullKeys[key] = fullKey
+	}
+
+	config, err := s.resolveConfig(userID, req.ConfigID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+
+	urls := make(map[string]string, len(fullKeys))
+	for key, fullKey := range fullKeys {
+		presignReq, _ := client.GetObjectRequest(&s3.GetObjectInput{
+			Bucket: aws.String(config.BucketName),
+			Key:    aws.String(fullKey),
+		})
+		url, err := presignReq.Presign(expiry)
+		if err != nil {
+			logAudit(false, err, map[string]interface{}{
+				"count":    len(fullKeys),
+				"filename": key,
+				"stage":    "presign",
+			})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to presign URL: " + err.Error()})
+			return
+		}
+		urls[key] = url
+	}
+
+	logAudit(true, nil, map[string]interface{}{
+		"count":  len(urls),
+		"expiry": expiry.String(),
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"urls":       urls,
+		"expires_at": time.Now().Add(expiry).UTC().Format(time.RFC3339),
+	})
+}
+
+// PresignUploadRequest asks for a URL the browser can PUT a file to directly
+type PresignUploadRequest struct {
+	ConfigID      string `json:"config_id"`
+	Filename      string `json:"filename" binding:"required"`
+	ContentType   string `json:"content_type"`
+	ExpirySeconds int    `json:"expiry_seconds"`
+	// Size is the exact upload size in bytes, signed into the URL; required under a storage quota
+	Size int64 `json:"size"`
+}
+
+// PresignUpload returns a presigned PUT URL so large files can be uploaded
+// straight to the bucket instead of through the server
+func (s *S3Service) PresignUpload(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "presign_upload", "file", "", success, err, details)
+		}
+	}
+
+	userID := c.GetString("user_id")
+
+	var req PresignUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	fullKey, ok := s.userObjectKey(userID, req.Filename)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filename"})
+		return
+	}
+	if err := s.validateFilename(req.Filename); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_filename"})
+		return
+	}
+	key := strings.TrimPrefix(fullKey, s.userPrefix(userID))
+
+	contentType := effectiveContentType(req.ContentType, key)
+	if !s.isAllowedContentType(contentType) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":                 "Content type not allowed: " + contentType,
+			"allowed_content_types": s.cfg.Upload.AllowedContentTypes,
+		})
+		return
+	}
+
+	expiry := defaultPresignExpiry
+	if req.ExpirySeconds != 0 {
+		expiry = time.Duration(req.ExpirySeconds) * time.Second
+		if expiry <= 0 || expiry > maxPresignExpiry {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("expiry_seconds must be between 1 and %d", int(maxPresignExpiry.Seconds()))})
+			return
+		}
+	}
+
+	config, err := s.resolveConfig(userID, req.ConfigID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+
+	// Under a quota the size must be declared, since it is the only part of
+	// the upload checked here
+	user, err := s.getUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return
+	}
+	if req.Size < 0 || (user.QuotaBytes > 0 && req.Size == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "size is required when a storage quota applies", "code": "size_required"})
+		return
+	}
+	if !s.checkQuota(c, userID, req.Size) {
+		return
+	}
+
+	// The bucket, key, content type and any declared size are part of the
+	// signature, so the client cannot redirect or enlarge the upload
+	putInput := &s3.PutObjectInput{
+		Bucket:      aws.String(config.BucketName),
+		Key:         aws.String(fullKey),
+		ContentType: aws.String(contentType),
+	}
+	if req.Size > 0 {
+		putInput.ContentLength = aws.Int64(req.Size)
+	}
+	presignReq, _ := client.PutObjectRequest(putInput)
+	url, err := presignReq.Presign(expiry)
+	if err != nil {
+		logAudit(false, err, map[string]interface{}{
+			"filename": key,
+			"full_key": fullKey,
+			"stage":    "presign",
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to presign URL: " + err.Error()})
+		return
+	}
+
+	// Counted now so repeated presigns cannot each claim the same free space
+	if req.Size > 0 {
+		s.adjustUsage(userID, config.ID, req.Size, 1)
+	}
+	// The server never sees what the client uploads, so it can no longer vouch for the key's checksum
+	s.clearObjectChecksum(config.ID, fullKey)
+	// Nor is an earlier upload's expiry meant for the new content
+	s.dropObjectExpiry(config.ID, fullKey)
+
+	logAudit(true, nil, map[string]interface{}{
+		"filename":     key,
+		"full_key":     fullKey,
+		"content_type": contentType,
+		"config_id":    config.ID,
+		"expiry":       expiry.String(),
+		"size":         req.Size,
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"url":        url,
+		"method":     http.MethodPut,
+		"headers":    gin.H{"Content-Type": contentType},
+		"key":        key,
+		"config_id":  config.ID,
+		"expires_at": time.Now().Add(expiry).UTC().Format(time.RFC3339),
+	})
+}
+
+// ListFiles lists one page of the user's files, optionally under a prefix.
+// With delimiter=/ only the prefix's direct children are returned, subfolders
+// as folder entries. Pages are fetched with the continuation token from the
+// previous response rather than by page number.
+func (s *S3Service) ListFiles(c *gin.Context) {
+	userID := c.GetString("user_id")
+	configID := c.Query("config_id")
+	prefix := c.Query("prefix")
+	delimiter := c.Query("delimiter")
+	continuationToken := c.Query("continuation_token")
+	withCount := c.Query("count") == "true"
+	pageSize := 10
+	if ps := c.Query("page_size"); ps != "" {
+		fmt.Sscanf(ps, "%d", &pageSize)
+	}
+	if pageSize < 1 || pageSize > maxPageSize {
+		pageSize = 10
+	}
+	if prefix != "" {
+		if _, ok := s.userObjectKey(userID, strings.TrimSuffix(prefix, "/")); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prefix: " + prefix})
+			return
+		}
+	}
+	// Folders are "/"-separated, so that is the only delimiter that makes sense
+	if delimiter != "" && delimiter != "/" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": `delimiter must be "/"`})
+		return
+	}
+
+	config, err := s.resolveConfig(userID, configID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+	userPrefix := s.userPrefix(userID)
+	listPrefix := userPrefix + prefix
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(config.BucketName),
+		Prefix:  aws.String(listPrefix),
+		MaxKeys: aws.Int64(int64(pageSize)),
+	}
+	if delimiter != "" {
+		input.Delimiter = aws.String(delimiter)
+	}
+	if continuationToken != "" {
+		input.ContinuationToken = aws.String(continuationToken)
+	}
+	result, err := client.ListObjectsV2(input)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list files: " + err.Error()})
+		return
+	}
+
+	// A total needs a scan of the whole listing, so it is only computed on request
+	var total *int
+	if withCount {
+		n, err := countListing(client, config.BucketName, listPrefix, delimiter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count files: " + err.Error()})
+			return
+		}
+		total = &n
+	}
+
+	var files []map[string]interface{}
+	// With a delimiter, the folders directly under prefix come back as common prefixes
+	for _, commonPrefix := range result.CommonPrefixes {
+		fullKey := aws.StringValue(commonPrefix.Prefix)
+		files = append(files, map[string]interface{}{
+			"key":       strings.TrimPrefix(fullKey, userPrefix),
+			"full_key":  fullKey,
+			"size":      0,
+			"is_folder": true,
+		})
+	}
+	for _, obj := range result.Contents {
+		// Skip the marker of the folder being listed, including the user's own
+		if aws.StringValue(obj.Key) == listPrefix && strings.HasSuffix(listPrefix, "/") {
+			continue
+		}
+		displayKey := strings.TrimPrefix(*obj.Key, userPrefix)
+		// Keys ending in "/" are folder markers from CreateFolder
+		files = append(files, map[string]interface{}{
+			"key":           displayKey,
+			"full_key":      *obj.Key,
+			"size":          *obj.Size,
+			"last_modified": obj.LastModified.Format(time.RFC3339),
+			"is_folder":     strings.HasSuffix(displayKey, "/"),
+		})
+	}
+
+	cursor := response.Cursor{
+		PageSize:              pageSize,
+		ContinuationToken:     continuationToken,
+		NextContinuationToken: aws.StringValue(result.NextContinuationToken),
+		HasMore:               aws.BoolValue(result.IsTruncated),
+		Total:                 total,
+	}
+	extra := gin.H{
+		"config_id":   config.ID,
+		"config_name": config.Name,
+		"prefix":      prefix,
+		"delimiter":   delimiter,
+	}
+	// Only current versions are listed; with versioning on, deleted files
+	// and older versions are still in the bucket (see /files/:key/versions)
+	if status, err := s.bucketVersioning(client, *config); err == nil {
+		extra["versioning"] = status
+		extra["versioning_enabled"] = status == versioningEnabled
+	}
+	response.CursorList(c, "files", files, cursor, extra)
+}
+
+// countListing returns how many entries ListFiles would return across all
+// pages for the same prefix and delimiter
+func countListing(client *s3.S3, bucket, listPrefix, delimiter string) (int, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(listPrefix),
+	}
+	if delimiter != "" {
+		input.Delimiter = aws.String(delimiter)
+	}
+	count := 0
+	err := client.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		count += len(page.CommonPrefixes)
+		for _, obj := range page.Contents {
+			if aws.StringValue(obj.Key) == listPrefix && strings.HasSuffix(listPrefix, "/") {
+				continue
+			}
+			count++
+		}
+		return true
+	})
+	return count, err
+}
+
+// CountFiles returns the number of objects under a prefix of the user's
+// folder, and optionally their total size, without returning the keys
+func (s *S3Service) CountFiles(c *gin.Context) {
+	userID := c.GetString("user_id")
+	configID := c.Query("config_id")
+	prefix := c.Query("prefix")
+	includeSize := c.Query("include_size") == "true"
+
+	if prefix != "" {
+		if _, ok := s.userObjectKey(userID, strings.TrimSuffix(prefix, "/")); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prefix: " + prefix})
+			return
+		}
+	}
+
+	config, err := s.resolveConfig(userID, configID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+	userPrefix := s.userPrefix(userID)
+
+	var count, totalSize int64
+	err = client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(config.BucketName),
+		Prefix: aws.String(userPrefix + prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		count += aws.Int64Value(page.KeyCount)
+		for _, obj := range page.Contents {
+			// Folder markers, including the user's own, are not files
+			if strings.HasSuffix(aws.StringValue(obj.Key), "/") {
+				count--
+				continue
+			}
+			if includeSize {
+				totalSize += aws.Int64Value(obj.Size)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count files: " + err.Error()})
+		return
+	}
+
+	result := gin.H{
+		"prefix":    prefix,
+		"count":     count,
+		"config_id": config.ID,
+	}
+	if includeSize {
+		result["total_size"] = totalSize
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// CreateFolderRequest names a folder relative to the user's prefix
+type CreateFolderRequest struct {
+	ConfigID string `json:"config_id"`
+	Path     string `json:"path" binding:"required"`
+}
+
+// CreateFolder stores a zero-byte marker object whose key ends in "/", so that
+// an empty folder shows up in listings
+func (s *S3Service) CreateFolder(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "create_folder", "file", "", success, err, details)
+		}
+	}
+
+	userID := c.GetString("user_id")
+
+	var req CreateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	folder, fullKey, ok := s.folderPrefix(userID, req.Path)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid path: must be relative and must not contain .."})
+		return
+	}
+	if err := s.validateFilename(strings.TrimSuffix(folder, "/")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_filename"})
+		return
+	}
+
+	config, err := s.resolveConfig(userID, req.ConfigID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+
+	if _, err := client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(config.BucketName),
+		Key:    aws.String(fullKey),
+	}); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Folder already exists", "path": folder})
+		return
+	}
+
+	details := map[string]interface{}{
+		"path":     folder,
+		"full_key": fullKey,
+	}
+	_, err = client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(config.BucketName),
+		Key:         aws.String(fullKey),
+		Body:        bytes.NewReader(nil),
+		ContentType: aws.String("application/x-directory"),
+	})
+	if err != nil {
+		logAudit(false, err, details)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create folder: " + err.Error()})
+		return
+	}
+	logAudit(true, nil, details)
+	c.JSON(http.StatusCreated, gin.H{"message": "Folder created successfully", "path": folder})
+}
+
+// DeleteFile deletes a file from S3
+func (s *S3Service) DeleteFile(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "delete_file", "file", "", success, err, details)
+		}
+	}
+
+	userID := c.GetString("user_id")
+	configID := c.Query("config_id")
+	key := c.Param("key")
+
+	fullKey, ok := s.userObjectKey(userID, key)
+	if !ok {
+		logAudit(false, fmt.Errorf("invalid key"), map[string]interface{}{"filename": key})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+
+	config, err := s.resolveConfig(userID, configID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+	userPrefix := s.userPrefix(userID)
+
+	// version_id deletes that version for good instead of the current one
+	if versionID := c.Query("version_id"); versionID != "" {
+		if c.Query("dry_run") == "true" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run cannot be combined with version_id"})
+			return
+		}
+		s.deleteObjectVersion(c, client, config, key, fullKey, versionID)
+		return
+	}
+
+	// dry_run reports what would be deleted without deleting it
+	if c.Query("dry_run") == "true" {
+		preview, err := previewDeletion(client, config.BucketName, userPrefix, []string{key}, "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to preview deletion: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, preview)
+		return
+	}
+
+	// S3 reports success when deleting a missing key, so check it exists first
+	head, err := client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(config.BucketName),
+		Key:    aws.String(fullKey),
+	})
+	if isObjectNotFound(err) {
+		logAudit(false, err, map[string]interface{}{
+			"filename": key,
+			"full_key": fullKey,
+		})
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	deleted, err := client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(config.BucketName),
+		Key:    aws.String(fullKey),
+	})
+	if err != nil {
+		logAudit(false, err, map[string]interface{}{
+			"filename": key,
+			"full_key": fullKey,
+		})
+		if isObjectNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file: " + err.Error()})
+		return
+	}
+	if err == nil && head != nil {
+		s.adjustUsage(userID, config.ID, -aws.Int64Value(head.ContentLength), -1)
+	} else {
+		s.invalidateUsage(userID, config.ID)
+	}
+	s.clearObjectChecksum(config.ID, fullKey)
+	s.dropObjectExpiry(config.ID, fullKey)
+	details := map[string]interface{}{
+		"filename": key,
+		"full_key": fullKey,
+	}
+	resp := gin.H{"message": "File deleted successfully"}
+	// In a versioned bucket the data stays behind a delete marker until its
+	// versions are deleted by version_id
+	if aws.BoolValue(deleted.DeleteMarker) {
+		details["delete_marker_version_id"] = aws.StringValue(deleted.VersionId)
+		resp["delete_marker"] = true
+		resp["delete_marker_version_id"] = aws.StringValue(deleted.VersionId)
+	}
+	logAudit(true, nil, details)
+	c.JSON(http.StatusOK, resp)
+}
+
+// CopyFileRequest names the source and destination of a copy or move, both
+// relative to the user's prefix
+type CopyFileRequest struct {
+	ConfigID  string `json:"config_id"`
+	SourceKey string `json:"source_key" binding:"required"`
+	DestKey   string `json:"dest_key" binding:"required"`
+}
+
+// CopyFile copies a file to a new key in the same bucket
+func (s *S3Service) CopyFile(c *gin.Context) {
+	s.copyFile(c, false)
+}
+
+// MoveFile copies a file to a new key and then deletes the source
+func (s *S3Service) MoveFile(c *gin.Context) {
+	s.copyFile(c, true)
+}
+
+type DuplicateFileRequest struct {
+	ConfigID string `json:"config_id"`
+	Key      string `json:"key" binding:"required"`
+}
+
+// maxDuplicateAttempts bounds the "-copy-N" suffixes tried for a free key
+const maxDuplicateAttempts = 100
+
+// duplicateKey returns the n-th candidate name for a copy of key:
+// "a/foo.pdf" gives "a/foo-copy.pdf", then "a/foo-copy-2.pdf" and so on
+func duplicateKey(key string, n int) string {
+	dir, name := path.Split(key)
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		// Dotfiles like ".env" have no extension to keep
+		base, ext = name, ""
+	}
+	if strings.HasSuffix(base, ".tar") {
+		// Keep compound extensions like ".tar.gz" together
+		base, ext = strings.TrimSuffix(base, ".tar"), ".tar"+ext
+	}
+	suffix := "-copy"
+	if n > 1 {
+		suffix = fmt.Sprintf("-copy-%d", n)
+	}
+	return dir + base + suffix + ext
+}
+
+// DuplicateFile copies a file next to itself under the first free
+// "-copy" name and returns the new key
+func (s *S3Service) DuplicateFile(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "duplicate_file", "file", "", success, err, details)
+		}
+	}
+
+	userID := c.GetString("user_id")
+
+	var req DuplicateFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sourceKey, ok := s.userObjectKey(userID, req.Key)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key"})
+		return
+	}
+	userPrefix := s.userPrefix(userID)
+
+	config, err := s.resolveConfig(userID, req.ConfigID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+
+	details := map[string]interface{}{
+		"source_key": req.Key,
+		"config_id":  config.ID,
+	}
+
+	source, err := client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(config.BucketName),
+		Key:    aws.String(sourceKey),
+	})
+	if err != nil {
+		details["stage"] = "head_source"
+		logAudit(false, err, details)
+		if isObjectNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read source file"})
+		return
+	}
+
+	// Take the first candidate name that is not already in use
+	destKey := ""
+	for n := 1; n <= maxDuplicateAttempts; n++ {
+		candidate := duplicateKey(sourceKey, n)
+		_, err = client.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(config.BucketName),
+			Key:    aws.String(candidate),
+		})
+		if isObjectNotFound(err) {
+			destKey = candidate
+			break
+		}
+		if err != nil {
+			details["stage"] = "head_dest"
+			logAudit(false, err, details)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check destination"})
+			return
+		}
+	}
+	if destKey == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("No free copy name after %d attempts", maxDuplicateAttempts)})
+		return
+	}
+	newKey := strings.TrimPrefix(destKey, userPrefix)
+	if err := s.validateFilename(newKey); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Copy name is not allowed: " + err.Error(), "code": "invalid_filename"})
+		return
+	}
+	details["dest_key"] = newKey
+	size := aws.Int64Value(source.ContentLength)
+	if !s.checkQuota(c, userID, size) {
+		return
+	}
+
+	// CopySource is "bucket/key" and must be URL-encoded
+	copySource := (&url.URL{Path: config.BucketName + "/" + sourceKey}).EscapedPath()
+	_, err = client.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(config.BucketName),
+		Key:        aws.String(destKey),
+		CopySource: aws.String(copySource),
+	})
+	if err != nil {
+		details["stage"] = "copy"
+		logAudit(false, err, details)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to duplicate file: " + err.Error()})
+		return
+	}
+
+	s.adjustUsage(userID, config.ID, size, 1)
+	s.copyObjectChecksum(config.ID, sourceKey, destKey, false)
+	s.dropObjectExpiry(config.ID, destKey)
+	logAudit(true, nil, details)
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "File duplicated successfully",
+		"source_key": req.Key,
+		"key":        newKey,
+	})
+}
+
+// copyFile implements CopyFile and MoveFile. The destination must not exist
+// unless overwrite=true is passed.
+func (s *S3Service) copyFile(c *gin.Context, move bool) {
+	action := "copy_file"
+	if move {
+		action = "move_file"
+	}
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, action, "file", "", success, err, details)
+		}
+	}
+
+	userID := c.GetString("user_id")
+	overwrite := c.Query("overwrite") == "true"
+
+	var req CopyFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sourceKey, ok := s.userObjectKey(userID, req.SourceKey)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source_key"})
+		return
+	}
+	destKey, ok := s.userObjectKey(userID, req.DestKey)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dest_key"})
+		return
+	}
+	if sourceKey == destKey {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source_key and dest_key must differ"})
+		return
+	}
+
+	config, err := s.resolveConfig(userID, req.ConfigID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+
+	details := map[string]interface{}{
+		"source_key": req.SourceKey,
+		"dest_key":   req.DestKey,
+		"overwrite":  overwrite,
+	}
+
+	source, err := client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(config.BucketName),
+		Key:    aws.String(sourceKey),
+	})
+	if err != nil {
+		details["stage"] = "head_source"
+		logAudit(false, err, details)
+		if isObjectNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Source file not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read source file"})
+		return
+	}
+
+	if !overwrite {
+		_, err = client.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(config.BucketName),
+			Key:    aws.String(destKey),
+		})
+		if err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Destination already exists; pass overwrite=true to replace it"})
+			return
+		}
+		if !isObjectNotFound(err) {
+			details["stage"] = "head_dest"
+			logAudit(false, err, details)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check destination"})
+			return
+		}
+	}
+
+	// A copy adds the source's size (a move only changes the key)
+	size := aws.Int64Value(source.ContentLength)
+	if !move && !s.checkQuota(c, userID, size) {
+		return
+	}
+
+	// CopySource is "bucket/key" and must be URL-encoded
+	copySource := (&url.URL{Path: config.BucketName + "/" + sourceKey}).EscapedPath()
+	_, err = client.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(config.BucketName),
+		Key:        aws.String(destKey),
+		CopySource: aws.String(copySource),
+	})
+	if err != nil {
+		details["stage"] = "copy"
+		logAudit(false, err, details)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to copy file: " + err.Error()})
+		return
+	}
+	if overwrite {
+		// The size of the replaced destination is unknown
+		s.invalidateUsage(userID, config.ID)
+	} else if !move {
+		s.adjustUsage(userID, config.ID, size, 1)
+	}
+	s.copyObjectChecksum(config.ID, sourceKey, destKey, move)
+	// A moved file keeps its expiry; a copy is a new file without one
+	if move {
+		s.moveObjectExpiry(config.ID, sourceKey, destKey)
+	} else {
+		s.dropObjectExpiry(config.ID, destKey)
+	}
+
+	if move {
+		_, err = client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(config.BucketName),
+			Key:    aws.String(sourceKey),
+		})
+		if err != nil {
+			// The copy succeeded, so the file now exists in both places
+			s.adjustUsage(userID, config.ID, size, 1)
+			details["stage"] = "delete_source"
+			logAudit(false, err, details)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "File copied but failed to delete source: " + err.Error()})
+			return
+		}
+	}
+
+	logAudit(true, nil, details)
+	message := "File copied successfully"
+	if move {
+		message = "File moved successfully"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":    message,
+		"source_key": req.SourceKey,
+		"dest_key":   req.DestKey,
+	})
+}
+
+// MovePrefixRequest names a folder to rename, both prefixes relative to the user's prefix
+type MovePrefixRequest struct {
+	ConfigID     string `json:"config_id"`
+	SourcePrefix string `json:"source_prefix" binding:"required"`
+	DestPrefix   string `json:"dest_prefix" binding:"required"`
+}
+
+// MovePrefixResult reports one object that was, or in a dry run would be, moved
+type MovePrefixResult struct {
+	SourceKey string `json:"source_key"`
+	DestKey   string `json:"dest_key"`
+	Size      int64  `json:"size"`
+	Error     string `json:"error,omitempty"`
+}
+
+// folderPrefix validates a folder path relative to the user's prefix and
+// returns it and its full key, both ending in "/"
+func (s *S3Service) folderPrefix(userID, p string) (string, string, bool) {
+	if strings.HasPrefix(p, "/") || strings.Contains(p, "..") {
+		return "", "", false
+	}
+	folder := strings.TrimSuffix(p, "/")
+	fullKey, ok := s.userObjectKey(userID, folder)
+	if !ok {
+		return "", "", false
+	}
+	return folder + "/", fullKey + "/", true
+}
+
+// MovePrefix renames a folder by copying every object under the source prefix
+// to the destination prefix and deleting the originals. The listing is
+// processed a page at a time, so folders of any size are handled without
+// loading every key first; failures are reported per object and their sources
+// are left in place. dry_run=true lists what would be moved.
+func (s *S3Service) MovePrefix(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "move_prefix", "file", "", success, err, details)
+		}
+	}
+
+	userID := c.GetString("user_id")
+	overwrite := c.Query("overwrite") == "true"
+	dryRun := c.Query("dry_run") == "true"
+
+	var req MovePrefixRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sourcePrefix, sourceFull, ok := s.folderPrefix(userID, req.SourcePrefix)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source_prefix"})
+		return
+	}
+	destPrefix, destFull, ok := s.folderPrefix(userID, req.DestPrefix)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dest_prefix"})
+		return
+	}
+	if err := s.validateFilename(strings.TrimSuffix(destPrefix, "/")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_filename"})
+		return
+	}
+	// Moving a folder into itself would copy the copies as the listing proceeds
+	if strings.HasPrefix(destFull, sourceFull) || strings.HasPrefix(sourceFull, destFull) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source_prefix and dest_prefix must not contain each other"})
+		return
+	}
+
+	config, err := s.resolveConfig(userID, req.ConfigID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+	bucket := config.BucketName
+
+	var planned, failures []MovePrefixResult
+	var moved, failed int
+	var totalSize int64
+
+	// moveObject copies one object, reporting why it could not be
+	moveObject := func(sourceKey, destKey string) error {
+		if !overwrite {
+			_, err := client.HeadObject(&s3.HeadObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(destKey),
+			})
+			if err == nil {
+				return fmt.Errorf("destination already exists; pass overwrite=true to replace it")
+			}
+			if !isObjectNotFound(err) {
+				return err
+			}
+		}
+		// CopySource is "bucket/key" and must be URL-encoded
+		_, err := client.CopyObject(&s3.CopyObjectInput{
+			Bucket:     aws.String(bucket),
+			Key:        aws.String(destKey),
+			CopySource: aws.String((&url.URL{Path: bucket + "/" + sourceKey}).EscapedPath()),
+		})
+		if err == nil {
+			s.copyObjectChecksum(config.ID, sourceKey, destKey, true)
+			s.moveObjectExpiry(config.ID, sourceKey, destKey)
+		}
+		return err
+	}
+
+	err = client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(sourceFull),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		var copied []*s3.ObjectIdentifier
+		copiedResults := make(map[string]MovePrefixResult)
+		for _, obj := range page.Contents {
+			sourceKey := aws.StringValue(obj.Key)
+			destKey := destFull + strings.TrimPrefix(sourceKey, sourceFull)
+			result := MovePrefixResult{
+				SourceKey: sourcePrefix + strings.TrimPrefix(sourceKey, sourceFull),
+				DestKey:   destPrefix + strings.TrimPrefix(sourceKey, sourceFull),
+				Size:      aws.Int64Value(obj.Size),
+			}
+			totalSize += result.Size
+			if dryRun {
+				planned = append(planned, result)
+				continue
+			}
+			if err := moveObject(sourceKey, destKey); err != nil {
+				result.Error = err.Error()
+				failures = append(failures, result)
+				failed++
+				continue
+			}
+			copied = append(copied, &s3.ObjectIdentifier{Key: aws.String(sourceKey)})
+			copiedResults[sourceKey] = result
+		}
+		if len(copied) == 0 {
+			return true
+		}
+
+		// A listing page holds at most deleteObjectsChunkSize keys, so one call removes them all
+		output, err := deleteObjects(client, config.StorageType, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3.Delete{Objects: copied, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			// The copies exist, so these objects are now in both places
+			for _, obj := range copied {
+				result := copiedResults[aws.StringValue(obj.Key)]
+				result.Error = "copied but failed to delete source: " + err.Error()
+				failures = append(failures, result)
+			}
+			failed += len(copied)
+			return true
+		}
+		for _, e := range output.Errors {
+			result := copiedResults[aws.StringValue(e.Key)]
+			result.Error = "copied but failed to delete source: " + aws.StringValue(e.Code) + ": " + aws.StringValue(e.Message)
+			failures = append(failures, result)
+		}
+		failed += len(output.Errors)
+		moved += len(copied) - len(output.Errors)
+		return true
+	})
+	if err != nil && !dryRun {
+		// Objects already moved stay moved; report them along with the listing failure
+		logAudit(false, err, map[string]interface{}{
+			"stage":         "list",
+			"source_prefix": sourcePrefix,
+			"dest_prefix":   destPrefix,
+			"moved":         moved,
+			"failed":        failed,
+		})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to list folder: " + err.Error(),
+			"moved":  moved,
+			"failed": failed,
+			"errors": failures,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list folder: " + err.Error()})
+		return
+	}
+
+	if dryRun {
+		if planned == nil {
+			planned = []MovePrefixResult{}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"dry_run":       true,
+			"source_prefix": sourcePrefix,
+			"dest_prefix":   destPrefix,
+			"objects":       planned,
+			"count":         len(planned),
+			"total_size":    totalSize,
+		})
+		return
+	}
+	if moved == 0 && failed == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source folder is empty or does not exist"})
+		return
+	}
+
+	details := map[string]interface{}{
+		"source_prefix": sourcePrefix,
+		"dest_prefix":   destPrefix,
+		"overwrite":     overwrite,
+		"moved":         moved,
+		"failed":        failed,
+		"total_size":    totalSize,
+		"config_id":     config.ID,
+	}
+	if failed > 0 {
+		logAudit(false, fmt.Errorf("%d of %d objects failed to move", failed, moved+failed), details)
+	} else {
+		logAudit(true, nil, details)
+	}
+	if failures == nil {
+		failures = []MovePrefixResult{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"source_prefix": sourcePrefix,
+		"dest_prefix":   destPrefix,
+		"moved":         moved,
+		"failed":        failed,
+		"errors":        failures,
+	})
+}
+
+// maxDeletePreviewKeys bounds the number of explicit keys in one preview request
+const maxDeletePreviewKeys = 1000
+
+// DeletePreviewRequest selects objects by explicit keys and/or a prefix
+type DeletePreviewRequest struct {
+	ConfigID string   `json:"config_id"`
+	Keys     []string `json:"keys"`
+	Prefix   string   `json:"prefix"`
+}
+
+// DeletionPreviewItem is one object that a delete would remove
+type DeletionPreviewItem struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+// DeletionPreview describes the effect of a delete without performing it
+type DeletionPreview struct {
+	DryRun    bool                  `json:"dry_run"`
+	Objects   []DeletionPreviewItem `json:"objects"`
+	Missing   []string              `json:"missing,omitempty"`
+	Count     int                   `json:"count"`
+	TotalSize int64                 `json:"total_size"`
+}
+
+// isObjectNotFound reports whether err means the object (or version) does not exist
+func isObjectNotFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound", "NoSuchVersion":
+			return true
+		case s3.ErrCodeNoSuchBucket:
+			return false
+		}
+	}
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	return false
+}
+
+// isInvalidRange reports whether err means the requested byte range lies outside the object
+func isInvalidRange(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidRange" {
+		return true
+	}
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusRequestedRangeNotSatisfiable {
+		return true
+	}
+	return false
+}
+
+// previewDeletion resolves keys (relative to userPrefix) and everything under
+// prefix into the objects a delete would remove, along with their total size.
+// Keys that don't exist are reported as missing.
+func previewDeletion(client *s3.S3, bucket, userPrefix string, keys []string, prefix string) (*DeletionPreview, error) {
+	preview := &DeletionPreview{DryRun: true, Objects: []DeletionPreviewItem{}}
+	seen := make(map[string]bool)
+	add := func(key string, size int64) {
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		preview.Objects = append(preview.Objects, DeletionPreviewItem{Key: key, Size: size})
+		preview.TotalSize += size
+	}
+
+	for _, key := range keys {
+		head, err := client.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(userPrefix + key),
+		})
+		if err != nil {
+			if isObjectNotFound(err) {
+				preview.Missing = append(preview.Missing, key)
+				continue
+			}
+			return nil, err
+		}
+		add(key, aws.Int64Value(head.ContentLength))
+	}
+
+	if prefix != "" {
+		err := client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(userPrefix + prefix),
+		}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, obj := range page.Contents {
+				add(strings.TrimPrefix(aws.StringValue(obj.Key), userPrefix), aws.Int64Value(obj.Size))
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	preview.Count = len(preview.Objects)
+	return preview, nil
+}
+
+// PreviewDelete lists the objects that deleting the given keys and/or prefix
+// would remove, with their total size, without deleting anything
+func (s *S3Service) PreviewDelete(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req DeletePreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Keys) == 0 && req.Prefix == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "keys or prefix is required"})
+		return
+	}
+	if len(req.Keys) > maxDeletePreviewKeys {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d keys are allowed per request", maxDeletePreviewKeys)})
+		return
+	}
+	for _, key := range req.Keys {
+		if _, ok := s.userObjectKey(userID, key); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key: " + key})
+			return
+		}
+	}
+	if req.Prefix != "" {
+		if _, ok := s.userObjectKey(userID, strings.TrimSuffix(req.Prefix, "/")); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prefix: " + req.Prefix})
+			return
+		}
+	}
+
+	config, err := s.resolveConfig(userID, req.ConfigID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+	userPrefix := s.userPrefix(userID)
+
+	preview, err := previewDeletion(client, config.BucketName, userPrefix, req.Keys, req.Prefix)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to preview deletion: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, preview)
+}
+
+const (
+	// deleteObjectsChunkSize is the most keys S3 accepts in one DeleteObjects call
+	deleteObjectsChunkSize = 1000
+	// maxBatchDeleteKeys bounds the number of keys in one batch delete request
+	maxBatchDeleteKeys = 10000
+)
+
+// BatchDeleteRequest lists keys (relative to the user's prefix) to delete
+type BatchDeleteRequest struct {
+	ConfigID string   `json:"config_id"`
+	Keys     []string `json:"keys"`
+}
+
+// BatchDeleteResult is the outcome for one key of a batch delete
+type BatchDeleteResult struct {
+	Key      string `json:"key"`
+	Deleted  bool   `json:"deleted"`
+	NotFound bool   `json:"not_found,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// existenceCheckConcurrency bounds the HeadObject calls made in parallel by missingObjects
+const existenceCheckConcurrency = 16
+
+// deleteObjects runs a multi-object delete, or one DeleteObject per key on
+// GCS, whose XML API has no multi-object delete. Per-key failures are
+// reported in the output's Errors either way.
+func deleteObjects(client *s3.S3, storageType string, input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+	if storageType != "gcs" {
+		return client.DeleteObjects(input)
+	}
+	output := &s3.DeleteObjectsOutput{}
+	for _, obj := range input.Delete.Objects {
+		_, err := client.DeleteObject(&s3.DeleteObjectInput{Bucket: input.Bucket, Key: obj.Key})
+		if err == nil || isObjectNotFound(err) {
+			output.Deleted = append(output.Deleted, &s3.DeletedObject{Key: obj.Key})
+			continue
+		}
+		code := "InternalError"
+		if aerr, ok := err.(awserr.Error); ok {
+			code = aerr.Code()
+		}
+		output.Errors = append(output.Errors, &s3.Error{Key: obj.Key, Code: aws.String(code), Message: aws.String(err.Error())})
+	}
+	return output, nil
+}
+
+// missingObjects returns the subset of fullKeys that do not exist. Keys whose
+// check fails for another reason are assumed to exist so the delete itself
+// reports the error.
+func missingObjects(client *s3.S3, bucket string, fullKeys []string) map[string]bool {
+	missing := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, existenceCheckConcurrency)
+	for _, fullKey := range fullKeys {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(fullKey string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			_, err := client.HeadObject(&s3.HeadObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(fullKey),
+			})
+			if isObjectNotFound(err) {
+				mu.Lock()
+				missing[fullKey] = true
+				mu.Unlock()
+			}
+		}(fullKey)
+	}
+	wg.Wait()
+	return missing
+}
+
+// BatchDeleteFiles deletes several files with DeleteObjects and reports the
+// result for each key. dry_run=true returns a deletion preview instead.
+func (s *S3Service) BatchDeleteFiles(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "batch_delete_files", "file", "", success, err, details)
+		}
+	}
+
+	userID := c.GetString("user_id")
+
+	var req BatchDeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Keys) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one key is required"})
+		return
+	}
+	if len(req.Keys) > maxBatchDeleteKeys {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d keys are allowed per request", maxBatchDeleteKeys)})
+		return
+	}
+
+	// Validate every key before deleting anything, dropping duplicates
+	var keys []string
+	fullKeys := make(map[string]string, len(req.Keys))
+	for _, key := range req.Keys {
+		fullKey, ok := s.userObjectKey(userID, key)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key: " + key})
+			return
+		}
+		if _, dup := fullKeys[key]; dup {
+			continue
+		}
+		fullKeys[key] = fullKey
+		keys = append(keys, key)
+	}
+
+	config, err := s.resolveConfig(userID, req.ConfigID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+	userPrefix := s.userPrefix(userID)
+
+	if c.Query("dry_run") == "true" {
+		preview, err := previewDeletion(client, config.BucketName, userPrefix, keys, "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to preview deletion: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, preview)
+		return
+	}
+
+	results := make([]BatchDeleteResult, 0, len(keys))
+	succeeded, failed, notFound := 0, 0, 0
+	for start := 0; start < len(keys); start += deleteObjectsChunkSize {
+		end := start + deleteObjectsChunkSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		// DeleteObjects reports missing keys as deleted, so they are found and skipped first
+		chunkFullKeys := make([]string, 0, end-start)
+		for _, key := range keys[start:end] {
+			chunkFullKeys = append(chunkFullKeys, fullKeys[key])
+		}
+		missing := missingObjects(client, config.BucketName, chunkFullKeys)
+
+		objects := make([]*s3.ObjectIdentifier, 0, len(chunkFullKeys))
+		for _, fullKey := range chunkFullKeys {
+			if !missing[fullKey] {
+				objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(fullKey)})
+			}
+		}
+		var deleteErr error
+		chunkErrors := make(map[string]string)
+		if len(objects) > 0 {
+			output, err := deleteObjects(client, config.StorageType, &s3.DeleteObjectsInput{
+				Bucket: aws.String(config.BucketName),
+				Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+			})
+			if err != nil {
+				// The whole call failed, so none of this chunk was deleted
+				deleteErr = err
+			} else {
+				// Quiet mode only reports failures; every other key was deleted
+				for _, e := range output.Errors {
+					chunkErrors[aws.StringValue(e.Key)] = aws.StringValue(e.Code) + ": " + aws.StringValue(e.Message)
+				}
+			}
+		}
+
+		for _, key := range keys[start:end] {
+			fullKey := fullKeys[key]
+			if missing[fullKey] {
+				results = append(results, BatchDeleteResult{Key: key, NotFound: true, Error: "File not found"})
+				notFound++
+			} else if deleteErr != nil {
+				results = append(results, BatchDeleteResult{Key: key, Error: deleteErr.Error()})
+				failed++
+			} else if msg, ok := chunkErrors[fullKey]; ok {
+				results = append(results, BatchDeleteResult{Key: key, Error: msg})
+				failed++
+			} else {
+				s.clearObjectChecksum(config.ID, fullKey)
+				s.dropObjectExpiry(config.ID, fullKey)
+				results = append(results, BatchDeleteResult{Key: key, Deleted: true})
+				succeeded++
+			}
+		}
+	}
+
+	details := map[string]interface{}{
+		"count":     len(keys),
+		"succeeded": succeeded,
+		"failed":    failed,
+		"not_found": notFound,
+		"config_id": config.ID,
+	}
+	if succeeded > 0 {
+		// DeleteObjects does not report sizes, so the total is recomputed on next use
+		s.invalidateUsage(userID, config.ID)
+	}
+	if failed > 0 {
+		logAudit(false, fmt.Errorf("%d of %d deletions failed", failed, len(keys)), details)
+	} else {
+		logAudit(true, nil, details)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"results":   results,
+		"succeeded": succeeded,
+		"failed":    failed,
+		"not_found": notFound,
+	})
+}
+
+// redactedSecret replaces credentials in config exports made without include_secrets
+const redactedSecret = "[REDACTED]"
+
+// redactConfigSecrets returns cfg with its secret key and extra header values
+// (which may carry credentials) replaced by redactedSecret
+func redactConfigSecrets(cfg S3Config) S3Config {
+	cfg.SecretKey = redactedSecret
+	if len(cfg.ExtraHeaders) > 0 {
+		headers := make(map[string]string, len(cfg.ExtraHeaders))
+		for name := range cfg.ExtraHeaders {
+			headers[name] = redactedSecret
+		}
+		cfg.ExtraHeaders = headers
 	}
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Configuration not found"})
-		return
+	return cfg
+}
+
+// restoreConfigSecrets fills the redacted secrets of an imported config from
+// the stored one, so a redacted export can be imported back. It returns false
+// when secrets are redacted but there is no stored config to take them from.
+func restoreConfigSecrets(cfg S3Config, existing *S3Config) (S3Config, bool) {
+	redacted := cfg.SecretKey == redactedSecret
+	for _, value := range cfg.ExtraHeaders {
+		redacted = redacted || value == redactedSecret
 	}
-	client := s.createS3Client(*config)
-	if client == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
-		return
+	if !redacted {
+		return cfg, true
 	}
-	userPrefix := fmt.Sprintf("users/%s/", userID)
-	fullKey := userPrefix + key
-	_, err = client.DeleteObject(&s3.DeleteObjectInput{
-		Bucket: aws.String(config.BucketName),
-		Key:    aws.String(fullKey),
-	})
-	if err != nil {
-		logAudit(false, err, map[string]interface{}{
-			"filename": key,
-			"full_key": fullKey,
-		})
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file: " + err.Error()})
-		return
+	if existing == nil {
+		return cfg, false
 	}
-	logAudit(true, nil, map[string]interface{}{
-		"filename": key,
-		"full_key": fullKey,
-	})
-	c.JSON(http.StatusOK, gin.H{"message": "File deleted successfully"})
+	if cfg.SecretKey == redactedSecret {
+		cfg.SecretKey = existing.SecretKey
+	}
+	for name, value := range cfg.ExtraHeaders {
+		if value == redactedSecret {
+			cfg.ExtraHeaders[name] = existing.ExtraHeaders[name]
+		}
+	}
+	return cfg, true
 }
 
+// confirmAdminPassword checks the X-Confirm-Password header against the
+// calling admin's password, for requests that release credentials
+func (s *S3Service) confirmAdminPassword(c *gin.Context) bool {
+	password := c.GetHeader("X-Confirm-Password")
+	if password == "" {
+		return false
+	}
+	admin, err := s.getUser(c.GetString("username"))
+	return err == nil && users.CheckPasswordHash(password, admin.Password)
+}
 
-// ExportConfigsHandler returns all configs as CSV or JSON (admin only)
+// ExportConfigsHandler returns all configs as CSV or JSON (admin only). Secret
+// keys are redacted unless include_secrets=true is confirmed with the admin's
+// password in the X-Confirm-Password header.
 func (s *S3Service) ExportConfigsHandler(c *gin.Context) {
 	// Audit logging helper
 	logAudit := func(success bool, err error, details map[string]interface{}) {
@@ -613,46 +3326,86 @@ func (s *S3Service) ExportConfigsHandler(c *gin.Context) {
 	}()
 
 	format := c.DefaultQuery("format", "csv")
-	var configs []S3Config
-	// For admin: get all configs for all users
-	err := s.db.View(func(txn *badger.Txn) error {
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
-		prefix := []byte("config:")
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			item := it.Item()
-			err := item.Value(func(val []byte) error {
-				var cfg S3Config
-				if err := json.Unmarshal(val, &cfg); err != nil {
-					return err
-				}
-				configs = append(configs, cfg)
-				return nil
+	filterUserID := c.Query("user_id")
+	filterStorageType := c.Query("storage_type")
+	filters := map[string]interface{}{"user_id": filterUserID, "storage_type": filterStorageType}
+
+	includeSecrets := c.Query("include_secrets") == "true"
+	if includeSecrets {
+		if !s.confirmAdminPassword(c) {
+			logAudit(false, errors.New("secret export not confirmed"), map[string]interface{}{"stage": "confirm_secrets", "include_secrets": true})
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Exporting secrets requires your password in the X-Confirm-Password header",
+				"code":  "confirmation_required",
 			})
-			if err != nil {
-				return err
-			}
+			return
 		}
-		return nil
-	})
-	if err != nil {
-		logAudit(false, err, map[string]interface{}{"stage": "get_configs"})
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get configs"})
-		return
+		// Recorded as its own action so cleartext credential exports stand out in the audit log
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "export_config_secrets", "config", "", true, nil, map[string]interface{}{"format": format, "filters": filters})
+		}
+	}
+	exportView := func(cfg S3Config) S3Config {
+		if includeSecrets {
+			return cfg
+		}
+		return redactConfigSecrets(cfg)
 	}
+
+	// For admin: get all configs for all users (or only the requested user)
+	prefix := []byte("user_config_")
+	if filterUserID != "" {
+		prefix = []byte(fmt.Sprintf("user_config_%s_", filterUserID))
+	}
+	matches := func(cfg S3Config) bool {
+		if filterUserID != "" && cfg.UserID != filterUserID {
+			return false
+		}
+		if filterStorageType != "" && cfg.StorageType != filterStorageType {
+			return false
+		}
+		return canAccessOrg(c, cfg.OrgID)
+	}
+
 	if format == "json" {
-		logAudit(true, nil, map[string]interface{}{"format": format, "count": len(configs)})
+		var configs []S3Config
+		err := s.forEachConfig(prefix, func(cfg S3Config) error {
+			if matches(cfg) {
+				configs = append(configs, exportView(cfg))
+			}
+			return nil
+		})
+		if err != nil {
+			logAudit(false, err, map[string]interface{}{"stage": "get_configs"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get configs"})
+			return
+		}
 		c.Header("Content-Disposition", "attachment; filename=configs.json")
 		c.JSON(http.StatusOK, configs)
+		logAudit(true, nil, map[string]interface{}{"format": format, "count": len(configs), "filters": filters, "include_secrets": includeSecrets, "bytes": c.Writer.Size()})
 		return
 	}
-	// Default: CSV
+	// Default: CSV, streamed row by row as configs are scanned
 	c.Header("Content-Disposition", "attachment; filename=configs.csv")
 	c.Header("Content-Type", "text/csv")
-	w := csv.NewWriter(c.Writer)
-	defer w.Flush()
-	w.Write([]string{"id", "user_id", "name", "access_key", "secret_key", "region", "bucket_name", "endpoint_url", "use_ssl", "storage_type", "is_default", "created_at", "updated_at"})
-	for _, cfg := range configs {
+	// Fields are escaped so the file is safe to open in a spreadsheet
+	w := response.NewCSVWriter(c.Writer)
+	w.Write(configCSVColumns)
+	count := 0
+	err := s.forEachConfig(prefix, func(cfg S3Config) error {
+		if !matches(cfg) {
+			return nil
+		}
+		cfg = exportView(cfg)
+		// Headers are a JSON object in one column
+		var extraHeaders string
+		if len(cfg.ExtraHeaders) > 0 {
+			data, err := json.Marshal(cfg.ExtraHeaders)
+			if err != nil {
+				return err
+			}
+			extraHeaders = string(data)
+		}
 		w.Write([]string{
 			cfg.ID,
 			cfg.UserID,
@@ -667,9 +3420,128 @@ func (s *S3Service) ExportConfigsHandler(c *gin.Context) {
 			fmt.Sprintf("%v", cfg.IsDefault),
 			cfg.CreatedAt,
 			cfg.UpdatedAt,
+			cfg.OrgID,
+			fmt.Sprintf("%v", cfg.Disabled),
+			extraHeaders,
+			cfg.DefaultSSE,
+			cfg.DefaultSSEKMSKeyID,
+			strconv.Itoa(cfg.TimeoutSeconds),
+			cfg.Provider,
+			fmt.Sprintf("%v", cfg.PathStyle),
 		})
+		count++
+		if count%exportFlushEvery == 0 {
+			w.Flush()
+			c.Writer.Flush()
+		}
+		return w.Error()
+	})
+	w.Flush()
+	if err != nil {
+		// Rows may already be sent, so the failure can only be audited
+		logAudit(false, err, map[string]interface{}{"stage": "stream_csv", "count": count, "filters": filters, "bytes": c.Writer.Size()})
+		return
+	}
+	logAudit(true, nil, map[string]interface{}{"format": format, "count": count, "filters": filters, "include_secrets": includeSecrets, "bytes": c.Writer.Size()})
+}
+
+// configCSVColumns are the columns of a config CSV export, in order. Imports
+// find columns by their header, so an export made before a column was added
+// still imports and keeps the stored value of every column it lacks.
+var configCSVColumns = []string{
+	"id", "user_id", "name", "access_key", "secret_key", "region", "bucket_name", "endpoint_url",
+	"use_ssl", "storage_type", "is_default", "created_at", "updated_at", "org_id",
+	"disabled", "extra_headers", "default_sse", "default_sse_kms_key_id", "timeout_seconds", "provider", "path_style",
+}
+
+// parseConfigCSVRow builds a config from one CSV row. columns maps header
+// names to their index; missing columns are left at their zero value.
+func parseConfigCSVRow(rec []string, columns map[string]int) (S3Config, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return rec[i]
+		}
+		return ""
+	}
+	cfg := S3Config{
+		ID: field("id"), UserID: field("user_id"), Name: field("name"), AccessKey: field("access_key"), SecretKey: field("secret_key"),
+		Region: field("region"), BucketName: field("bucket_name"), EndpointURL: field("endpoint_url"),
+		UseSSL: field("use_ssl") == "true", StorageType: field("storage_type"), IsDefault: field("is_default") == "true",
+		CreatedAt: field("created_at"), UpdatedAt: field("updated_at"), OrgID: field("org_id"),
+		Disabled: field("disabled") == "true", DefaultSSE: field("default_sse"), DefaultSSEKMSKeyID: field("default_sse_kms_key_id"),
+		Provider: field("provider"), PathStyle: field("path_style") == "true",
+	}
+	if raw := field("extra_headers"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &cfg.ExtraHeaders); err != nil {
+			return cfg, fmt.Errorf("extra_headers must be a JSON object of header names to values")
+		}
+	}
+	if raw := field("timeout_seconds"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil {
+			return cfg, fmt.Errorf("timeout_seconds must be a whole number")
+		}
+		cfg.TimeoutSeconds = seconds
+	}
+	return cfg, nil
+}
+
+// fillMissingConfigColumns copies the settings an imported CSV has no column
+// for from the stored config, so importing an older export does not reset them
+func fillMissingConfigColumns(cfg S3Config, existing *S3Config, columns map[string]int) S3Config {
+	missing := func(name string) bool {
+		_, ok := columns[name]
+		return !ok
+	}
+	if missing("org_id") {
+		cfg.OrgID = existing.OrgID
+	}
+	if missing("disabled") {
+		cfg.Disabled = existing.Disabled
+	}
+	if missing("extra_headers") {
+		cfg.ExtraHeaders = existing.ExtraHeaders
+	}
+	if missing("default_sse") {
+		cfg.DefaultSSE = existing.DefaultSSE
 	}
-	logAudit(true, nil, map[string]interface{}{"format": format, "count": len(configs)})
+	if missing("default_sse_kms_key_id") {
+		cfg.DefaultSSEKMSKeyID = existing.DefaultSSEKMSKeyID
+	}
+	if missing("timeout_seconds") {
+		cfg.TimeoutSeconds = existing.TimeoutSeconds
+	}
+	if missing("provider") {
+		cfg.Provider = existing.Provider
+	}
+	if missing("path_style") {
+		cfg.PathStyle = existing.PathStyle
+	}
+	return cfg
+}
+
+// exportFlushEvery is how many CSV rows are buffered before flushing a streamed export
+const exportFlushEvery = 100
+
+// forEachConfig calls fn for every stored config whose key starts with prefix
+func (s *S3Service) forEachConfig(prefix []byte, fn func(S3Config) error) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var cfg S3Config
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &cfg)
+			})
+			if err != nil {
+				return err
+			}
+			if err := fn(cfg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 // ImportConfigsHandler accepts CSV or JSON and creates/updates configs (admin only)
@@ -693,6 +3565,8 @@ func (s *S3Service) ImportConfigsHandler(c *gin.Context) {
 	}
 	defer file.Close()
 	var configs []S3Config
+	var csvColumns map[string]int      // CSV header name -> column; nil for JSON
+	parseErrors := make(map[int]error) // Config index -> why its CSV row could not be read
 	if format == "json" {
 		dec := json.NewDecoder(file)
 		if err := dec.Decode(&configs); err != nil {
@@ -708,30 +3582,132 @@ func (s *S3Service) ImportConfigsHandler(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV"})
 			return
 		}
-		for i, rec := range records {
-			if i == 0 {
-				continue
-			}
-			if len(rec) < 13 {
-				continue
+		// Undo the formula escaping applied on export
+		response.CSVUnescapeAll(records)
+		csvColumns = make(map[string]int, len(records[0]))
+		for i, name := range records[0] {
+			csvColumns[strings.TrimSpace(name)] = i
+		}
+		if _, ok := csvColumns["id"]; !ok {
+			logAudit(false, errors.New("missing id column"), map[string]interface{}{"stage": "decode_csv"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV: the header row must name the columns, including id and user_id"})
+			return
+		}
+		for _, rec := range records[1:] {
+			cfg, err := parseConfigCSVRow(rec, csvColumns)
+			if err != nil {
+				parseErrors[len(configs)] = err
 			}
-			configs = append(configs, S3Config{
-				ID: rec[0], UserID: rec[1], Name: rec[2], AccessKey: rec[3], SecretKey: rec[4],
-				Region: rec[5], BucketName: rec[6], EndpointURL: rec[7],
-				UseSSL: rec[8] == "true", StorageType: rec[9], IsDefault: rec[10] == "true",
-				CreatedAt: rec[11], UpdatedAt: rec[12],
-			})
+			configs = append(configs, cfg)
 		}
 	}
-	// Save configs (create or update)
-	for _, cfg := range configs {
-		cfgData, _ := json.Marshal(cfg)
-		s.db.Update(func(txn *badger.Txn) error {
-			return txn.Set([]byte("config:"+cfg.ID), cfgData)
+	// Save configs (create or update), rejecting rows that would be orphaned
+	// or would collide with another user's config
+	var rowErrors []ConfigImportError
+	imported := 0
+	seen := make(map[string]bool)
+	for i, cfg := range configs {
+		rowError := func(msg string) {
+			rowErrors = append(rowErrors, ConfigImportError{Row: i + 1, ConfigID: cfg.ID, UserID: cfg.UserID, Error: msg})
+		}
+		if err := parseErrors[i]; err != nil {
+			rowError(err.Error())
+			continue
+		}
+		if cfg.ID == "" || cfg.UserID == "" {
+			rowError("id and user_id are required")
+			continue
+		}
+		user, err := s.getUser(cfg.UserID)
+		if err != nil {
+			rowError("user does not exist")
+			continue
+		}
+		if !canAccessOrg(c, user.OrgID) {
+			rowError("user belongs to another organization")
+			continue
+		}
+		userKey := cfg.UserID + "/" + cfg.ID
+		if seen[userKey] {
+			rowError("duplicate config id for this user in import")
+			continue
+		}
+		seen[userKey] = true
+		existing, err := s.findConfigByID(cfg.ID)
+		if err == nil && existing.UserID != cfg.UserID {
+			rowError("config id already belongs to another user")
+			continue
+		}
+		// Older CSV exports lack some columns; keep the stored values for those
+		if existing != nil && csvColumns != nil {
+			cfg = fillMissingConfigColumns(cfg, existing, csvColumns)
+		}
+		var ok bool
+		if cfg, ok = restoreConfigSecrets(cfg, existing); !ok {
+			rowError("secrets are redacted; export with include_secrets=true to import new configs")
+			continue
+		}
+		if err := validateExtraHeaders(cfg.ExtraHeaders); err != nil {
+			rowError(err.Error())
+			continue
+		}
+		if err := validateSSE(cfg.DefaultSSE, cfg.DefaultSSEKMSKeyID); err != nil {
+			rowError(err.Error())
+			continue
+		}
+		if err := validateTimeout(cfg.TimeoutSeconds); err != nil {
+			rowError(err.Error())
+			continue
+		}
+		// Same endpoint and provider checks as creating a config; the imported
+		// use_ssl only fills in a scheme the endpoint lacks
+		if err := normalizeConfigEndpoint(&cfg, nil); err != nil {
+			rowError(err.Error())
+			continue
+		}
+
+		if !c.GetBool("is_super_admin") {
+			cfg.OrgID = c.GetString("org_id")
+		}
+		if err := s.saveConfig(cfg); err != nil {
+			rowError("failed to save configuration")
+			continue
+		}
+		s.health.reset(cfg.ID)
+		imported++
+	}
+	logAudit(len(rowErrors) == 0, nil, map[string]interface{}{"format": format, "count": imported, "rejected": len(rowErrors)})
+	c.JSON(http.StatusOK, gin.H{
+		"message":  fmt.Sprintf("Imported %d configs", imported),
+		"imported": imported,
+		"errors":   rowErrors,
+	})
+}
+
+// ConfigImportError describes an import row that was rejected
+type ConfigImportError struct {
+	Row      int    `json:"row"`
+	ConfigID string `json:"config_id"`
+	UserID   string `json:"user_id"`
+	Error    string `json:"error"`
+}
+
+// getUser loads the user that owns configs stored under userID
+func (s *S3Service) getUser(userID string) (*User, error) {
+	var user User
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("user:" + userID))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &user)
 		})
+	})
+	if err != nil {
+		return nil, err
 	}
-	logAudit(true, nil, map[string]interface{}{"format": format, "count": len(configs)})
-	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Imported %d configs", len(configs))})
+	return &user, nil
 }
 
 // GetConfigs returns a list of configs with redacted secrets
@@ -742,24 +3718,94 @@ func (s *S3Service) GetConfigs(c *gin.Context) {
 		c.JSON(500, gin.H{"error": "Failed to get configurations"})
 		return
 	}
+
+	// Optional case-insensitive name filter
+	if name := strings.ToLower(c.Query("name")); name != "" {
+		var filtered []S3Config
+		for _, config := range configs {
+			if strings.Contains(strings.ToLower(config.Name), name) {
+				filtered = append(filtered, config)
+			}
+		}
+		configs = filtered
+	}
+	total := len(configs)
+
+	// Without page parameters every config is returned, as before
+	page := 1
+	pageSize := total
+	if c.Query("page") != "" || c.Query("page_size") != "" {
+		pageSize = 10
+		if p := c.Query("page"); p != "" {
+			fmt.Sscanf(p, "%d", &page)
+		}
+		if ps := c.Query("page_size"); ps != "" {
+			fmt.Sscanf(ps, "%d", &pageSize)
+		}
+		if page < 1 {
+			page = 1
+		}
+		if pageSize < 1 || pageSize > maxPageSize {
+			pageSize = 10
+		}
+		start, end := response.Bounds(total, page, pageSize)
+		configs = configs[start:end]
+	}
+
 	var safeConfigs []map[string]interface{}
 	for _, config := range configs {
-		safeConfig := map[string]interface{}{
-			"id":           config.ID,
-			"name":         config.Name,
-			"region":       config.Region,
-			"bucket_name":  config.BucketName,
-			"access_key":   config.AccessKey[:min(4, len(config.AccessKey))] + "****",
-			"endpoint_url": config.EndpointURL,
-			"use_ssl":      config.UseSSL,
-			"storage_type": config.StorageType,
-			"is_default":   config.IsDefault,
-			"created_at":   config.CreatedAt,
-			"updated_at":   config.UpdatedAt,
-		}
-		safeConfigs = append(safeConfigs, safeConfig)
+		safeConfigs = append(safeConfigs, redactConfig(config))
+	}
+	response.List(c, "configurations", safeConfigs, response.Pagination{Page: page, PageSize: pageSize, Total: total}, nil)
+}
+
+// GetDefaultConfig returns the user's default config with redacted secrets
+func (s *S3Service) GetDefaultConfig(c *gin.Context) {
+	userID := c.GetString("user_id")
+	config, err := s.getDefaultConfig(userID)
+	if err == errNoConfigurations {
+		c.JSON(404, noConfigurationsResponse)
+		return
+	}
+	if err != nil {
+		c.JSON(404, gin.H{"error": "No default configuration found"})
+		return
+	}
+	c.JSON(200, gin.H{"configuration": redactConfig(*config)})
+}
+
+// redactConfig returns the client-safe view of a config without its secret key
+func redactConfig(config S3Config) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              config.ID,
+		"name":            config.Name,
+		"region":          config.Region,
+		"bucket_name":     config.BucketName,
+		"access_key":      config.AccessKey[:min(4, len(config.AccessKey))] + "****",
+		"endpoint_url":    config.EndpointURL,
+		"use_ssl":         config.UseSSL,
+		"storage_type":    config.StorageType,
+		"is_default":      config.IsDefault,
+		"disabled":        config.Disabled,
+		"version":         config.Version,
+		"extra_headers":   extraHeaderNames(config.ExtraHeaders),
+		"default_sse":     config.DefaultSSE,
+		"timeout_seconds": config.TimeoutSeconds,
+		"provider":        config.Provider,
+		"path_style":      config.PathStyle,
+		"created_at":      config.CreatedAt,
+		"updated_at":      config.UpdatedAt,
+	}
+}
+
+// extraHeaderNames lists header names only, since values may carry credentials
+func extraHeaderNames(headers map[string]string) []string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
 	}
-	c.JSON(200, gin.H{"configurations": safeConfigs})
+	sort.Strings(names)
+	return names
 }
 
 // GetConfigByID returns the full config including secret_key if the user is owner or admin
@@ -776,21 +3822,45 @@ func (s *S3Service) GetConfigByID(c *gin.Context) {
 		c.JSON(403, gin.H{"error": "Forbidden"})
 		return
 	}
+	c.Header("ETag", fmt.Sprintf(`"%d"`, config.Version))
 	c.JSON(200, config)
 }
 
 func (s *S3Service) CreateConfig(c *gin.Context) {
 	userID := c.GetString("user_id")
 
-	var config S3Config
-	if err := c.ShouldBindJSON(&config); err != nil {
+	// UseSSL shadows the embedded field so an omitted use_ssl can be told apart from false
+	var createRequest struct {
+		S3Config
+		UseSSL *bool `json:"use_ssl"`
+	}
+	if err := c.ShouldBindJSON(&createRequest); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid configuration data"})
 		return
 	}
+	config := createRequest.S3Config
+	if err := normalizeConfigEndpoint(&config, createRequest.UseSSL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := validateExtraHeaders(config.ExtraHeaders); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateSSE(config.DefaultSSE, config.DefaultSSEKMSKeyID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateTimeout(config.TimeoutSeconds); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Generate ID and set user
 	config.ID = s.generateConfigID()
 	config.UserID = userID
+	config.OrgID = c.GetString("org_id")
 
 	// Validate configuration by testing connection
 	client := s.createS3Client(config)
@@ -835,17 +3905,62 @@ func (s *S3Service) UpdateConfig(c *gin.Context) {
 		return
 	}
 
-	var updateData S3Config
-	if err := c.ShouldBindJSON(&updateData); err != nil {
+	// The request embeds the config plus the version the client last read
+	var updateRequest struct {
+		S3Config
+		Version *int64 `json:"version"`
+		UseSSL  *bool  `json:"use_ssl"`
+	}
+	if err := c.ShouldBindJSON(&updateRequest); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid configuration data"})
 		return
 	}
+	updateData := updateRequest.S3Config
+	if err := normalizeConfigEndpoint(&updateData, updateRequest.UseSSL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateExtraHeaders(updateData.ExtraHeaders); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateSSE(updateData.DefaultSSE, updateData.DefaultSSEKMSKeyID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateTimeout(updateData.TimeoutSeconds); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Expected version comes from If-Match (ETag) or the body's version field
+	var expectedVersion int64
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+		if _, err := fmt.Sscanf(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`), "%d", &expectedVersion); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid If-Match header"})
+			return
+		}
+	} else if updateRequest.Version != nil {
+		expectedVersion = *updateRequest.Version
+	} else {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "version (or If-Match header) is required"})
+		return
+	}
+	if expectedVersion != existingConfig.Version {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Configuration was modified by another request",
+			"version": existingConfig.Version,
+		})
+		return
+	}
 
 	// Preserve ID, UserID, and timestamps
 	updateData.ID = existingConfig.ID
 	updateData.UserID = existingConfig.UserID
 	updateData.CreatedAt = existingConfig.CreatedAt
 	updateData.IsDefault = existingConfig.IsDefault
+	updateData.OrgID = existingConfig.OrgID
+	updateData.Disabled = existingConfig.Disabled
 
 	// Validate configuration
 	client := s.createS3Client(updateData)
@@ -863,51 +3978,25 @@ func (s *S3Service) UpdateConfig(c *gin.Context) {
 		return
 	}
 
-	if err := s.saveConfig(updateData); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update configuration"})
-		return
-	}
-	userID = c.GetString("user_id")
-	configID = c.Param("id")
-
-	config, err := s.getConfigByID(userID, configID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Configuration not found"})
+	newVersion, err := s.saveConfigIfVersion(updateData, expectedVersion)
+	if err == errConfigVersionConflict {
+		c.JSON(http.StatusConflict, gin.H{"error": "Configuration was modified by another request"})
 		return
 	}
-
-	// Check if there are other configs
-	configs, err := s.getUserConfigs(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check configurations"})
-		return
-	}
-
-	if len(configs) <= 1 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete the last configuration"})
-		return
-	}
-
-	if err := s.deleteConfig(userID, configID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete configuration"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update configuration"})
 		return
 	}
+	// Failures of the old endpoint or credentials say nothing about the new ones
+	s.health.reset(updateData.ID)
 
-	// If this was the default, set another as default
-	if config.IsDefault && len(configs) > 1 {
-		for _, cfg := range configs {
-			if cfg.ID != configID {
-				s.setDefaultConfig(userID, cfg.ID)
-				break
-			}
-		}
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Configuration deleted successfully"})
+	c.Header("ETag", fmt.Sprintf(`"%d"`, newVersion))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Configuration updated successfully",
+		"version": newVersion,
+	})
 }
 
-
-
 func (s *S3Service) AutoConfigureMinIO(c *gin.Context) {
 	userID := c.GetString("user_id")
 	if userID == "" {
@@ -932,6 +4021,7 @@ func (s *S3Service) AutoConfigureMinIO(c *gin.Context) {
 	}
 
 	// Save configuration to database
+	config.OrgID = c.GetString("org_id")
 	err = s.saveConfig(*config)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save configuration: " + err.Error()})
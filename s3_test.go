@@ -0,0 +1,126 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"s3mgr/config"
+)
+
+func TestUserObjectKey(t *testing.T) {
+	tests := []struct {
+		name         string
+		globalPrefix string
+		key          string
+		want         string
+		wantOK       bool
+	}{
+		{"plain file", "", "report.pdf", "users/alice/report.pdf", true},
+		{"nested file", "", "reports/2024/q1.pdf", "users/alice/reports/2024/q1.pdf", true},
+		{"leading slash", "", "/report.pdf", "users/alice/report.pdf", true},
+		{"global prefix", "tenant/", "report.pdf", "tenant/users/alice/report.pdf", true},
+		{"dots in a name", "", "a..b/file.tar.gz", "users/alice/a..b/file.tar.gz", true},
+		{"empty", "", "", "", false},
+		{"root only", "", "/", "", false},
+		{"parent directory", "", "../bob/secret.txt", "", false},
+		{"parent inside the path", "", "a/../../bob/secret.txt", "", false},
+		{"current directory", "", "./report.pdf", "", false},
+		{"double slash", "", "a//b.txt", "", false},
+		{"trailing slash", "", "folder/", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &S3Service{cfg: &config.Config{Storage: config.StorageConfig{GlobalKeyPrefix: tt.globalPrefix}}}
+			got, ok := s.userObjectKey("alice", tt.key)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("userObjectKey(%q) = %q, %v; want %q, %v", tt.key, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestKeyRoutesRejectEscapingKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := NewS3Service(newTestDB(t), nil, &config.Config{})
+
+	// Route the way main does, so an escaped "/" stays inside :key
+	r := gin.New()
+	r.UseRawPath = true
+	r.UnescapePathValues = true
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", "alice")
+		c.Next()
+	})
+	r.GET("/files/download/:key", s.DownloadFile)
+	r.GET("/files/meta/:key", s.GetFileMeta)
+	r.DELETE("/files/:key", s.DeleteFile)
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/files/download/..%2Fbob%2Fsecret.txt", http.StatusBadRequest},
+		{http.MethodGet, "/files/download/docs%2F..%2F..%2Fbob%2Fsecret.txt", http.StatusBadRequest},
+		{http.MethodGet, "/files/meta/..%2Fbob%2Fsecret.txt", http.StatusBadRequest},
+		{http.MethodDelete, "/files/..%2Fbob%2Fsecret.txt", http.StatusBadRequest},
+		{http.MethodDelete, "/files/..%2Fbob%2Fsecret.txt?version_id=v1", http.StatusBadRequest},
+		{http.MethodDelete, "/files/..%2Fbob%2Fsecret.txt?dry_run=true", http.StatusBadRequest},
+		// Valid nested keys get past key validation; alice has no configurations
+		{http.MethodGet, "/files/download/reports%2Fq1.pdf", http.StatusNotFound},
+		{http.MethodGet, "/files/meta/reports%2Fq1.pdf", http.StatusNotFound},
+		{http.MethodDelete, "/files/reports%2Fq1.pdf", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminDownloadFileHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<script>alert(1)</script>"))
+	}))
+	defer storage.Close()
+
+	s := NewS3Service(newTestDB(t), nil, &config.Config{})
+	if err := s.saveConfig(S3Config{
+		ID: "cfg1", UserID: "bob", StorageType: "minio", EndpointURL: storage.URL,
+		Region: "us-east-1", BucketName: "bucket", AccessKey: "key", SecretKey: "secret",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("is_super_admin", true)
+		c.Next()
+	})
+	r.GET("/admin/files/download", s.AdminDownloadFile)
+
+	const filename = `a"b; filename=evil.html`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"/admin/files/download?config_id=cfg1&key="+url.QueryEscape("users/bob/"+filename), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+	disposition, params, err := mime.ParseMediaType(w.Header().Get("Content-Disposition"))
+	if err != nil || disposition != "attachment" || params["filename"] != filename {
+		t.Errorf("Content-Disposition = %q, want an attachment named %q", w.Header().Get("Content-Disposition"), filename)
+	}
+	if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+	}
+}
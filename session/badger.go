@@ -0,0 +1,126 @@
+package session
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// badgerUpdateAttempts bounds retries when a concurrent write conflicts with a token update
+const badgerUpdateAttempts = 5
+
+// BadgerStore keeps session state in the server's own database. Sessions are
+// only visible to this instance.
+type BadgerStore struct {
+	db *badger.DB
+}
+
+func NewBadgerStore(db *badger.DB) *BadgerStore {
+	return &BadgerStore{db: db}
+}
+
+func setRefreshToken(txn *badger.Txn, record RefreshToken) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	entry := badger.NewEntry([]byte(refreshTokenKey(record.ID)), data).WithTTL(time.Until(record.ExpiresAt))
+	return txn.SetEntry(entry)
+}
+
+func (s *BadgerStore) SaveRefreshToken(record RefreshToken) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return setRefreshToken(txn, record)
+	})
+}
+
+func (s *BadgerStore) UpdateRefreshToken(id string, update func(current RefreshToken) ([]RefreshToken, error)) error {
+	var err error
+	for attempt := 0; attempt < badgerUpdateAttempts; attempt++ {
+		err = s.db.Update(func(txn *badger.Txn) error {
+			item, err := txn.Get([]byte(refreshTokenKey(id)))
+			if err == badger.ErrKeyNotFound {
+				return ErrNotFound
+			}
+			if err != nil {
+				return err
+			}
+			var current RefreshToken
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &current)
+			}); err != nil {
+				return err
+			}
+
+			records, err := update(current)
+			if err != nil {
+				return err
+			}
+			for _, record := range records {
+				if err := setRefreshToken(txn, record); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != badger.ErrConflict {
+			return err
+		}
+	}
+	return err
+}
+
+func (s *BadgerStore) RevokeSession(family string, ttl time.Duration) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		entry := badger.NewEntry([]byte(revokedSessionKey(family)), []byte(time.Now().Format(time.RFC3339))).WithTTL(ttl)
+		return txn.SetEntry(entry)
+	})
+}
+
+func (s *BadgerStore) IsSessionRevoked(family string) (bool, error) {
+	err := s.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(revokedSessionKey(family)))
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *BadgerStore) RevokeUserSessions(username string, ttl time.Duration) error {
+	families := make(map[string]bool)
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(refreshTokenKey(""))
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var record RefreshToken
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &record)
+			}); err != nil {
+				return err
+			}
+			if record.Username == username {
+				families[record.Family] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for family := range families {
+		if err := s.RevokeSession(family, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close is a no-op; the database is owned and closed by the caller
+func (s *BadgerStore) Close() error {
+	return nil
+}
@@ -0,0 +1,166 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"s3mgr/config"
+)
+
+const (
+	// redisTimeout bounds every Redis round trip so a slow server cannot hang requests
+	redisTimeout = 5 * time.Second
+	// redisUpdateAttempts bounds retries when another instance changes a token mid-update
+	redisUpdateAttempts = 5
+)
+
+// RedisStore keeps session state in Redis so that every instance sharing the
+// server sees the same sessions
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore connects to Redis, failing if the server cannot be reached
+func NewRedisStore(cfg config.RedisConfig) (*RedisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis at %s: %v", cfg.Addr, err)
+	}
+	return &RedisStore{client: client, prefix: cfg.KeyPrefix}, nil
+}
+
+func (s *RedisStore) key(k string) string {
+	return s.prefix + k
+}
+
+func setRedisRefreshToken(ctx context.Context, pipe redis.Cmdable, key string, record RefreshToken) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(record.ExpiresAt)
+	if ttl <= 0 {
+		return pipe.Del(ctx, key).Err()
+	}
+	return pipe.Set(ctx, key, data, ttl).Err()
+}
+
+func (s *RedisStore) SaveRefreshToken(record RefreshToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return setRedisRefreshToken(ctx, s.client, s.key(refreshTokenKey(record.ID)), record)
+}
+
+// UpdateRefreshToken watches the token key so that the update is discarded
+// and retried if another instance changes the token first
+func (s *RedisStore) UpdateRefreshToken(id string, update func(current RefreshToken) ([]RefreshToken, error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	key := s.key(refreshTokenKey(id))
+	txf := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var current RefreshToken
+		if err := json.Unmarshal(data, &current); err != nil {
+			return err
+		}
+
+		records, err := update(current)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, record := range records {
+				if err := setRedisRefreshToken(ctx, pipe, s.key(refreshTokenKey(record.ID)), record); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for attempt := 0; attempt < redisUpdateAttempts; attempt++ {
+		err = s.client.Watch(ctx, txf, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return err
+}
+
+func (s *RedisStore) RevokeSession(family string, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return s.client.Set(ctx, s.key(revokedSessionKey(family)), time.Now().Format(time.RFC3339), ttl).Err()
+}
+
+func (s *RedisStore) IsSessionRevoked(family string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	n, err := s.client.Exists(ctx, s.key(revokedSessionKey(family))).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// RevokeUserSessions scans every stored refresh token, so it is only meant
+// for rare administrative actions like password resets
+func (s *RedisStore) RevokeUserSessions(username string, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	families := make(map[string]bool)
+	iter := s.client.Scan(ctx, 0, s.key(refreshTokenKey("*")), 0).Iterator()
+	for iter.Next(ctx) {
+		data, err := s.client.Get(ctx, iter.Val()).Bytes()
+		if err == redis.Nil {
+			continue // Expired since the scan found it
+		}
+		if err != nil {
+			return err
+		}
+		var record RefreshToken
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		if record.Username == username {
+			families[record.Family] = true
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	for family := range families {
+		if err := s.client.Set(ctx, s.key(revokedSessionKey(family)), time.Now().Format(time.RFC3339), ttl).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,70 @@
+// Package session stores login session state: refresh tokens and revoked
+// sessions. The default store keeps it in the server's Badger database; the
+// Redis store lets several instances behind a load balancer share sessions.
+package session
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"s3mgr/config"
+)
+
+// ErrNotFound is returned for a refresh token that does not exist or has expired
+var ErrNotFound = errors.New("session record not found")
+
+// RefreshToken is the server-side record of an issued refresh token. Every
+// token issued from one login shares a Family, which is also the "sid" of the
+// access tokens, so that a logout or a reused token revokes the whole session.
+type RefreshToken struct {
+	ID         string    `json:"id"`
+	Family     string    `json:"family"`
+	Username   string    `json:"username"`
+	IssuedAt   time.Time `json:"issued_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Revoked    bool      `json:"revoked"`
+	ReplacedBy string    `json:"replaced_by,omitempty"`
+}
+
+// Store persists session state. Records expire on their own: refresh tokens
+// at ExpiresAt and revoked-session markers after the given ttl.
+type Store interface {
+	// SaveRefreshToken stores a new or updated refresh token
+	SaveRefreshToken(record RefreshToken) error
+	// UpdateRefreshToken loads the token id and atomically stores the records
+	// returned by update. update must not have side effects; it may be called
+	// again if a concurrent write conflicts.
+	UpdateRefreshToken(id string, update func(current RefreshToken) ([]RefreshToken, error)) error
+	// RevokeSession marks every token of the session family as revoked for ttl
+	RevokeSession(family string, ttl time.Duration) error
+	// IsSessionRevoked reports whether the session family has been revoked
+	IsSessionRevoked(family string) (bool, error)
+	// RevokeUserSessions revokes every session of username that still has a
+	// refresh token, for ttl
+	RevokeUserSessions(username string, ttl time.Duration) error
+	// Close releases the store's connections
+	Close() error
+}
+
+// NewStore returns the session store selected by cfg. db backs the default Badger store.
+func NewStore(cfg config.SessionConfig, db *badger.DB) (Store, error) {
+	switch cfg.Store {
+	case "", config.SessionStoreBadger:
+		return NewBadgerStore(db), nil
+	case config.SessionStoreRedis:
+		return NewRedisStore(cfg.Redis)
+	default:
+		return nil, fmt.Errorf("unknown session store %q", cfg.Store)
+	}
+}
+
+func refreshTokenKey(id string) string {
+	return "refresh_token:" + id
+}
+
+func revokedSessionKey(family string) string {
+	return "revoked_session:" + family
+}
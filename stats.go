@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/gin-gonic/gin"
+
+	"s3mgr/users"
+)
+
+// statsCacheTTL is how long computed stats are reused, so a dashboard loading
+// them on every page view does not rescan the bucket each time
+const statsCacheTTL = time.Minute
+
+// ObjectSummary identifies one object by its key relative to the user's prefix
+type ObjectSummary struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+// StorageStats summarizes a set of objects
+type StorageStats struct {
+	Objects       int64          `json:"objects"`
+	TotalBytes    int64          `json:"total_bytes"`
+	LargestObject *ObjectSummary `json:"largest_object,omitempty"`
+	LastUpload    *time.Time     `json:"last_upload,omitempty"`
+}
+
+// add folds other into st
+func (st *StorageStats) add(other StorageStats) {
+	st.Objects += other.Objects
+	st.TotalBytes += other.TotalBytes
+	if other.LargestObject != nil && (st.LargestObject == nil || other.LargestObject.Size > st.LargestObject.Size) {
+		st.LargestObject = other.LargestObject
+	}
+	if other.LastUpload != nil && (st.LastUpload == nil || other.LastUpload.After(*st.LastUpload)) {
+		st.LastUpload = other.LastUpload
+	}
+}
+
+// UserStats are one user's stats across all of their configurations
+type UserStats struct {
+	UserID string `json:"user_id"`
+	StorageStats
+	// ByStorageType groups the stats by config storage type when the user has more than one config
+	ByStorageType map[string]StorageStats `json:"by_storage_type,omitempty"`
+	byType        map[string]StorageStats // Always filled, for admin aggregates
+	// Errors lists configs that could not be scanned, by config ID; their objects are not counted
+	Errors     map[string]string `json:"errors,omitempty"`
+	ComputedAt time.Time         `json:"computed_at"`
+}
+
+// statsCache keeps recently computed user stats in memory
+type statsCache struct {
+	mu      sync.Mutex
+	entries map[string]UserStats
+}
+
+func newStatsCache() *statsCache {
+	return &statsCache{entries: make(map[string]UserStats)}
+}
+
+func (sc *statsCache) get(userID string) (UserStats, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	entry, ok := sc.entries[userID]
+	if !ok || time.Since(entry.ComputedAt) >= statsCacheTTL {
+		delete(sc.entries, userID)
+		return UserStats{}, false
+	}
+	return entry, true
+}
+
+func (sc *statsCache) put(stats UserStats) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.entries[stats.UserID] = stats
+}
+
+// computeConfigStats scans every object under the user's prefix in config
+func (s *S3Service) computeConfigStats(userID string, config S3Config) (StorageStats, error) {
+	var stats StorageStats
+	client := s.createS3Client(config)
+	if client == nil {
+		return stats, fmt.Errorf("failed to create storage client")
+	}
+	userPrefix := s.userPrefix(userID)
+	err := client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(config.BucketName),
+		Prefix: aws.String(userPrefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			size := aws.Int64Value(obj.Size)
+			stats.Objects++
+			stats.TotalBytes += size
+			if stats.LargestObject == nil || size > stats.LargestObject.Size {
+				stats.LargestObject = &ObjectSummary{Key: strings.TrimPrefix(aws.StringValue(obj.Key), userPrefix), Size: size}
+			}
+			if modified := aws.TimeValue(obj.LastModified); stats.LastUpload == nil || modified.After(*stats.LastUpload) {
+				stats.LastUpload = &modified
+			}
+		}
+		return true
+	})
+	return stats, err
+}
+
+// userStats returns the user's stats, from the cache when recent enough. A
+// full scan also refreshes the cached storage usage used for quotas.
+func (s *S3Service) userStats(userID string) (UserStats, error) {
+	if cached, ok := s.stats.get(userID); ok {
+		return cached, nil
+	}
+
+	configs, err := s.getUserConfigs(userID)
+	if err != nil {
+		return UserStats{}, err
+	}
+	result := UserStats{UserID: userID, ComputedAt: time.Now(), byType: make(map[string]StorageStats)}
+	for _, config := range configs {
+		stats, err := s.computeConfigStats(userID, config)
+		if err != nil {
+			if result.Errors == nil {
+				result.Errors = make(map[string]string)
+			}
+			result.Errors[config.ID] = err.Error()
+			continue
+		}
+		s.storeUsage(userID, config.ID, StorageUsage{Bytes: stats.TotalBytes, Objects: stats.Objects, ComputedAt: result.ComputedAt})
+		result.add(stats)
+		group := result.byType[config.StorageType]
+		group.add(stats)
+		result.byType[config.StorageType] = group
+	}
+	if len(configs) > 1 {
+		result.ByStorageType = result.byType
+	}
+	// Partial results are not cached, so a recovered backend shows up on the next request
+	if result.Errors == nil {
+		s.stats.put(result)
+	}
+	return result, nil
+}
+
+// GetStats returns object count, total size, largest object and last upload
+// time for the current user
+func (s *S3Service) GetStats(c *gin.Context) {
+	stats, err := s.userStats(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get configurations"})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetAllStats returns aggregate stats across all users the admin can see,
+// plus a per-user breakdown sorted by total size (admin only)
+func (s *S3Service) GetAllStats(c *gin.Context) {
+	var userIDs []string
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte("user:")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var user users.User
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &user)
+			}); err != nil {
+				return err
+			}
+			if canAccessOrg(c, user.OrgID) {
+				userIDs = append(userIDs, user.Username)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get users"})
+		return
+	}
+
+	var total StorageStats
+	byType := make(map[string]StorageStats)
+	perUser := make([]UserStats, 0, len(userIDs))
+	for _, userID := range userIDs {
+		stats, err := s.userStats(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get configurations"})
+			return
+		}
+		total.add(stats.StorageStats)
+		for storageType, group := range stats.byType {
+			merged := byType[storageType]
+			merged.add(group)
+			byType[storageType] = merged
+		}
+		perUser = append(perUser, stats)
+	}
+	sort.Slice(perUser, func(i, j int) bool {
+		return perUser[i].TotalBytes > perUser[j].TotalBytes
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":           total,
+		"by_storage_type": byType,
+		"user_count":      len(perUser),
+		"users":           perUser,
+	})
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/gin-gonic/gin"
+
+	"s3mgr/logger"
+)
+
+// usageCacheTTL bounds how long a cached usage total is trusted. Changes the
+// server cannot size exactly (overwrites, presigned uploads, copies, other
+// clients writing to the bucket) are picked up when it is recomputed.
+const usageCacheTTL = time.Hour
+
+// StorageUsage is the space a user's objects take up in one configuration's
+// bucket. It is cached under storage_usage:<userID>:<configID>.
+type StorageUsage struct {
+	Bytes      int64     `json:"bytes"`
+	Objects    int64     `json:"objects"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+func storageUsageKey(userID, configID string) []byte {
+	return []byte("storage_usage:" + userID + ":" + configID)
+}
+
+// computeUsage sums the size of every object under the user's prefix
+func (s *S3Service) computeUsage(userID string, config S3Config) (StorageUsage, error) {
+	client := s.createS3Client(config)
+	if client == nil {
+		return StorageUsage{}, fmt.Errorf("failed to create storage client")
+	}
+	usage := StorageUsage{ComputedAt: time.Now()}
+	err := client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(config.BucketName),
+		Prefix: aws.String(s.userPrefix(userID)),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			usage.Bytes += aws.Int64Value(obj.Size)
+			usage.Objects++
+		}
+		return true
+	})
+	return usage, err
+}
+
+// configUsage returns the user's cached usage in config, computing and
+// caching it when missing or expired
+func (s *S3Service) configUsage(userID string, config S3Config) (StorageUsage, error) {
+	var usage StorageUsage
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(storageUsageKey(userID, config.ID))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &usage)
+		})
+	})
+	if err == nil {
+		return usage, nil
+	}
+	if err != badger.ErrKeyNotFound {
+		return usage, err
+	}
+
+	usage, err = s.computeUsage(userID, config)
+	if err != nil {
+		return usage, err
+	}
+	return usage, s.storeUsage(userID, config.ID, usage)
+}
+
+// storeUsage caches a freshly computed usage entry for usageCacheTTL
+func (s *S3Service) storeUsage(userID, configID string, usage StorageUsage) error {
+	data, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(storageUsageKey(userID, configID), data).WithTTL(usageCacheTTL))
+	})
+}
+
+// userUsage returns the user's total usage across all of their configurations
+func (s *S3Service) userUsage(userID string) (int64, error) {
+	configs, err := s.getUserConfigs(userID)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, config := range configs {
+		usage, err := s.configUsage(userID, config)
+		if err != nil {
+			return 0, err
+		}
+		total += usage.Bytes
+	}
+	return total, nil
+}
+
+// adjustUsage applies a known change to a cached usage entry. Without a cached
+// entry there is nothing to adjust: the next read computes it from the bucket.
+func (s *S3Service) adjustUsage(userID, configID string, bytes, objects int64) {
+	key := storageUsageKey(userID, configID)
+	err := s.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		var usage StorageUsage
+		if err := item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &usage)
+		}); err != nil {
+			return err
+		}
+		usage.Bytes = max(usage.Bytes+bytes, 0)
+		usage.Objects = max(usage.Objects+objects, 0)
+		data, err := json.Marshal(usage)
+		if err != nil {
+			return err
+		}
+		// Keep the original expiry so the entry is still recomputed on schedule
+		ttl := time.Until(time.Unix(int64(item.ExpiresAt()), 0))
+		return txn.SetEntry(badger.NewEntry(key, data).WithTTL(ttl))
+	})
+	if err != nil && err != badger.ErrKeyNotFound {
+		// A stale total is worse than a recomputation
+		logger.Warn("Failed to adjust storage usage, invalidating it", map[string]interface{}{
+			"user_id":   userID,
+			"config_id": configID,
+			"error":     err.Error(),
+		})
+		s.invalidateUsage(userID, configID)
+	}
+}
+
+// invalidateUsage drops a cached usage entry after a change of unknown size
+func (s *S3Service) invalidateUsage(userID, configID string) {
+	s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(storageUsageKey(userID, configID))
+	})
+}
+
+// checkQuota responds 413 and returns false when storing size more bytes
+// would take userID over their quota. Users without a quota always pass.
+func (s *S3Service) checkQuota(c *gin.Context, userID string, size int64) bool {
+	user, err := s.getUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return false
+	}
+	if user.QuotaBytes <= 0 {
+		return true
+	}
+	used, err := s.userUsage(userID)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to determine storage usage: " + err.Error()})
+		return false
+	}
+	if used+size > user.QuotaBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":           "Storage quota exceeded",
+			"code":            "quota_exceeded",
+			"quota_bytes":     user.QuotaBytes,
+			"used_bytes":      used,
+			"requested_bytes": size,
+		})
+		return false
+	}
+	return true
+}
+
+// GetUsage returns the caller's storage usage per configuration and in total,
+// against their quota (0 = unlimited)
+func (s *S3Service) GetUsage(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	user, err := s.getUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return
+	}
+	configs, err := s.getUserConfigs(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get configurations"})
+		return
+	}
+
+	var used int64
+	perConfig := make([]gin.H, 0, len(configs))
+	for _, config := range configs {
+		usage, err := s.configUsage(userID, config)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":     "Failed to determine storage usage: " + err.Error(),
+				"config_id": config.ID,
+			})
+			return
+		}
+		used += usage.Bytes
+		perConfig = append(perConfig, gin.H{
+			"config_id":   config.ID,
+			"name":        config.Name,
+			"bytes":       usage.Bytes,
+			"objects":     usage.Objects,
+			"computed_at": usage.ComputedAt,
+		})
+	}
+
+	resp := gin.H{
+		"used_bytes":  used,
+		"quota_bytes": user.QuotaBytes,
+		"configs":     perConfig,
+	}
+	if user.QuotaBytes > 0 {
+		resp["remaining_bytes"] = max(user.QuotaBytes-used, 0)
+	}
+	c.JSON(http.StatusOK, resp)
+}
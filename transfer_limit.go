@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// transferSlots is a per-user counting semaphore over the transfers running on
+// this instance, so one user cannot take every connection to storage
+type transferSlots struct {
+	mu    sync.Mutex
+	limit int            // Transfers one user may run at once (0 = unlimited)
+	inUse map[string]int // User ID -> transfers running
+}
+
+func newTransferSlots(limit int) *transferSlots {
+	return &transferSlots{limit: limit, inUse: make(map[string]int)}
+}
+
+// acquire takes one of userID's slots, returning false when all are in use
+func (t *transferSlots) acquire(userID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.limit > 0 && t.inUse[userID] >= t.limit {
+		return false
+	}
+	t.inUse[userID]++
+	return true
+}
+
+func (t *transferSlots) release(userID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.inUse[userID] <= 1 {
+		delete(t.inUse, userID)
+		return
+	}
+	t.inUse[userID]--
+}
+
+// limitTransfers runs the rest of the chain in one of the caller's transfer
+// slots, or responds 429 when storage.max_concurrent_per_user are already busy
+func (s *S3Service) limitTransfers(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if !s.transfers.acquire(userID) {
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error": "Too many transfers in progress; wait for one to finish",
+			"code":  "too_many_transfers",
+			"limit": s.transfers.limit,
+		})
+		return
+	}
+	defer s.transfers.release(userID)
+	c.Next()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadLocks tracks the keys with an upload in progress on this instance, so
+// a second upload of the same key is rejected instead of interleaving its
+// parts with the first (or aborting the first one's multipart upload)
+type uploadLocks struct {
+	mu       sync.Mutex
+	inFlight map[string]time.Time // Lock key -> when the upload started
+}
+
+func newUploadLocks() *uploadLocks {
+	return &uploadLocks{inFlight: make(map[string]time.Time)}
+}
+
+// uploadLockKey identifies an upload the same way upload sessions do: by
+// user, config and key
+func uploadLockKey(userID, configID, key string) string {
+	return userID + ":" + configID + ":" + key
+}
+
+// acquire marks lockKey as uploading. If another upload of it is in progress
+// it returns false and when that upload started.
+func (l *uploadLocks) acquire(lockKey string) (bool, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if started, ok := l.inFlight[lockKey]; ok {
+		return false, started
+	}
+	l.inFlight[lockKey] = time.Now()
+	return true, time.Time{}
+}
+
+func (l *uploadLocks) release(lockKey string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.inFlight, lockKey)
+}
+
+// lockUpload takes the upload lock for userID's key in configID, or responds
+// 409 and returns false when another upload of the key is still running.
+// Callers must call the returned release function once the upload finishes.
+func (s *S3Service) lockUpload(c *gin.Context, userID, configID, key string) (func(), bool) {
+	lockKey := uploadLockKey(userID, configID, key)
+	if ok, started := s.uploads.acquire(lockKey); !ok {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":      "Another upload of " + key + " is in progress",
+			"code":       "upload_in_progress",
+			"started_at": started,
+		})
+		return nil, false
+	}
+	return func() { s.uploads.release(lockKey) }, true
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/gin-gonic/gin"
+
+	"s3mgr/response"
+)
+
+// maxUploadParts is the most parts S3 allows in one multipart upload
+const maxUploadParts = 10000
+
+// UploadedPart is one part of a multipart upload that has reached storage
+type UploadedPart struct {
+	PartNumber int64  `json:"part_number"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size"`
+}
+
+// UploadSession tracks an in-progress multipart upload so it can be resumed
+// after a failed part instead of starting over. Sessions are stored under
+// upload_session:<userID>:<configID>:<key> and removed once the upload
+// completes or is aborted.
+type UploadSession struct {
+	ID          string         `json:"id"`
+	UserID      string         `json:"user_id"`
+	ConfigID    string         `json:"config_id"`
+	Key         string         `json:"key"`
+	FullKey     string         `json:"full_key"`
+	UploadID    string         `json:"upload_id"`
+	ContentType string         `json:"content_type"`
+	ACL         string         `json:"acl,omitempty"`
+	SSE         string         `json:"sse,omitempty"`
+	SSEKMSKeyID string         `json:"sse_kms_key_id,omitempty"`
+	Size        int64          `json:"size"`
+	PartSize    int64          `json:"part_size"`
+	Parts       []UploadedPart `json:"parts"`
+	ExpiresAt   time.Time      `json:"expires_at,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+func uploadSessionKey(userID, configID, key string) []byte {
+	return []byte("upload_session:" + userID + ":" + configID + ":" + key)
+}
+
+// legacyUploadSessionKey is where sessions were stored before they were
+// keyed by config as well
+func legacyUploadSessionKey(userID, key string) []byte {
+	return []byte("upload_session:" + userID + ":" + key)
+}
+
+// dropLegacyUploadSession removes the session's record under its legacy key,
+// if it is still stored there, so it is not listed twice
+func dropLegacyUploadSession(txn *badger.Txn, session *UploadSession) error {
+	item, err := txn.Get(legacyUploadSessionKey(session.UserID, session.Key))
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var stored UploadSession
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &stored)
+	}); err != nil || stored.ID != session.ID {
+		// Not a session record (e.g. a key that itself contains the config ID) or another session
+		return nil
+	}
+	return txn.Delete(legacyUploadSessionKey(session.UserID, session.Key))
+}
+
+// partCount is the number of parts the session's file splits into
+func (u *UploadSession) partCount() int64 {
+	return (u.Size + u.PartSize - 1) / u.PartSize
+}
+
+// uploadedBytes sums the sizes of the parts already in storage
+func (u *UploadSession) uploadedBytes() int64 {
+	var total int64
+	for _, part := range u.Parts {
+		total += part.Size
+	}
+	return total
+}
+
+// uploadPartSize returns the configured part size, raised if needed so that
+// size fits within maxUploadParts
+func (s *S3Service) uploadPartSize(size int64) int64 {
+	partSize := int64(s.cfg.Upload.PartSizeMB) * 1024 * 1024
+	if min := (size + maxUploadParts - 1) / maxUploadParts; partSize < min {
+		partSize = min
+	}
+	return partSize
+}
+
+func (s *S3Service) saveUploadSession(session *UploadSession) error {
+	session.UpdatedAt = time.Now()
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		if err := dropLegacyUploadSession(txn, session); err != nil {
+			return err
+		}
+		return txn.Set(uploadSessionKey(session.UserID, session.ConfigID, session.Key), data)
+	})
+}
+
+func (s *S3Service) deleteUploadSession(session *UploadSession) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		if err := dropLegacyUploadSession(txn, session); err != nil {
+			return err
+		}
+		return txn.Delete(uploadSessionKey(session.UserID, session.ConfigID, session.Key))
+	})
+}
+
+// keyUploadSessions returns the user's sessions for key, limited to one
+// config unless configID is empty
+func (s *S3Service) keyUploadSessions(userID, configID, key string) ([]UploadSession, error) {
+	sessions, err := s.listUploadSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+	var matching []UploadSession
+	for _, session := range sessions {
+		if session.Key == key && (configID == "" || session.ConfigID == configID) {
+			matching = append(matching, session)
+		}
+	}
+	return matching, nil
+}
+
+// getUploadSession returns the user's session for key in config, or nil if there is none
+func (s *S3Service) getUploadSession(userID, configID, key string) (*UploadSession, error) {
+	sessions, err := s.keyUploadSessions(userID, configID, key)
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	return &sessions[0], nil
+}
+
+// abortUploadSession aborts the session's multipart upload through the
+// session's own config and removes the session. A session whose config is
+// gone is just removed, since it can never be resumed.
+func (s *S3Service) abortUploadSession(userID string, session *UploadSession) error {
+	if config, err := s.getConfigByID(userID, session.ConfigID); err == nil {
+		if client := s.createS3Client(*config); client != nil {
+			_, err := client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(config.BucketName),
+				Key:      aws.String(session.FullKey),
+				UploadId: aws.String(session.UploadID),
+			})
+			if err != nil && !isObjectNotFound(err) {
+				return fmt.Errorf("abort: %v", err)
+			}
+		}
+	}
+	return s.deleteUploadSession(session)
+}
+
+// listUploadSessions returns every in-progress upload for the user
+func (s *S3Service) listUploadSessions(userID string) ([]UploadSession, error) {
+	var sessions []UploadSession
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte("upload_session:" + userID + ":")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			err := it.Item().Value(func(val []byte) error {
+				var session UploadSession
+				if err := json.Unmarshal(val, &session); err != nil {
+					return err
+				}
+				sessions = append(sessions, session)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return sessions, err
+}
+
+// findUploadSession looks up one of the user's sessions by its ID
+func (s *S3Service) findUploadSession(userID, id string) (*UploadSession, error) {
+	sessions, err := s.listUploadSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		if session.ID == id {
+			return &session, nil
+		}
+	}
+	return nil, nil
+}
+
+// startMultipartUpload creates the multipart upload in storage and persists its session
+func (s *S3Service) startMultipartUpload(client *s3.S3, config *S3Config, session *UploadSession) error {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(config.BucketName),
+		Key:         aws.String(session.FullKey),
+		ContentType: aws.String(session.ContentType),
+	}
+	if session.ACL != "" {
+		input.ACL = aws.String(session.ACL)
+	}
+	if session.SSE != "" {
+		input.ServerSideEncryption = aws.String(session.SSE)
+	}
+	if session.SSEKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(session.SSEKMSKeyID)
+	}
+	output, err := client.CreateMultipartUpload(input)
+	if err != nil {
+		return err
+	}
+	session.ID = fmt.Sprintf("upload_%d", time.Now().UnixNano())
+	session.UploadID = aws.StringValue(output.UploadId)
+	session.CreatedAt = time.Now()
+	return s.saveUploadSession(session)
+}
+
+// uploadMissingParts uploads every part of src not yet recorded in the session,
+// using up to Upload.Concurrency workers. Each part is read from its own offset,
+// so parts already in storage are skipped, and the session is saved as parts succeed.
+func (s *S3Service) uploadMissingParts(client *s3.S3, bucket string, session *UploadSession, src io.ReaderAt) error {
+	done := make(map[int64]bool, len(session.Parts))
+	for _, part := range session.Parts {
+		done[part.PartNumber] = true
+	}
+	var pending []int64
+	for n := int64(1); n <= session.partCount(); n++ {
+		if !done[n] {
+			pending = append(pending, n)
+		}
+	}
+
+	workers := s.cfg.Upload.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan int64)
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for partNumber := range jobs {
+				offset := (partNumber - 1) * session.PartSize
+				size := session.PartSize
+				if offset+size > session.Size {
+					size = session.Size - offset
+				}
+				output, err := client.UploadPart(&s3.UploadPartInput{
+					Bucket:        aws.String(bucket),
+					Key:           aws.String(session.FullKey),
+					UploadId:      aws.String(session.UploadID),
+					PartNumber:    aws.Int64(partNumber),
+					Body:          io.NewSectionReader(src, offset, size),
+					ContentLength: aws.Int64(size),
+				})
+
+				mu.Lock()
+				if err == nil {
+					session.Parts = append(session.Parts, UploadedPart{PartNumber: partNumber, ETag: aws.StringValue(output.ETag), Size: size})
+					err = s.saveUploadSession(session)
+				}
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, partNumber := range pending {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		jobs <- partNumber
+	}
+	close(jobs)
+	wg.Wait()
+	return firstErr
+}
+
+// completeMultipartUpload assembles the uploaded parts and removes the session
+func (s *S3Service) completeMultipartUpload(client *s3.S3, bucket string, session *UploadSession) error {
+	sort.Slice(session.Parts, func(i, j int) bool {
+		return session.Parts[i].PartNumber < session.Parts[j].PartNumber
+	})
+	parts := make([]*s3.CompletedPart, 0, len(session.Parts))
+	for _, part := range session.Parts {
+		parts = append(parts, &s3.CompletedPart{
+			PartNumber: aws.Int64(part.PartNumber),
+			ETag:       aws.String(part.ETag),
+		})
+	}
+	_, err := client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(session.FullKey),
+		UploadId:        aws.String(session.UploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return err
+	}
+	return s.deleteUploadSession(session)
+}
+
+// verifyCompletedUpload checks that a completed multipart upload produced an
+// object of the expected size, deleting it on a mismatch so a short or padded
+// object is not left in place; the error says if that delete failed. It
+// returns the stored size. When the object cannot be read it is left alone,
+// since it may well be intact.
+func verifyCompletedUpload(client *s3.S3, bucket, fullKey string, expected int64) (int64, error) {
+	head, err := client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(fullKey),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read uploaded object: %v", err)
+	}
+	size := aws.Int64Value(head.ContentLength)
+	if size != expected {
+		_, err := client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(fullKey),
+		})
+		if err != nil {
+			return size, fmt.Errorf("stored object is %d bytes, expected %d; deleting it failed, so it is still in storage: %v", size, expected, err)
+		}
+		return size, fmt.Errorf("stored object is %d bytes, expected %d; it was deleted", size, expected)
+	}
+	return size, nil
+}
+
+// syncUploadedParts replaces the session's part list with what storage reports
+// via ListParts, picking up parts whose success was never recorded
+func syncUploadedParts(client *s3.S3, bucket string, session *UploadSession) error {
+	var parts []UploadedPart
+	err := client.ListPartsPages(&s3.ListPartsInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(session.FullKey),
+		UploadId: aws.String(session.UploadID),
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			parts = append(parts, UploadedPart{
+				PartNumber: aws.Int64Value(part.PartNumber),
+				ETag:       aws.StringValue(part.ETag),
+				Size:       aws.Int64Value(part.Size),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	// Only keep full parts at the expected size; anything else is re-sent
+	session.Parts = session.Parts[:0]
+	for _, part := range parts {
+		expected := session.PartSize
+		if part.PartNumber == session.partCount() {
+			expected = session.Size - (part.PartNumber-1)*session.PartSize
+		}
+		if part.Size == expected {
+			session.Parts = append(session.Parts, part)
+		}
+	}
+	return nil
+}
+
+// ResumeUpload continues a failed multipart upload. The client re-sends the
+// same file; parts already in storage are skipped.
+func (s *S3Service) ResumeUpload(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "resume_upload", "file", "", success, err, details)
+		}
+	}
+
+	userID := c.GetString("user_id")
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File required"})
+		return
+	}
+	defer file.Close()
+
+	// Without config_id the file's only interrupted upload is resumed, whichever config it is in
+	sessions, err := s.keyUploadSessions(userID, c.Query("config_id"), header.Filename)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load upload session"})
+		return
+	}
+	if len(sessions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No upload in progress for " + header.Filename})
+		return
+	}
+	if len(sessions) > 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": header.Filename + " has interrupted uploads in several configurations; pass config_id"})
+		return
+	}
+	configID := sessions[0].ConfigID
+
+	release, ok := s.lockUpload(c, userID, configID, header.Filename)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Reload under the lock; the session may have finished or been replaced meanwhile
+	session, err := s.getUploadSession(userID, configID, header.Filename)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load upload session"})
+		return
+	}
+	if session == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No upload in progress for " + header.Filename})
+		return
+	}
+	if header.Size != session.Size {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":         "File size does not match the interrupted upload",
+			"expected_size": session.Size,
+		})
+		return
+	}
+
+	config, err := s.resolveConfig(userID, session.ConfigID)
+	if respondConfigError(c, err) {
+		return
+	}
+	client := s.createS3Client(*config)
+	if client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage client"})
+		return
+	}
+
+	details := map[string]interface{}{
+		"upload_id": session.ID,
+		"filename":  session.Key,
+		"size":      session.Size,
+	}
+
+	if err := syncUploadedParts(client, config.BucketName, session); err != nil {
+		details["stage"] = "list_parts"
+		logAudit(false, err, details)
+		if isObjectNotFound(err) {
+			// The upload was aborted or expired in storage; nothing left to resume
+			s.deleteUploadSession(session)
+			c.JSON(http.StatusGone, gin.H{"error": "Upload no longer exists in storage; upload the file again"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list uploaded parts: " + err.Error()})
+		return
+	}
+	details["skipped_parts"] = len(session.Parts)
+
+	if err := s.uploadMissingParts(client, config.BucketName, session, file); err != nil {
+		details["stage"] = "upload_parts"
+		details["completed_parts"] = len(session.Parts)
+		logAudit(false, err, details)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":           "Failed to upload file: " + err.Error(),
+			"upload_id":       session.ID,
+			"resumable":       true,
+			"completed_parts": len(session.Parts),
+			"total_parts":     session.partCount(),
+		})
+		return
+	}
+	if err := s.completeMultipartUpload(client, config.BucketName, session); err != nil {
+		details["stage"] = "complete"
+		logAudit(false, err, details)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete upload: " + err.Error(), "upload_id": session.ID, "resumable": true})
+		return
+	}
+	if s.cfg.Upload.VerifyMultipart {
+		storedSize, err := verifyCompletedUpload(client, config.BucketName, session.FullKey, session.Size)
+		if err != nil {
+			// The completed upload replaced whatever was stored under the key
+			s.invalidateUsage(userID, config.ID)
+			s.clearObjectChecksum(config.ID, session.FullKey)
+			s.dropObjectExpiry(config.ID, session.FullKey)
+			details["stage"] = "verify"
+			details["stored_size"] = storedSize
+			logAudit(false, err, details)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Upload failed verification: " + err.Error(), "code": "upload_verification_failed"})
+			return
+		}
+		details["verified_size"] = storedSize
+	}
+	s.adjustUsage(userID, config.ID, session.Size, 1)
+	checksum := s.recordUploadChecksum(config.ID, session.FullKey, file, session.Size)
+	if checksum != "" {
+		details["sha256"] = checksum
+	}
+
+	// Like a new upload, the resumed one replaces any earlier expiry
+	if session.ExpiresAt.IsZero() {
+		s.dropObjectExpiry(config.ID, session.FullKey)
+	} else if err := s.setObjectExpiry(ObjectExpiry{ConfigID: config.ID, UserID: userID, Key: session.FullKey, ExpiresAt: session.ExpiresAt}); err != nil {
+		details["stage"] = "schedule_expiry"
+		logAudit(false, err, details)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "File uploaded but failed to record its expiry"})
+		return
+	}
+
+	logAudit(true, nil, details)
+	resp := gin.H{"message": "File uploaded successfully (resumed)", "key": session.Key}
+	if checksum != "" {
+		resp["sha256"] = checksum
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListUploads returns the user's in-progress multipart uploads
+func (s *S3Service) ListUploads(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	sessions, err := s.listUploadSessions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list uploads"})
+		return
+	}
+
+	uploads := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		uploads = append(uploads, gin.H{
+			"id":              session.ID,
+			"key":             session.Key,
+			"config_id":       session.ConfigID,
+			"size":            session.Size,
+			"uploaded_bytes":  session.uploadedBytes(),
+			"completed_parts": len(session.Parts),
+			"total_parts":     session.partCount(),
+			"created_at":      session.CreatedAt,
+			"updated_at":      session.UpdatedAt,
+		})
+	}
+	response.List(c, "uploads", uploads, response.All(len(uploads)), nil)
+}
+
+// AbortUpload aborts an in-progress multipart upload, freeing its parts in
+// storage, and removes its session
+func (s *S3Service) AbortUpload(c *gin.Context) {
+	// Audit logging helper
+	logAudit := func(success bool, err error, details map[string]interface{}) {
+		if s.auditService != nil {
+			s.auditService.LogEvent(c, "abort_upload", "file", c.Param("id"), success, err, details)
+		}
+	}
+
+	userID := c.GetString("user_id")
+
+	session, err := s.findUploadSession(userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load upload session"})
+		return
+	}
+	if session == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+	details := map[string]interface{}{"filename": session.Key, "config_id": session.ConfigID}
+
+	if err := s.abortUploadSession(userID, session); err != nil {
+		logAudit(false, err, details)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to abort upload: " + err.Error()})
+		return
+	}
+	logAudit(true, nil, details)
+	c.JSON(http.StatusOK, gin.H{"message": "Upload aborted"})
+}
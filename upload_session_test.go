@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestVerifyCompletedUpload(t *testing.T) {
+	tests := []struct {
+		name         string
+		storedSize   string
+		deleteStatus int
+		wantErr      string
+		wantDeleted  bool
+	}{
+		{"expected size", "10", http.StatusNoContent, "", false},
+		{"mismatch deleted", "7", http.StatusNoContent, "it was deleted", true},
+		{"mismatch delete failed", "7", http.StatusInternalServerError, "still in storage", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deleted := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodHead:
+					w.Header().Set("Content-Length", tt.storedSize)
+				case http.MethodDelete:
+					deleted = true
+					w.WriteHeader(tt.deleteStatus)
+				}
+			}))
+			defer server.Close()
+			client := s3.New(session.Must(session.NewSession(&aws.Config{
+				Endpoint:         aws.String(server.URL),
+				Region:           aws.String("us-east-1"),
+				Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+				S3ForcePathStyle: aws.Bool(true),
+				MaxRetries:       aws.Int(0),
+			})))
+
+			_, err := verifyCompletedUpload(client, "bucket", "users/alice/file.bin", 10)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if deleted != tt.wantDeleted {
+				t.Errorf("deleted = %v, want %v", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Package users holds the stored user record and password hashing shared by
+// the server and the create-admin tool, so both write compatible records.
+package users
+
+import (
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordCost is the bcrypt cost used for every stored password hash
+const PasswordCost = 14
+
+// User is a user account as stored under "user:<username>"
+type User struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Password  string    `json:"password,omitempty"` // Omit from JSON responses
+	Email     string    `json:"email,omitempty"`
+	IsAdmin   bool      `json:"is_admin"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	LastLogin time.Time `json:"last_login,omitempty"`
+	// OrgID is the organization the user belongs to ("" is the default organization)
+	OrgID        string `json:"org_id,omitempty"`
+	IsSuperAdmin bool   `json:"is_super_admin,omitempty"`
+	// PasswordHistory holds hashes of previous passwords, most recent first
+	PasswordHistory   []string  `json:"password_history,omitempty"`
+	PasswordChangedAt time.Time `json:"password_changed_at,omitempty"`
+	// ReactivatedAt restarts the inactivity clock when an admin re-enables the account
+	ReactivatedAt time.Time `json:"reactivated_at,omitempty"`
+	// MustChangePassword blocks everything but change-password until the user sets a new one
+	MustChangePassword bool `json:"must_change_password,omitempty"`
+	// QuotaBytes caps the total size of the user's objects across their configurations (0 = unlimited)
+	QuotaBytes int64 `json:"quota_bytes,omitempty"`
+}
+
+// HashPassword returns the bcrypt hash of password
+func HashPassword(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	return string(bytes), err
+}
+
+// CheckPasswordHash reports whether password matches hash
+func CheckPasswordHash(password, hash string) bool {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	return err == nil
+}